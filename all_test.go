@@ -1,18 +1,33 @@
 package copy
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
 	"embed"
 	"errors"
+	"fmt"
+	"hash"
+	"hash/fnv"
 	"io"
+	"io/fs"
 	"io/ioutil"
+	"net"
 	"os"
+	"path"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/iotest"
 	"time"
 
 	. "github.com/otiai10/mint"
+	"golang.org/x/text/unicode/norm"
 )
 
 //go:embed test/data/case18/assets
@@ -200,6 +215,34 @@ func TestOptions_OnSymlink(t *testing.T) {
 	Expect(t, info.Mode()&os.ModeSymlink).Not().ToBe(os.FileMode(0))
 }
 
+func TestOptions_OnSymlinkEx(t *testing.T) {
+	src := t.TempDir()
+	Expect(t, os.Mkdir(filepath.Join(src, "dir"), 0o755)).ToBe(nil)
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "dir", "file"), []byte("file"), 0o644)).ToBe(nil)
+	Expect(t, os.Symlink("dir", filepath.Join(src, "inside"))).ToBe(nil)
+	outside := t.TempDir()
+	Expect(t, os.Symlink(outside, filepath.Join(src, "outside"))).ToBe(nil)
+	Expect(t, os.Symlink("nowhere", filepath.Join(src, "dangling"))).ToBe(nil)
+
+	infos := map[string]os.FileInfo{}
+	dest := t.TempDir()
+	err := Copy(src, dest, Options{OnSymlinkEx: func(src, target string, info os.FileInfo) SymlinkAction {
+		infos[filepath.Base(src)] = info
+		if filepath.IsAbs(target) {
+			return Skip
+		}
+		return Shallow
+	}})
+	Expect(t, err).ToBe(nil)
+	Expect(t, infos["inside"].IsDir()).ToBe(true)
+	Expect(t, infos["outside"].IsDir()).ToBe(true)
+	Expect(t, infos["dangling"]).ToBe(nil)
+	_, err = os.Lstat(filepath.Join(dest, "inside"))
+	Expect(t, err).ToBe(nil)
+	_, err = os.Lstat(filepath.Join(dest, "outside"))
+	Expect(t, os.IsNotExist(err)).ToBe(true)
+}
+
 func TestOptions_Skip(t *testing.T) {
 	opt := Options{Skip: func(info os.FileInfo, src, dest string) (bool, error) {
 		switch {
@@ -489,3 +532,3090 @@ func TestOptions_PreferConcurrent(t *testing.T) {
 	err := Copy("test/data/case19", "test/data.copy/case19_preferconcurrent", opt)
 	Expect(t, err).ToBe(nil)
 }
+
+func TestOptions_FollowDirSymlinks(t *testing.T) {
+	src := t.TempDir()
+	Expect(t, os.Mkdir(filepath.Join(src, "dir"), 0o755)).ToBe(nil)
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "dir", "README.md"), []byte("dir"), 0o644)).ToBe(nil)
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "file"), []byte("file"), 0o644)).ToBe(nil)
+	Expect(t, os.Symlink("dir", filepath.Join(src, "dirlink"))).ToBe(nil)
+	Expect(t, os.Symlink("file", filepath.Join(src, "filelink"))).ToBe(nil)
+
+	dest := filepath.Join(t.TempDir(), "dest")
+	err := Copy(src, dest, Options{FollowDirSymlinks: true})
+	Expect(t, err).ToBe(nil)
+
+	info, err := os.Lstat(filepath.Join(dest, "dirlink"))
+	Expect(t, err).ToBe(nil)
+	Expect(t, info.IsDir()).ToBe(true)
+	b, err := ioutil.ReadFile(filepath.Join(dest, "dirlink", "README.md"))
+	Expect(t, err).ToBe(nil)
+	Expect(t, string(b)).ToBe("dir")
+
+	info, err = os.Lstat(filepath.Join(dest, "filelink"))
+	Expect(t, err).ToBe(nil)
+	Expect(t, info.Mode()&os.ModeSymlink).Not().ToBe(os.FileMode(0))
+
+	When(t, "directory symlinks make a loop", func(t *testing.T) {
+		Expect(t, os.Symlink("..", filepath.Join(src, "dir", "parent"))).ToBe(nil)
+		err := Copy(src, filepath.Join(t.TempDir(), "dest"), Options{FollowDirSymlinks: true})
+		Expect(t, errors.Is(err, ErrSymlinkLoop)).ToBe(true)
+	})
+
+	When(t, "NumOfWorkers is more than 1", func(t *testing.T) {
+		src := t.TempDir()
+		Expect(t, os.Mkdir(filepath.Join(src, "dir"), 0o755)).ToBe(nil)
+		for i := 0; i < 4; i++ {
+			Expect(t, ioutil.WriteFile(filepath.Join(src, "dir", fmt.Sprintf("file%d", i)), []byte("dir"), 0o644)).ToBe(nil)
+			Expect(t, os.Symlink("dir", filepath.Join(src, fmt.Sprintf("link%d", i)))).ToBe(nil)
+		}
+		dest := filepath.Join(t.TempDir(), "dest")
+		done, cancel := CopyAsync(src, dest, Options{FollowDirSymlinks: true, NumOfWorkers: 2})
+		defer cancel()
+		select {
+		case err := <-done:
+			Expect(t, err).ToBe(nil)
+		case <-time.After(10 * time.Second):
+			t.Fatal("copy didn't finish")
+		}
+		for i := 0; i < 4; i++ {
+			b, err := ioutil.ReadFile(filepath.Join(dest, fmt.Sprintf("link%d", i), "file3"))
+			Expect(t, err).ToBe(nil)
+			Expect(t, string(b)).ToBe("dir")
+		}
+	})
+}
+
+func TestOptions_SkipSymlinkLoops(t *testing.T) {
+	src := t.TempDir()
+	Expect(t, os.Mkdir(filepath.Join(src, "dir"), 0o755)).ToBe(nil)
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "dir", "file"), []byte("file"), 0o644)).ToBe(nil)
+	Expect(t, os.Symlink(src, filepath.Join(src, "dir", "root"))).ToBe(nil)
+	Expect(t, os.Symlink(filepath.Join(src, "y"), filepath.Join(src, "x"))).ToBe(nil)
+	Expect(t, os.Symlink(filepath.Join(src, "x"), filepath.Join(src, "y"))).ToBe(nil)
+	deep := func(string) SymlinkAction { return Deep }
+
+	err := Copy(filepath.Join(src, "dir"), t.TempDir(), Options{OnSymlink: deep})
+	Expect(t, errors.Is(err, ErrSymlinkLoop)).ToBe(true)
+
+	err = Copy(src, t.TempDir(), Options{OnSymlink: deep, Skip: func(info os.FileInfo, src, dest string) (bool, error) {
+		return info.Name() == "dir", nil
+	}})
+	Expect(t, errors.Is(err, ErrSymlinkLoop)).ToBe(true)
+
+	When(t, "SkipSymlinkLoops is set", func(t *testing.T) {
+		dest := t.TempDir()
+		report, err := CopyWithReport(src, dest, Options{OnSymlink: deep, SkipSymlinkLoops: true})
+		Expect(t, err).ToBe(nil)
+		b, err := ioutil.ReadFile(filepath.Join(dest, "dir", "file"))
+		Expect(t, err).ToBe(nil)
+		Expect(t, string(b)).ToBe("file")
+		_, err = os.Lstat(filepath.Join(dest, "dir", "root"))
+		Expect(t, os.IsNotExist(err)).ToBe(true)
+		Expect(t, report.Skipped).ToBe([]string{
+			filepath.Join(src, "dir", "root"),
+			filepath.Join(src, "x"),
+			filepath.Join(src, "y"),
+		})
+	})
+}
+
+func TestOptions_OnErrorAction(t *testing.T) {
+	errFlaky := errors.New("flaky")
+	flaky := func(failures int) func(io.Reader) io.Reader {
+		return func(src io.Reader) io.Reader {
+			if failures > 0 {
+				failures--
+				return &ErrorReader{errFlaky}
+			}
+			return src
+		}
+	}
+
+	When(t, "OnErrorAction returns Retry", func(t *testing.T) {
+		count := 0
+		opt := Options{
+			WrapReader: flaky(2),
+			OnErrorAction: func(src, dest string, err error) ErrorAction {
+				count++
+				return Retry
+			},
+		}
+		err := Copy("test/data/case17", "test/data.copy/case17.retry", opt)
+		Expect(t, err).ToBe(nil)
+		Expect(t, count).ToBe(2)
+		content, err := ioutil.ReadFile("test/data.copy/case17.retry/README.md")
+		Expect(t, err).ToBe(nil)
+		Expect(t, len(content)).Not().ToBe(0)
+	})
+
+	When(t, "retries are exhausted", func(t *testing.T) {
+		opt := Options{
+			WrapReader:    flaky(10),
+			OnErrorAction: func(src, dest string, err error) ErrorAction { return Retry },
+			OnError:       func(src, dest string, err error) error { return nil },
+		}
+		err := Copy("test/data/case17/README.md", "test/data.copy/case17.exhausted/README.md", opt)
+		Expect(t, err).ToBe(errFlaky)
+	})
+
+	When(t, "OnErrorAction returns Ignore", func(t *testing.T) {
+		opt := Options{
+			WrapReader:    flaky(1),
+			OnErrorAction: func(src, dest string, err error) ErrorAction { return Ignore },
+		}
+		err := Copy("test/data/case17/README.md", "test/data.copy/case17.ignore/README.md", opt)
+		Expect(t, err).ToBe(nil)
+	})
+
+	When(t, "OnErrorAction returns Abort", func(t *testing.T) {
+		opt := Options{
+			WrapReader:    flaky(1),
+			OnErrorAction: func(src, dest string, err error) ErrorAction { return Abort },
+		}
+		err := Copy("test/data/case17/README.md", "test/data.copy/case17.abort/README.md", opt)
+		Expect(t, err).ToBe(errFlaky)
+	})
+}
+
+type ErrorReader struct {
+	err error
+}
+
+func (r *ErrorReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
+
+func TestOptions_StripPrefix(t *testing.T) {
+	dest := t.TempDir()
+	err := Copy("test/data/case01", dest, Options{StripPrefix: "test"})
+	Expect(t, err).ToBe(nil)
+	b, err := ioutil.ReadFile(filepath.Join(dest, "data", "case01", "README.md"))
+	Expect(t, err).ToBe(nil)
+	Expect(t, string(b)).ToBe("case01 - README.md")
+
+	When(t, "src is not under the prefix", func(t *testing.T) {
+		err := Copy("test/data/case01", t.TempDir(), Options{StripPrefix: "test/data/case02"})
+		Expect(t, errors.Is(err, ErrPrefixMismatch)).ToBe(true)
+	})
+}
+
+func TestOptions_ForwardSlashPaths(t *testing.T) {
+	dests := []string{}
+	opt := Options{
+		ForwardSlashPaths: true,
+		Skip: func(info os.FileInfo, src, dest string) (bool, error) {
+			dests = append(dests, dest)
+			return false, nil
+		},
+	}
+	err := Copy("test/data/case06", "test/data.copy/case06.forwardslash", opt)
+	Expect(t, err).ToBe(nil)
+	Expect(t, len(dests)).Not().ToBe(0)
+	for _, dest := range dests {
+		Expect(t, strings.Contains(dest, "\\")).ToBe(false)
+		Expect(t, strings.HasPrefix(dest, "test/data.copy/case06.forwardslash/")).ToBe(true)
+	}
+}
+
+func TestOptions_BytesWritten(t *testing.T) {
+	var written int64
+	err := Copy("test/data/case19", "test/data.copy/case19.byteswritten", Options{BytesWritten: &written, NumOfWorkers: 4})
+	Expect(t, err).ToBe(nil)
+
+	var size int64
+	filepath.Walk("test/data/case19", func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return err
+	})
+	Expect(t, written).ToBe(size)
+}
+
+func TestOptions_NumOfWorkers_WideTree(t *testing.T) {
+	src := t.TempDir()
+	for i := 0; i < 64; i++ {
+		dir := filepath.Join(src, fmt.Sprintf("dir%02d", i))
+		Expect(t, os.Mkdir(dir, 0o755)).ToBe(nil)
+		for j := 0; j < 16; j++ {
+			Expect(t, ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("file%02d", j)), []byte("wide"), 0o644)).ToBe(nil)
+		}
+	}
+	for i := 0; i < 8; i++ {
+		dest := filepath.Join(t.TempDir(), "nested", "dest")
+		err := Copy(src, dest, Options{NumOfWorkers: 32})
+		Expect(t, err).ToBe(nil)
+		entries, err := ioutil.ReadDir(filepath.Join(dest, "dir63"))
+		Expect(t, err).ToBe(nil)
+		Expect(t, len(entries)).ToBe(16)
+	}
+}
+
+func TestOptions_NumOfWorkers_FlatTree(t *testing.T) {
+	src := t.TempDir()
+	for i := 0; i < 500; i++ {
+		Expect(t, ioutil.WriteFile(filepath.Join(src, fmt.Sprintf("file%03d", i)), []byte("flat"), 0o644)).ToBe(nil)
+	}
+	base := runtime.NumGoroutine()
+	var peak int64
+	watch := func(r io.Reader) io.Reader {
+		for {
+			n, p := int64(runtime.NumGoroutine()), atomic.LoadInt64(&peak)
+			if n <= p || atomic.CompareAndSwapInt64(&peak, p, n) {
+				break
+			}
+		}
+		return r
+	}
+	err := Copy(src, t.TempDir(), Options{NumOfWorkers: 4, WrapReader: watch})
+	Expect(t, err).ToBe(nil)
+	// Goroutines for files are started only as many as the workers.
+	Expect(t, peak-int64(base) <= 4+2).ToBe(true)
+}
+
+func TestOptions_RateLimitFunc(t *testing.T) {
+	src := t.TempDir()
+	for _, dir := range []string{"slow", "fast"} {
+		Expect(t, os.MkdirAll(filepath.Join(src, dir, "sub"), 0o755)).ToBe(nil)
+		Expect(t, ioutil.WriteFile(filepath.Join(src, dir, "sub", "file"), make([]byte, 32*1024), 0o644)).ToBe(nil)
+	}
+	opt := Options{RateLimitFunc: func(srcdir string) int64 {
+		if filepath.Base(srcdir) == "slow" {
+			return 64 * 1024 // 64KB per second
+		}
+		return 0
+	}}
+
+	start := time.Now()
+	err := Copy(filepath.Join(src, "slow"), filepath.Join(t.TempDir(), "slow"), opt)
+	Expect(t, err).ToBe(nil)
+	slow := time.Since(start)
+
+	start = time.Now()
+	err = Copy(filepath.Join(src, "fast"), filepath.Join(t.TempDir(), "fast"), opt)
+	Expect(t, err).ToBe(nil)
+	fast := time.Since(start)
+
+	Expect(t, slow >= 400*time.Millisecond).ToBe(true)
+	Expect(t, slow > fast).ToBe(true)
+}
+
+func TestOptions_BandwidthLimit(t *testing.T) {
+	src := t.TempDir()
+	for _, name := range []string{"a", "b"} {
+		Expect(t, ioutil.WriteFile(filepath.Join(src, name), make([]byte, 32*1024), 0o644)).ToBe(nil)
+	}
+
+	// 64KB in total at 128KB per second, even by 2 workers.
+	start := time.Now()
+	err := Copy(src, t.TempDir(), Options{BandwidthLimit: 128 * 1024, NumOfWorkers: 2})
+	Expect(t, err).ToBe(nil)
+	global := time.Since(start)
+	Expect(t, global >= 400*time.Millisecond).ToBe(true)
+
+	When(t, "FileBandwidthLimit is given", func(t *testing.T) {
+		// 32KB at 128KB per second for each file, by 2 workers at once.
+		start := time.Now()
+		err := Copy(src, t.TempDir(), Options{FileBandwidthLimit: 128 * 1024, NumOfWorkers: 2})
+		Expect(t, err).ToBe(nil)
+		each := time.Since(start)
+		Expect(t, each >= 200*time.Millisecond).ToBe(true)
+		Expect(t, each < global).ToBe(true)
+	})
+}
+
+func TestOptions_SkipIfContentEqual(t *testing.T) {
+	dest := t.TempDir()
+	Expect(t, ioutil.WriteFile(filepath.Join(dest, "same"), []byte("case01 - README.md"), 0o644)).ToBe(nil)
+	Expect(t, ioutil.WriteFile(filepath.Join(dest, "diff"), []byte("case01 - readme.md"), 0o644)).ToBe(nil)
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	Expect(t, os.Chtimes(filepath.Join(dest, "same"), past, past)).ToBe(nil)
+	Expect(t, os.Chtimes(filepath.Join(dest, "diff"), past, past)).ToBe(nil)
+
+	opt := Options{SkipIfContentEqual: true}
+	for _, name := range []string{"same", "diff"} {
+		err := Copy("test/data/case01/README.md", filepath.Join(dest, name), opt)
+		Expect(t, err).ToBe(nil)
+		b, err := ioutil.ReadFile(filepath.Join(dest, name))
+		Expect(t, err).ToBe(nil)
+		Expect(t, string(b)).ToBe("case01 - README.md")
+	}
+
+	info, err := os.Stat(filepath.Join(dest, "same"))
+	Expect(t, err).ToBe(nil)
+	Expect(t, info.ModTime().Equal(past)).ToBe(true)
+	info, err = os.Stat(filepath.Join(dest, "diff"))
+	Expect(t, err).ToBe(nil)
+	Expect(t, info.ModTime().Equal(past)).ToBe(false)
+}
+
+func TestOptions_SymlinkFiles(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), "case06")
+	err := Copy("test/data/case06", dest, Options{SymlinkFiles: true})
+	Expect(t, err).ToBe(nil)
+	info, err := os.Lstat(filepath.Join(dest, "repo"))
+	Expect(t, err).ToBe(nil)
+	Expect(t, info.IsDir()).ToBe(true)
+	target, err := os.Readlink(filepath.Join(dest, "repo", "README.md"))
+	Expect(t, err).ToBe(nil)
+	Expect(t, filepath.IsAbs(target)).ToBe(true)
+	b, err := ioutil.ReadFile(filepath.Join(dest, "repo", "README.md"))
+	Expect(t, err).ToBe(nil)
+	orig, err := ioutil.ReadFile("test/data/case06/repo/README.md")
+	Expect(t, err).ToBe(nil)
+	Expect(t, string(b)).ToBe(string(orig))
+
+	When(t, "RelativeSymlinkTargets is true", func(t *testing.T) {
+		dest := "test/data.copy/case06.relative-symlinks"
+		err := Copy("test/data/case06", dest, Options{SymlinkFiles: true, RelativeSymlinkTargets: true})
+		Expect(t, err).ToBe(nil)
+		target, err := os.Readlink(filepath.Join(dest, "repo", "README.md"))
+		Expect(t, err).ToBe(nil)
+		Expect(t, target).ToBe(filepath.Join("..", "..", "..", "data", "case06", "repo", "README.md"))
+		b, err := ioutil.ReadFile(filepath.Join(dest, "repo", "README.md"))
+		Expect(t, err).ToBe(nil)
+		Expect(t, string(b)).ToBe(string(orig))
+	})
+}
+
+func TestOptions_OnEmptyFile(t *testing.T) {
+	src := t.TempDir()
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "empty"), nil, 0o644)).ToBe(nil)
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "full"), []byte("full"), 0o644)).ToBe(nil)
+
+	When(t, "OnEmptyFile returns CopyEmpty", func(t *testing.T) {
+		dest := t.TempDir()
+		err := Copy(src, dest, Options{OnEmptyFile: func(src, dest string) EmptyFileAction { return CopyEmpty }})
+		Expect(t, err).ToBe(nil)
+		info, err := os.Stat(filepath.Join(dest, "empty"))
+		Expect(t, err).ToBe(nil)
+		Expect(t, info.Size()).ToBe(int64(0))
+	})
+
+	When(t, "OnEmptyFile returns SkipEmpty", func(t *testing.T) {
+		dest := t.TempDir()
+		err := Copy(src, dest, Options{OnEmptyFile: func(src, dest string) EmptyFileAction { return SkipEmpty }})
+		Expect(t, err).ToBe(nil)
+		_, err = os.Stat(filepath.Join(dest, "empty"))
+		Expect(t, os.IsNotExist(err)).ToBe(true)
+		_, err = os.Stat(filepath.Join(dest, "full"))
+		Expect(t, err).ToBe(nil)
+	})
+
+	When(t, "OnEmptyFile returns ErrorEmpty", func(t *testing.T) {
+		err := Copy(src, t.TempDir(), Options{OnEmptyFile: func(src, dest string) EmptyFileAction { return ErrorEmpty }})
+		Expect(t, errors.Is(err, ErrEmptyFile)).ToBe(true)
+	})
+}
+
+func TestOptions_OnFileExists(t *testing.T) {
+	src := t.TempDir()
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "file.txt"), []byte("new"), 0o644)).ToBe(nil)
+	prepare := func(t *testing.T, mtime time.Time) string {
+		dest := t.TempDir()
+		Expect(t, ioutil.WriteFile(filepath.Join(dest, "file.txt"), []byte("old"), 0o644)).ToBe(nil)
+		Expect(t, os.Chtimes(filepath.Join(dest, "file.txt"), mtime, mtime)).ToBe(nil)
+		return dest
+	}
+	content := func(t *testing.T, path string) string {
+		b, err := ioutil.ReadFile(path)
+		Expect(t, err).ToBe(nil)
+		return string(b)
+	}
+	past, future := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+
+	When(t, "OnFileExists returns Overwrite", func(t *testing.T) {
+		dest := prepare(t, past)
+		err := Copy(src, dest, Options{OnFileExists: func(src, dest string) FileExistsAction { return Overwrite }})
+		Expect(t, err).ToBe(nil)
+		Expect(t, content(t, filepath.Join(dest, "file.txt"))).ToBe("new")
+	})
+
+	When(t, "OnFileExists returns SkipExisting", func(t *testing.T) {
+		dest := prepare(t, past)
+		err := Copy(src, dest, Options{OnFileExists: func(src, dest string) FileExistsAction { return SkipExisting }})
+		Expect(t, err).ToBe(nil)
+		Expect(t, content(t, filepath.Join(dest, "file.txt"))).ToBe("old")
+	})
+
+	When(t, "OnFileExists returns ErrorExisting", func(t *testing.T) {
+		dest := prepare(t, past)
+		err := Copy(src, dest, Options{OnFileExists: func(src, dest string) FileExistsAction { return ErrorExisting }})
+		Expect(t, os.IsExist(err)).ToBe(true)
+		Expect(t, content(t, filepath.Join(dest, "file.txt"))).ToBe("old")
+	})
+
+	When(t, "OnFileExists returns RenameWithSuffix", func(t *testing.T) {
+		dest := prepare(t, past)
+		err := Copy(src, dest, Options{OnFileExists: func(src, dest string) FileExistsAction { return RenameWithSuffix }})
+		Expect(t, err).ToBe(nil)
+		Expect(t, content(t, filepath.Join(dest, "file.txt"))).ToBe("old")
+		Expect(t, content(t, filepath.Join(dest, "file (1).txt"))).ToBe("new")
+	})
+
+	When(t, "OnFileExists returns OverwriteIfNewer", func(t *testing.T) {
+		onFileExists := func(src, dest string) FileExistsAction { return OverwriteIfNewer }
+		dest := prepare(t, past)
+		Expect(t, Copy(src, dest, Options{OnFileExists: onFileExists})).ToBe(nil)
+		Expect(t, content(t, filepath.Join(dest, "file.txt"))).ToBe("new")
+		dest = prepare(t, future)
+		Expect(t, Copy(src, dest, Options{OnFileExists: onFileExists})).ToBe(nil)
+		Expect(t, content(t, filepath.Join(dest, "file.txt"))).ToBe("old")
+	})
+
+	When(t, "SkipUnchanged skips the file first", func(t *testing.T) {
+		dest := t.TempDir()
+		Expect(t, Copy(src, dest, Options{PreserveTimes: true})).ToBe(nil)
+		opt := Options{SkipUnchanged: true, OnFileExists: func(src, dest string) FileExistsAction { return ErrorExisting }}
+		ops, err := Plan(src, dest, opt)
+		Expect(t, err).ToBe(nil)
+		Expect(t, ops[len(ops)-1].Kind).ToBe(PlanSkip)
+		Expect(t, Copy(src, dest, opt)).ToBe(nil)
+	})
+
+	When(t, "AlwaysApplyPermissions is given to skipped files", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("file modes are not fully supported on Windows")
+		}
+		Expect(t, os.Chmod(filepath.Join(src, "file.txt"), 0o644)).ToBe(nil)
+		for _, action := range []FileExistsAction{SkipExisting, OverwriteIfNewer} {
+			dest := prepare(t, future)
+			Expect(t, os.Chmod(filepath.Join(dest, "file.txt"), 0o600)).ToBe(nil)
+			err := Copy(src, dest, Options{
+				OnFileExists:           func(src, dest string) FileExistsAction { return action },
+				AlwaysApplyPermissions: true,
+			})
+			Expect(t, err).ToBe(nil)
+			Expect(t, content(t, filepath.Join(dest, "file.txt"))).ToBe("old")
+			info, err := os.Stat(filepath.Join(dest, "file.txt"))
+			Expect(t, err).ToBe(nil)
+			Expect(t, info.Mode().Perm()).ToBe(os.FileMode(0o644))
+		}
+	})
+
+	When(t, "Atomic or VerifyAndRollback is given", func(t *testing.T) {
+		for _, opt := range []Options{{Atomic: true}, {VerifyAndRollback: true}} {
+			asked := []string{}
+			opt.OnFileExists = func(src, dest string) FileExistsAction {
+				asked = append(asked, filepath.Base(dest))
+				return SkipExisting
+			}
+			dest := t.TempDir()
+			Expect(t, Copy(src, dest, opt)).ToBe(nil)
+			Expect(t, content(t, filepath.Join(dest, "file.txt"))).ToBe("new")
+			Expect(t, len(asked)).ToBe(0)
+			dest = prepare(t, past)
+			Expect(t, Copy(src, dest, opt)).ToBe(nil)
+			Expect(t, content(t, filepath.Join(dest, "file.txt"))).ToBe("old")
+			Expect(t, asked).ToBe([]string{"file.txt"})
+		}
+	})
+
+	When(t, "DestFS is given", func(t *testing.T) {
+		err := Copy(src, "dest", Options{DestFS: NewMemFS(), OnFileExists: func(src, dest string) FileExistsAction { return SkipExisting }})
+		Expect(t, errors.Is(err, ErrConflictingOptions)).ToBe(true)
+	})
+}
+
+func TestOptions_MaxConcurrentDirs(t *testing.T) {
+	src := t.TempDir()
+	var mkdirs func(dir string, depth int)
+	mkdirs = func(dir string, depth int) {
+		Expect(t, ioutil.WriteFile(filepath.Join(dir, "file"), []byte(dir), 0o644)).ToBe(nil)
+		if depth == 0 {
+			return
+		}
+		for i := 0; i < 4; i++ {
+			sub := filepath.Join(dir, fmt.Sprintf("dir%d", i))
+			Expect(t, os.Mkdir(sub, 0o755)).ToBe(nil)
+			mkdirs(sub, depth-1)
+		}
+	}
+	mkdirs(src, 5)
+
+	var mu sync.Mutex
+	max := 0
+	opt := Options{
+		NumOfWorkers:      4,
+		MaxConcurrentDirs: 2,
+		Skip: func(info os.FileInfo, src, dest string) (bool, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if n := runtime.NumGoroutine(); n > max {
+				max = n
+			}
+			return false, nil
+		},
+	}
+	dest := filepath.Join(t.TempDir(), "dest")
+	err := Copy(src, dest, opt)
+	Expect(t, err).ToBe(nil)
+	Expect(t, max < 64).ToBe(true)
+	b, err := ioutil.ReadFile(filepath.Join(dest, "dir3", "dir3", "dir3", "dir3", "dir3", "file"))
+	Expect(t, err).ToBe(nil)
+	Expect(t, string(b)).ToBe(filepath.Join(src, "dir3", "dir3", "dir3", "dir3", "dir3"))
+}
+
+func TestOptions_LineTransform(t *testing.T) {
+	src := t.TempDir()
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "config.txt"), []byte("host={{HOST}}\nport=80\nname={{HOST}}"), 0o644)).ToBe(nil)
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "binary.bin"), []byte("{{HOST}}\x00\n{{HOST}}"), 0o644)).ToBe(nil)
+	long := strings.Repeat("{{HOST}}", 16*1024) + "\n"
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "long.txt"), []byte(long), 0o644)).ToBe(nil)
+	late := "{{HOST}}\n" + strings.Repeat("a", 6000) + "\x00"
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "late.bin"), []byte(late), 0o644)).ToBe(nil)
+
+	replace := func(src string, line []byte) []byte {
+		return bytes.ReplaceAll(line, []byte("{{HOST}}"), []byte("example.com"))
+	}
+	dest := t.TempDir()
+	err := Copy(src, dest, Options{LineTransform: replace})
+	Expect(t, err).ToBe(nil)
+
+	b, err := ioutil.ReadFile(filepath.Join(dest, "config.txt"))
+	Expect(t, err).ToBe(nil)
+	Expect(t, string(b)).ToBe("host=example.com\nport=80\nname=example.com")
+	b, err = ioutil.ReadFile(filepath.Join(dest, "binary.bin"))
+	Expect(t, err).ToBe(nil)
+	Expect(t, string(b)).ToBe("{{HOST}}\x00\n{{HOST}}")
+	b, err = ioutil.ReadFile(filepath.Join(dest, "long.txt"))
+	Expect(t, err).ToBe(nil)
+	Expect(t, string(b)).ToBe(strings.Repeat("example.com", 16*1024) + "\n")
+	b, err = ioutil.ReadFile(filepath.Join(dest, "late.bin"))
+	Expect(t, err).ToBe(nil)
+	Expect(t, string(b)).ToBe(late)
+
+	When(t, "TextFile is given", func(t *testing.T) {
+		dest := t.TempDir()
+		err := Copy(src, dest, Options{
+			LineTransform: replace,
+			TextFile:      func(src string) bool { return strings.HasSuffix(src, ".bin") },
+		})
+		Expect(t, err).ToBe(nil)
+		b, err := ioutil.ReadFile(filepath.Join(dest, "config.txt"))
+		Expect(t, err).ToBe(nil)
+		Expect(t, string(b)).ToBe("host={{HOST}}\nport=80\nname={{HOST}}")
+		b, err = ioutil.ReadFile(filepath.Join(dest, "binary.bin"))
+		Expect(t, err).ToBe(nil)
+		Expect(t, string(b)).ToBe("example.com\x00\nexample.com")
+	})
+}
+
+func TestEstimate(t *testing.T) {
+	opt := Options{Skip: func(info os.FileInfo, src, dest string) (bool, error) {
+		return strings.HasSuffix(src, "_skip") || strings.HasSuffix(src, ".gitfake"), nil
+	}}
+	result, err := Estimate("test/data/case06", opt)
+	Expect(t, err).ToBe(nil)
+	Expect(t, result).ToBe(EstimateResult{Bytes: 91 + 152, Files: 2, Dirs: 2})
+
+	result, err = Estimate("test/data/case03")
+	Expect(t, err).ToBe(nil)
+	Expect(t, result.Symlinks).ToBe(int64(1))
+
+	result, err = Estimate("test/data/case03", Options{OnSymlink: func(string) SymlinkAction { return Skip }})
+	Expect(t, err).ToBe(nil)
+	Expect(t, result.Symlinks).ToBe(int64(0))
+
+	When(t, "FS is given", func(t *testing.T) {
+		result, err := Estimate("test/data/case18/assets", Options{FS: assets})
+		Expect(t, err).ToBe(nil)
+		Expect(t, result).ToBe(EstimateResult{Bytes: 7, Files: 1, Dirs: 1})
+	})
+
+	When(t, "entries are dropped by ignore files, markers and KeepNewestPerDir", func(t *testing.T) {
+		src := t.TempDir()
+		for i, name := range []string{
+			".copyignore", "a.log", "keep.txt", "marked/.nocopy", "marked/file",
+			"ignored/file", "many/1.txt", "many/2.txt", "many/3.txt",
+		} {
+			content := map[string]string{".copyignore": "*.log\n"}[name] + name
+			Expect(t, os.MkdirAll(filepath.Dir(filepath.Join(src, name)), 0o755)).ToBe(nil)
+			Expect(t, ioutil.WriteFile(filepath.Join(src, name), []byte(content), 0o644)).ToBe(nil)
+			mtime := time.Now().Add(time.Duration(i) * time.Hour)
+			Expect(t, os.Chtimes(filepath.Join(src, name), mtime, mtime)).ToBe(nil)
+		}
+		ignore := filepath.Join(t.TempDir(), "ignore")
+		Expect(t, ioutil.WriteFile(ignore, []byte("ignored/\n"), 0o644)).ToBe(nil)
+		opt := Options{IgnoreFile: ignore, IgnoreFileName: ".copyignore", SkipDirMarker: ".nocopy", KeepNewestPerDir: 2}
+
+		result, err := Estimate(src, opt)
+		Expect(t, err).ToBe(nil)
+		dest := filepath.Join(t.TempDir(), "dest")
+		Expect(t, Copy(src, dest, opt)).ToBe(nil)
+		copied := EstimateResult{}
+		err = filepath.Walk(dest, func(path string, info os.FileInfo, err error) error {
+			if info.IsDir() {
+				copied.Dirs++
+			} else {
+				copied.Files++
+				copied.Bytes += info.Size()
+			}
+			return err
+		})
+		Expect(t, err).ToBe(nil)
+		Expect(t, result).ToBe(copied)
+		Expect(t, result.Files).ToBe(int64(3))
+	})
+
+	When(t, "SymlinkFiles is true", func(t *testing.T) {
+		result, err := Estimate("test/data/case01", Options{SymlinkFiles: true})
+		Expect(t, err).ToBe(nil)
+		Expect(t, result).ToBe(EstimateResult{Dirs: 1, Symlinks: 1})
+	})
+
+	When(t, "specified src doesn't exist", func(t *testing.T) {
+		_, err := Estimate("NOT/EXISTING/SOURCE/PATH")
+		Expect(t, os.IsNotExist(err)).ToBe(true)
+	})
+}
+
+func TestCopyToTar(t *testing.T) {
+	src := t.TempDir()
+	Expect(t, os.Mkdir(filepath.Join(src, "dir"), 0o750)).ToBe(nil)
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "dir", "file"), []byte("hello"), 0o640)).ToBe(nil)
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "skipped"), []byte("skipped"), 0o644)).ToBe(nil)
+	Expect(t, os.Symlink("dir/file", filepath.Join(src, "link"))).ToBe(nil)
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	Expect(t, os.Chtimes(filepath.Join(src, "dir", "file"), mtime, mtime)).ToBe(nil)
+
+	buf := bytes.NewBuffer(nil)
+	err := CopyToTar(src, buf, Options{Skip: func(info os.FileInfo, src, dest string) (bool, error) {
+		return strings.HasSuffix(src, "skipped"), nil
+	}})
+	Expect(t, err).ToBe(nil)
+
+	headers := map[string]*tar.Header{}
+	contents := map[string]string{}
+	r := tar.NewReader(buf)
+	for {
+		hdr, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		Expect(t, err).ToBe(nil)
+		b, err := ioutil.ReadAll(r)
+		Expect(t, err).ToBe(nil)
+		headers[hdr.Name], contents[hdr.Name] = hdr, string(b)
+	}
+	Expect(t, len(headers)).ToBe(3)
+	Expect(t, headers["dir/"].FileInfo().Mode()).ToBe(os.ModeDir | 0o750)
+	Expect(t, headers["dir/file"].FileInfo().Mode()).ToBe(os.FileMode(0o640))
+	Expect(t, headers["dir/file"].ModTime.Equal(mtime)).ToBe(true)
+	Expect(t, contents["dir/file"]).ToBe("hello")
+	Expect(t, headers["link"].Typeflag).ToBe(byte(tar.TypeSymlink))
+	Expect(t, headers["link"].Linkname).ToBe("dir/file")
+
+	When(t, "src is a file", func(t *testing.T) {
+		buf := bytes.NewBuffer(nil)
+		Expect(t, CopyToTar(filepath.Join(src, "dir", "file"), buf)).ToBe(nil)
+		hdr, err := tar.NewReader(buf).Next()
+		Expect(t, err).ToBe(nil)
+		Expect(t, hdr.Name).ToBe("file")
+	})
+
+	When(t, "KeepNewestPerDir is given", func(t *testing.T) {
+		src := t.TempDir()
+		for i, name := range []string{"old", "new", "newest"} {
+			Expect(t, ioutil.WriteFile(filepath.Join(src, name), []byte(name), 0o644)).ToBe(nil)
+			mtime := time.Now().Add(time.Duration(i) * time.Hour)
+			Expect(t, os.Chtimes(filepath.Join(src, name), mtime, mtime)).ToBe(nil)
+		}
+		buf := bytes.NewBuffer(nil)
+		Expect(t, CopyToTar(src, buf, Options{KeepNewestPerDir: 2})).ToBe(nil)
+		names := []string{}
+		r := tar.NewReader(buf)
+		for hdr, err := r.Next(); err != io.EOF; hdr, err = r.Next() {
+			Expect(t, err).ToBe(nil)
+			names = append(names, hdr.Name)
+		}
+		Expect(t, names).ToBe([]string{"new", "newest"})
+	})
+
+	When(t, "LineTransform or SymlinkFiles is given", func(t *testing.T) {
+		err := CopyToTar(src, ioutil.Discard, Options{LineTransform: func(src string, line []byte) []byte { return line }})
+		Expect(t, errors.Is(err, ErrConflictingOptions)).ToBe(true)
+		err = CopyToTar(src, ioutil.Discard, Options{SymlinkFiles: true})
+		Expect(t, errors.Is(err, ErrConflictingOptions)).ToBe(true)
+	})
+}
+
+func TestCopyToZip(t *testing.T) {
+	src := t.TempDir()
+	Expect(t, os.Mkdir(filepath.Join(src, "dir"), 0o750)).ToBe(nil)
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "dir", "file"), []byte("hello"), 0o640)).ToBe(nil)
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "dir", "excluded.log"), []byte("excluded"), 0o644)).ToBe(nil)
+	Expect(t, os.Symlink("dir/file", filepath.Join(src, "link"))).ToBe(nil)
+	mtime := time.Date(2020, 1, 2, 3, 4, 6, 0, time.UTC)
+	Expect(t, os.Chtimes(filepath.Join(src, "dir", "file"), mtime, mtime)).ToBe(nil)
+
+	buf := bytes.NewBuffer(nil)
+	zw := zip.NewWriter(buf)
+	Expect(t, CopyToZip(src, zw, Options{Exclude: []string{"*.log"}})).ToBe(nil)
+	Expect(t, zw.Close()).ToBe(nil)
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	Expect(t, err).ToBe(nil)
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	Expect(t, len(files)).ToBe(3)
+	Expect(t, files["dir/"].Mode()).ToBe(os.ModeDir | 0o750)
+	Expect(t, files["dir/file"].Mode()).ToBe(os.FileMode(0o640))
+	Expect(t, files["dir/file"].Modified.Equal(mtime)).ToBe(true)
+	Expect(t, files["link"].Mode()&os.ModeSymlink != 0).ToBe(true)
+
+	When(t, "extracted by CopyFromArchive", func(t *testing.T) {
+		dest := filepath.Join(t.TempDir(), "dest")
+		Expect(t, CopyFromArchive(bytes.NewReader(buf.Bytes()), dest)).ToBe(nil)
+		b, err := ioutil.ReadFile(filepath.Join(dest, "link"))
+		Expect(t, err).ToBe(nil)
+		Expect(t, string(b)).ToBe("hello")
+	})
+}
+
+func TestCopyFromArchive(t *testing.T) {
+	src := t.TempDir()
+	Expect(t, os.Mkdir(filepath.Join(src, "dir"), 0o750)).ToBe(nil)
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "dir", "file"), []byte("hello"), 0o640)).ToBe(nil)
+	Expect(t, os.Symlink("dir/file", filepath.Join(src, "link"))).ToBe(nil)
+	buf := bytes.NewBuffer(nil)
+	Expect(t, CopyToTar(src, buf)).ToBe(nil)
+	archive := buf.Bytes()
+
+	dest := filepath.Join(t.TempDir(), "dest")
+	err := CopyFromArchive(bytes.NewReader(archive), dest)
+	Expect(t, err).ToBe(nil)
+	b, err := ioutil.ReadFile(filepath.Join(dest, "dir", "file"))
+	Expect(t, err).ToBe(nil)
+	Expect(t, string(b)).ToBe("hello")
+	info, err := os.Stat(filepath.Join(dest, "dir", "file"))
+	Expect(t, err).ToBe(nil)
+	Expect(t, info.Mode()).ToBe(os.FileMode(0o640))
+	info, err = os.Stat(filepath.Join(dest, "dir"))
+	Expect(t, err).ToBe(nil)
+	Expect(t, info.Mode()).ToBe(os.ModeDir | 0o750)
+	target, err := os.Readlink(filepath.Join(dest, "link"))
+	Expect(t, err).ToBe(nil)
+	Expect(t, target).ToBe("dir/file")
+
+	When(t, "r is not io.ReaderAt", func(t *testing.T) {
+		dest := filepath.Join(t.TempDir(), "dest")
+		err := CopyFromArchive(iotest.OneByteReader(bytes.NewReader(archive)), dest, Options{
+			Skip: func(info os.FileInfo, src, dest string) (bool, error) {
+				return info.Name() == "dir", nil
+			},
+		})
+		Expect(t, err).ToBe(nil)
+		_, err = os.Stat(filepath.Join(dest, "dir"))
+		Expect(t, os.IsNotExist(err)).ToBe(true)
+	})
+
+	When(t, "archive is zip", func(t *testing.T) {
+		buf := bytes.NewBuffer(nil)
+		zw := zip.NewWriter(buf)
+		w, err := zw.Create("dir/file")
+		Expect(t, err).ToBe(nil)
+		_, err = w.Write([]byte("zipped"))
+		Expect(t, err).ToBe(nil)
+		hdr := &zip.FileHeader{Name: "link"}
+		hdr.SetMode(os.ModeSymlink | 0o777)
+		w, err = zw.CreateHeader(hdr)
+		Expect(t, err).ToBe(nil)
+		_, err = w.Write([]byte("dir/file"))
+		Expect(t, err).ToBe(nil)
+		Expect(t, zw.Close()).ToBe(nil)
+
+		dest := filepath.Join(t.TempDir(), "dest")
+		Expect(t, CopyFromArchive(bytes.NewReader(buf.Bytes()), dest)).ToBe(nil)
+		b, err := ioutil.ReadFile(filepath.Join(dest, "dir", "file"))
+		Expect(t, err).ToBe(nil)
+		Expect(t, string(b)).ToBe("zipped")
+		target, err := os.Readlink(filepath.Join(dest, "link"))
+		Expect(t, err).ToBe(nil)
+		Expect(t, target).ToBe("dir/file")
+	})
+
+	tarOf := func(t *testing.T, headers ...*tar.Header) *bytes.Reader {
+		buf := bytes.NewBuffer(nil)
+		tw := tar.NewWriter(buf)
+		for _, hdr := range headers {
+			Expect(t, tw.WriteHeader(hdr)).ToBe(nil)
+		}
+		Expect(t, tw.Close()).ToBe(nil)
+		return bytes.NewReader(buf.Bytes())
+	}
+
+	When(t, "an entry is named outside dest", func(t *testing.T) {
+		dir := t.TempDir()
+		r := tarOf(t, &tar.Header{Name: "../escaped", Typeflag: tar.TypeReg, Mode: 0o644})
+		err := CopyFromArchive(r, filepath.Join(dir, "dest"))
+		Expect(t, errors.Is(err, ErrUnsafeArchivePath)).ToBe(true)
+		_, err = os.Stat(filepath.Join(dir, "escaped"))
+		Expect(t, os.IsNotExist(err)).ToBe(true)
+	})
+
+	When(t, "a symlink points outside the archive", func(t *testing.T) {
+		r := tarOf(t, &tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "../../etc", Mode: 0o777})
+		err := CopyFromArchive(r, filepath.Join(t.TempDir(), "dest"))
+		Expect(t, errors.Is(err, ErrUnsafeSymlinkTarget)).ToBe(true)
+	})
+
+	When(t, "a symlink goes outside the archive through another symlink", func(t *testing.T) {
+		for _, target := range []string{"s1/..", "s1/s1/../..", "missing/../../etc"} {
+			dest := filepath.Join(t.TempDir(), "dest")
+			r := tarOf(t,
+				&tar.Header{Name: "s1", Typeflag: tar.TypeSymlink, Linkname: ".", Mode: 0o777},
+				&tar.Header{Name: "x", Typeflag: tar.TypeSymlink, Linkname: target, Mode: 0o777},
+			)
+			err := CopyFromArchive(r, dest)
+			Expect(t, errors.Is(err, ErrUnsafeSymlinkTarget)).ToBe(true)
+			_, err = os.Lstat(filepath.Join(dest, "x"))
+			Expect(t, os.IsNotExist(err)).ToBe(true)
+		}
+	})
+
+	When(t, "a symlink points to an absolute path", func(t *testing.T) {
+		for _, target := range []string{"/etc/passwd", `C:\Windows`, `dir\..\..\etc`} {
+			dest := filepath.Join(t.TempDir(), "dest")
+			r := tarOf(t, &tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: target, Mode: 0o777})
+			err := CopyFromArchive(r, dest)
+			Expect(t, errors.Is(err, ErrUnsafeSymlinkTarget)).ToBe(true)
+			_, err = os.Lstat(filepath.Join(dest, "link"))
+			Expect(t, os.IsNotExist(err)).ToBe(true)
+		}
+	})
+
+	When(t, "an entry is under a symlink of the same archive", func(t *testing.T) {
+		dest := filepath.Join(t.TempDir(), "dest")
+		r := tarOf(t,
+			&tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: ".", Mode: 0o777},
+			&tar.Header{Name: "link/file", Typeflag: tar.TypeReg, Mode: 0o644},
+		)
+		Expect(t, CopyFromArchive(r, dest)).ToBe(nil)
+		info, err := os.Lstat(filepath.Join(dest, "link"))
+		Expect(t, err).ToBe(nil)
+		Expect(t, info.IsDir()).ToBe(true)
+	})
+
+	When(t, "FS is given", func(t *testing.T) {
+		err := CopyFromArchive(bytes.NewReader(archive), t.TempDir(), Options{FS: assets})
+		Expect(t, errors.Is(err, ErrConflictingOptions)).ToBe(true)
+	})
+}
+
+func TestMove(t *testing.T) {
+	src := t.TempDir()
+	Expect(t, os.Mkdir(filepath.Join(src, "dir"), 0o755)).ToBe(nil)
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "dir", "file"), []byte("moved"), 0o644)).ToBe(nil)
+	dest := filepath.Join(t.TempDir(), "dest")
+	Expect(t, Move(filepath.Join(src, "dir"), dest)).ToBe(nil)
+	b, err := ioutil.ReadFile(filepath.Join(dest, "file"))
+	Expect(t, err).ToBe(nil)
+	Expect(t, string(b)).ToBe("moved")
+	_, err = os.Stat(filepath.Join(src, "dir"))
+	Expect(t, os.IsNotExist(err)).ToBe(true)
+
+	When(t, "FS is given", func(t *testing.T) {
+		err := Move("test/data/case18/assets", t.TempDir(), Options{FS: assets})
+		Expect(t, errors.Is(err, ErrConflictingOptions)).ToBe(true)
+	})
+}
+
+func TestCopyAll(t *testing.T) {
+	dest := t.TempDir()
+	report, err := CopyAll(dest, []string{"test/data/case01", "test/data/case06", "test/data/case03/README.md"}, Options{NumOfWorkers: 4})
+	Expect(t, err).ToBe(nil)
+	for _, name := range []string{"case01/README.md", "case06/README.md", "case06/repo/README.md", "README.md"} {
+		_, err := os.Stat(filepath.Join(dest, name))
+		Expect(t, err).ToBe(nil)
+	}
+	Expect(t, report.Files > 3).ToBe(true)
+
+	When(t, "two sources are copied to the same dest", func(t *testing.T) {
+		dest := t.TempDir()
+		_, err := CopyAll(dest, []string{"test/data/case01/README.md", "test/data/case03/README.md"})
+		Expect(t, errors.Is(err, ErrDestCollision)).ToBe(true)
+		b, err := ioutil.ReadFile(filepath.Join(dest, "README.md"))
+		Expect(t, err).ToBe(nil)
+		Expect(t, string(b)).ToBe("case01 - README.md")
+	})
+
+	When(t, "directories are merged by TrailingSlashSemantics", func(t *testing.T) {
+		dest := t.TempDir()
+		report, err := CopyAll(dest, []string{"test/data/case01/", "test/data/case06/"}, Options{
+			TrailingSlashSemantics: true,
+			ErrorPolicy:            ContinueAndCollect,
+		})
+		Expect(t, errors.Is(err, ErrDestCollision)).ToBe(true)
+		Expect(t, len(report.Errors)).ToBe(1)
+		Expect(t, report.Errors[0].Src).ToBe("test/data/case06/README.md")
+		_, err = os.Stat(filepath.Join(dest, "repo", "README.md"))
+		Expect(t, err).ToBe(nil)
+	})
+
+	When(t, "symlinks are copied as what they point to", func(t *testing.T) {
+		src := t.TempDir()
+		Expect(t, ioutil.WriteFile(filepath.Join(src, "file"), []byte("file"), 0o644)).ToBe(nil)
+		Expect(t, os.Symlink(filepath.Join(src, "file"), filepath.Join(src, "link"))).ToBe(nil)
+		Expect(t, os.Symlink(filepath.Join(src, "link"), filepath.Join(src, "chain"))).ToBe(nil)
+		deep := func(string) SymlinkAction { return Deep }
+		for _, opt := range []Options{{OnSymlink: deep}, {OnSymlink: deep, CollapseSymlinkChains: true}} {
+			dest := t.TempDir()
+			_, err := CopyAll(dest, []string{src}, opt)
+			Expect(t, err).ToBe(nil)
+			b, err := ioutil.ReadFile(filepath.Join(dest, filepath.Base(src), "chain"))
+			Expect(t, err).ToBe(nil)
+			Expect(t, string(b)).ToBe("file")
+		}
+	})
+}
+
+func TestCopy_DestinationInsideSource(t *testing.T) {
+	src := t.TempDir()
+	Expect(t, os.Mkdir(filepath.Join(src, "dir"), 0o755)).ToBe(nil)
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "file"), []byte("file"), 0o644)).ToBe(nil)
+
+	err := Copy(src, filepath.Join(src, "dir", "dest"))
+	Expect(t, errors.Is(err, ErrDestinationInsideSource)).ToBe(true)
+	_, err = os.Stat(filepath.Join(src, "dir", "dest"))
+	Expect(t, os.IsNotExist(err)).ToBe(true)
+
+	err = Copy(src, src)
+	Expect(t, errors.Is(err, ErrDestinationInsideSource)).ToBe(true)
+
+	When(t, "dest is the same file as src", func(t *testing.T) {
+		err := Copy(filepath.Join(src, "file"), filepath.Join(src, "dir", "..", "file"))
+		Expect(t, errors.Is(err, ErrDestinationInsideSource)).ToBe(true)
+		b, err := ioutil.ReadFile(filepath.Join(src, "file"))
+		Expect(t, err).ToBe(nil)
+		Expect(t, string(b)).ToBe("file")
+	})
+
+	When(t, "dest is under src through a symlink", func(t *testing.T) {
+		link := filepath.Join(t.TempDir(), "link")
+		Expect(t, os.Symlink(src, link)).ToBe(nil)
+		err := Copy(src, filepath.Join(link, "dir", "dest"))
+		Expect(t, errors.Is(err, ErrDestinationInsideSource)).ToBe(true)
+	})
+}
+
+func TestCopy_MultiLevelDest(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), "a", "b", "c")
+	noop := func(srcinfo fileInfo, dest string) (func(*error), error) {
+		return func(*error) {}, nil
+	}
+	err := Copy("test/data/case06", dest, Options{PermissionControl: noop})
+	Expect(t, err).ToBe(nil)
+	_, err = os.Stat(filepath.Join(dest, "repo", "README.md"))
+	Expect(t, err).ToBe(nil)
+
+	When(t, "RequireDestRootParent is true", func(t *testing.T) {
+		err := Copy("test/data/case06", filepath.Join(t.TempDir(), "a", "b", "c"), Options{RequireDestRootParent: true})
+		Expect(t, os.IsNotExist(err)).ToBe(true)
+		err = Copy("test/data/case06", filepath.Join(t.TempDir(), "a"), Options{RequireDestRootParent: true})
+		Expect(t, err).ToBe(nil)
+
+		link := filepath.Join(t.TempDir(), "link")
+		Expect(t, os.Symlink("README.md", link)).ToBe(nil)
+		for _, src := range []string{"test/data/case06/README.md", link} {
+			dir := t.TempDir()
+			err := Copy(src, filepath.Join(dir, "a", "b"), Options{RequireDestRootParent: true})
+			Expect(t, os.IsNotExist(err)).ToBe(true)
+			_, err = os.Stat(filepath.Join(dir, "a"))
+			Expect(t, os.IsNotExist(err)).ToBe(true)
+		}
+	})
+}
+
+func TestSync(t *testing.T) {
+	src, dest := t.TempDir(), t.TempDir()
+	Expect(t, os.Mkdir(filepath.Join(src, "sub"), 0o755)).ToBe(nil)
+	for _, name := range []string{"a", "b", filepath.Join("sub", "c")} {
+		Expect(t, ioutil.WriteFile(filepath.Join(src, name), []byte(name), 0o644)).ToBe(nil)
+	}
+
+	report, err := Sync(src, dest)
+	Expect(t, err).ToBe(nil)
+	Expect(t, report.Copied).ToBe([]string{"a", "b", filepath.Join("sub", "c")})
+	Expect(t, len(report.Unchanged)).ToBe(0)
+	Expect(t, report.Bytes).ToBe(int64(1 + 1 + 5))
+
+	report, err = Sync(src, dest)
+	Expect(t, err).ToBe(nil)
+	Expect(t, len(report.Copied)).ToBe(0)
+	Expect(t, report.Unchanged).ToBe([]string{"a", "b", filepath.Join("sub", "c")})
+
+	When(t, "some files are changed and Mirror is true", func(t *testing.T) {
+		Expect(t, ioutil.WriteFile(filepath.Join(src, "a"), []byte("A!"), 0o644)).ToBe(nil)
+		Expect(t, ioutil.WriteFile(filepath.Join(src, "d"), []byte("d"), 0o644)).ToBe(nil)
+		Expect(t, ioutil.WriteFile(filepath.Join(dest, "sub", "extra"), []byte("extra"), 0o644)).ToBe(nil)
+		report, err := Sync(src, dest, Options{Mirror: true})
+		Expect(t, err).ToBe(nil)
+		Expect(t, report.Copied).ToBe([]string{"a", "d"})
+		Expect(t, report.Unchanged).ToBe([]string{"b", filepath.Join("sub", "c")})
+		Expect(t, report.Deleted).ToBe([]string{filepath.Join("sub", "extra")})
+		_, err = os.Stat(filepath.Join(dest, "sub", "extra"))
+		Expect(t, os.IsNotExist(err)).ToBe(true)
+	})
+
+	When(t, "mtime is changed but SkipIfContentEqual is true", func(t *testing.T) {
+		now := time.Now().Add(time.Hour)
+		Expect(t, os.Chtimes(filepath.Join(src, "b"), now, now)).ToBe(nil)
+		report, err := Sync(src, dest, Options{SkipIfContentEqual: true})
+		Expect(t, err).ToBe(nil)
+		Expect(t, len(report.Copied)).ToBe(0)
+	})
+
+	When(t, "some files fail to be copied", func(t *testing.T) {
+		Expect(t, ioutil.WriteFile(filepath.Join(src, "a"), []byte("AA!"), 0o644)).ToBe(nil)
+		report, err := Sync(src, dest, Options{
+			SkipIfContentEqual: true,
+			WrapReader:         func(src io.Reader) io.Reader { return &ErrorReader{errors.New("broken")} },
+			OnErrorAction:      func(src, dest string, err error) ErrorAction { return Ignore },
+		})
+		Expect(t, err).ToBe(nil)
+		Expect(t, report.Failed).ToBe([]string{"a"})
+	})
+}
+
+func TestOptions_PreCreateDest(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), "README.md")
+	var size int64 = -1
+	opt := Options{
+		PreCreateDest: true,
+		WrapReader: func(src io.Reader) io.Reader {
+			if info, err := os.Stat(dest); err == nil {
+				size = info.Size()
+			}
+			return src
+		},
+	}
+	err := Copy("test/data/case01/README.md", dest, opt)
+	Expect(t, err).ToBe(nil)
+	Expect(t, size).ToBe(int64(0))
+
+	When(t, "the copy fails", func(t *testing.T) {
+		dest := filepath.Join(t.TempDir(), "README.md")
+		err := Copy("test/data/case01/README.md", dest, Options{
+			PreCreateDest: true,
+			WrapReader:    func(src io.Reader) io.Reader { return &ErrorReader{errors.New("broken")} },
+		})
+		Expect(t, err).Not().ToBe(nil)
+		info, err := os.Stat(dest)
+		Expect(t, err).ToBe(nil)
+		Expect(t, info.Size()).ToBe(int64(0))
+	})
+
+	When(t, "Atomic or VerifyAndRollback is given", func(t *testing.T) {
+		for _, opt := range []Options{{PreCreateDest: true, Atomic: true}, {PreCreateDest: true, VerifyAndRollback: true}} {
+			dest := filepath.Join(t.TempDir(), "README.md")
+			err := Copy("test/data/case01/README.md", dest, opt)
+			Expect(t, errors.Is(err, ErrConflictingOptions)).ToBe(true)
+			_, err = os.Stat(dest)
+			Expect(t, os.IsNotExist(err)).ToBe(true)
+		}
+	})
+}
+
+func TestOptions_DedupeDestNames(t *testing.T) {
+	dest := t.TempDir()
+	for _, name := range []string{"README.md", ".hidden"} {
+		for i := 0; i < 3; i++ {
+			err := Copy("test/data/case01/README.md", filepath.Join(dest, name), Options{DedupeDestNames: true})
+			Expect(t, err).ToBe(nil)
+		}
+	}
+	for _, name := range []string{"README.md", "README (1).md", "README (2).md", ".hidden", ".hidden (1)", ".hidden (2)"} {
+		b, err := ioutil.ReadFile(filepath.Join(dest, name))
+		Expect(t, err).ToBe(nil)
+		Expect(t, string(b)).ToBe("case01 - README.md")
+	}
+
+	When(t, "DedupeFormat is given", func(t *testing.T) {
+		opt := Options{
+			DedupeDestNames: true,
+			DedupeFormat:    func(base string, n int) string { return fmt.Sprintf("%s_%03d", base, n) },
+		}
+		dest := t.TempDir()
+		Expect(t, Copy("test/data/case01", dest, opt)).ToBe(nil)
+		Expect(t, Copy("test/data/case01", dest, opt)).ToBe(nil)
+		_, err := os.Stat(filepath.Join(dest, "README_001.md"))
+		Expect(t, err).ToBe(nil)
+	})
+
+	When(t, "copying concurrently", func(t *testing.T) {
+		dest := filepath.Join(t.TempDir(), "README.md")
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				Copy("test/data/case01/README.md", dest, Options{DedupeDestNames: true})
+			}()
+		}
+		wg.Wait()
+		entries, err := ioutil.ReadDir(filepath.Dir(dest))
+		Expect(t, err).ToBe(nil)
+		Expect(t, len(entries)).ToBe(8)
+	})
+}
+
+func TestCopyAsync(t *testing.T) {
+	done, cancel := CopyAsync("test/data/case01", "test/data.copy/case01.async")
+	Expect(t, <-done).ToBe(nil)
+	cancel()
+	_, err := os.Stat("test/data.copy/case01.async/README.md")
+	Expect(t, err).ToBe(nil)
+
+	When(t, "cancel is called in the middle of a file", func(t *testing.T) {
+		started := make(chan struct{})
+		var once sync.Once
+		opt := Options{
+			CopyBufferSize: 1024,
+			WrapReader: func(src io.Reader) io.Reader {
+				once.Do(func() { close(started) })
+				return &SleepyReader{src, 1}
+			},
+		}
+		src := filepath.Join(t.TempDir(), "large")
+		Expect(t, ioutil.WriteFile(src, make([]byte, 1024*1024), 0o644)).ToBe(nil)
+		done, cancel := CopyAsync(src, filepath.Join(t.TempDir(), "large"), opt)
+		<-started
+		start := time.Now()
+		cancel()
+		Expect(t, errors.Is(<-done, context.Canceled)).ToBe(true)
+		Expect(t, time.Since(start) < 3*time.Second).ToBe(true)
+		_, ok := <-done
+		Expect(t, ok).ToBe(false)
+	})
+}
+
+func TestCopyWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dest := filepath.Join(t.TempDir(), "case01")
+	err := CopyWithContext(ctx, "test/data/case01", dest)
+	Expect(t, err).ToBe(nil)
+	_, err = os.Stat(filepath.Join(dest, "README.md"))
+	Expect(t, err).ToBe(nil)
+
+	When(t, "the context is already done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		dest := filepath.Join(t.TempDir(), "case01")
+		err := CopyWithContext(ctx, "test/data/case01", dest)
+		Expect(t, errors.Is(err, context.Canceled)).ToBe(true)
+		_, err = os.Stat(filepath.Join(dest, "README.md"))
+		Expect(t, os.IsNotExist(err)).ToBe(true)
+	})
+
+	When(t, "the context is done in the middle of a file", func(t *testing.T) {
+		src := filepath.Join(t.TempDir(), "large")
+		Expect(t, ioutil.WriteFile(src, make([]byte, 1024*1024), 0o644)).ToBe(nil)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		opt := Options{
+			CopyBufferSize: 1024,
+			WrapReader:     func(src io.Reader) io.Reader { return &SleepyReader{src, 1} },
+		}
+		start := time.Now()
+		err := CopyWithContext(ctx, src, filepath.Join(t.TempDir(), "large"), opt)
+		Expect(t, errors.Is(err, context.DeadlineExceeded)).ToBe(true)
+		Expect(t, time.Since(start) < 3*time.Second).ToBe(true)
+	})
+}
+
+func TestOptions_NormalizeUnicode(t *testing.T) {
+	src := t.TempDir()
+	nfd := "cafe\u0301.txt"
+	Expect(t, ioutil.WriteFile(filepath.Join(src, nfd), []byte("nfd"), 0o644)).ToBe(nil)
+
+	form := norm.NFC
+	dest := t.TempDir()
+	err := Copy(src, dest, Options{NormalizeUnicode: &form})
+	Expect(t, err).ToBe(nil)
+	entries, err := ioutil.ReadDir(dest)
+	Expect(t, err).ToBe(nil)
+	Expect(t, len(entries)).ToBe(1)
+	if runtime.GOOS != "darwin" { // APFS and HFS+ normalize names by themselves.
+		Expect(t, entries[0].Name()).ToBe("caf\u00e9.txt")
+	}
+
+	dest = t.TempDir()
+	err = Copy(src, dest)
+	Expect(t, err).ToBe(nil)
+	entries, err = ioutil.ReadDir(dest)
+	Expect(t, err).ToBe(nil)
+	if runtime.GOOS != "darwin" {
+		Expect(t, entries[0].Name()).ToBe(nfd)
+	}
+}
+
+func TestOptions_SkipDirMarker(t *testing.T) {
+	src := t.TempDir()
+	for _, dir := range []string{"locked", "open"} {
+		Expect(t, os.MkdirAll(filepath.Join(src, dir, "sub"), 0o755)).ToBe(nil)
+		Expect(t, ioutil.WriteFile(filepath.Join(src, dir, "sub", "file"), []byte(dir), 0o644)).ToBe(nil)
+	}
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "locked", ".nocopy"), nil, 0o644)).ToBe(nil)
+
+	dest := t.TempDir()
+	err := Copy(src, dest, Options{SkipDirMarker: ".nocopy"})
+	Expect(t, err).ToBe(nil)
+	_, err = os.Stat(filepath.Join(dest, "locked"))
+	Expect(t, os.IsNotExist(err)).ToBe(true)
+	_, err = os.Stat(filepath.Join(dest, "open", "sub", "file"))
+	Expect(t, err).ToBe(nil)
+
+	When(t, "without the marker", func(t *testing.T) {
+		dest := t.TempDir()
+		err := Copy(src, dest, Options{SkipDirMarker: ".donotcopy"})
+		Expect(t, err).ToBe(nil)
+		_, err = os.Stat(filepath.Join(dest, "locked", "sub", "file"))
+		Expect(t, err).ToBe(nil)
+	})
+
+	When(t, "MarkerSide is MarkerInDest", func(t *testing.T) {
+		dest := t.TempDir()
+		Expect(t, os.MkdirAll(filepath.Join(dest, "open"), 0o755)).ToBe(nil)
+		Expect(t, ioutil.WriteFile(filepath.Join(dest, "open", ".nocopy"), nil, 0o644)).ToBe(nil)
+		err := Copy(src, dest, Options{SkipDirMarker: ".nocopy", MarkerSide: MarkerInDest})
+		Expect(t, err).ToBe(nil)
+		_, err = os.Stat(filepath.Join(dest, "open", "sub"))
+		Expect(t, os.IsNotExist(err)).ToBe(true)
+		_, err = os.Stat(filepath.Join(dest, "locked", "sub", "file"))
+		Expect(t, err).ToBe(nil)
+	})
+}
+
+type RecordingBatchWriter struct {
+	batches [][]FileData
+}
+
+func (w *RecordingBatchWriter) WriteBatch(files []FileData) error {
+	w.batches = append(w.batches, files)
+	return nil
+}
+
+func TestOptions_BatchWriter(t *testing.T) {
+	src := t.TempDir()
+	for i := 0; i < 5; i++ {
+		Expect(t, ioutil.WriteFile(filepath.Join(src, fmt.Sprintf("small%d", i)), []byte("small"), 0o644)).ToBe(nil)
+	}
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "large"), []byte("large file"), 0o644)).ToBe(nil)
+
+	w := &RecordingBatchWriter{}
+	dest := t.TempDir()
+	err := Copy(src, dest, Options{BatchWriter: w, BatchMaxFileSize: 5, BatchLen: 2})
+	Expect(t, err).ToBe(nil)
+
+	Expect(t, len(w.batches)).ToBe(3)
+	Expect(t, len(w.batches[0])).ToBe(2)
+	Expect(t, len(w.batches[2])).ToBe(1)
+	Expect(t, w.batches[0][0].Path).ToBe(filepath.Join(dest, "small0"))
+	Expect(t, string(w.batches[0][0].Data)).ToBe("small")
+	Expect(t, w.batches[0][0].Mode).ToBe(os.FileMode(0o644))
+
+	_, err = os.Stat(filepath.Join(dest, "small0"))
+	Expect(t, os.IsNotExist(err)).ToBe(true)
+	b, err := ioutil.ReadFile(filepath.Join(dest, "large"))
+	Expect(t, err).ToBe(nil)
+	Expect(t, string(b)).ToBe("large file")
+}
+
+// LatencyFS simulates a remote FS, which takes Latency
+// to open an entry for the first time, and caches it after that.
+type LatencyFS struct {
+	fs.FS
+	Latency time.Duration
+	cache   sync.Map
+}
+
+func (l *LatencyFS) Open(name string) (fs.File, error) {
+	if _, cached := l.cache.LoadOrStore(name, true); !cached {
+		time.Sleep(l.Latency)
+	}
+	return l.FS.Open(name)
+}
+
+func TestOptions_PrefetchDepth(t *testing.T) {
+	src := t.TempDir()
+	for i := 0; i < 8; i++ {
+		Expect(t, ioutil.WriteFile(filepath.Join(src, fmt.Sprintf("file%d", i)), []byte(fmt.Sprint(i)), 0o644)).ToBe(nil)
+	}
+	Expect(t, os.Mkdir(filepath.Join(src, "dir"), 0o755)).ToBe(nil)
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "dir", "file"), []byte("nested"), 0o644)).ToBe(nil)
+
+	dest := t.TempDir()
+	opt := Options{FS: &LatencyFS{FS: os.DirFS(src), Latency: 5 * time.Millisecond}, PrefetchDepth: 2}
+	err := Copy(".", dest, opt)
+	Expect(t, err).ToBe(nil)
+	for i := 0; i < 8; i++ {
+		b, err := ioutil.ReadFile(filepath.Join(dest, fmt.Sprintf("file%d", i)))
+		Expect(t, err).ToBe(nil)
+		Expect(t, string(b)).ToBe(fmt.Sprint(i))
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dest, "dir", "file"))
+	Expect(t, err).ToBe(nil)
+	Expect(t, string(b)).ToBe("nested")
+
+	When(t, "copying fails in the middle", func(t *testing.T) {
+		opt := Options{
+			PrefetchDepth: 2,
+			Skip: func(info os.FileInfo, src, dest string) (bool, error) {
+				if info.Name() == "file3" {
+					return false, fmt.Errorf("stop at file3")
+				}
+				return false, nil
+			},
+		}
+		err := Copy(src, t.TempDir(), opt)
+		Expect(t, err).Not().ToBe(nil)
+		Expect(t, err.Error()).ToBe("stop at file3")
+	})
+}
+
+type CorruptingReader struct {
+	r io.Reader
+}
+
+func (c *CorruptingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if n > 0 {
+		p[0] ^= 0xff
+	}
+	return n, err
+}
+
+func TestOptions_VerifyAndRollback(t *testing.T) {
+	src := t.TempDir()
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "critical.conf"), []byte("new content"), 0o600)).ToBe(nil)
+	dest := t.TempDir()
+	Expect(t, ioutil.WriteFile(filepath.Join(dest, "critical.conf"), []byte("old content"), 0o644)).ToBe(nil)
+
+	err := Copy(src, dest, Options{VerifyAndRollback: true})
+	Expect(t, err).ToBe(nil)
+	b, err := ioutil.ReadFile(filepath.Join(dest, "critical.conf"))
+	Expect(t, err).ToBe(nil)
+	Expect(t, string(b)).ToBe("new content")
+	info, err := os.Stat(filepath.Join(dest, "critical.conf"))
+	Expect(t, err).ToBe(nil)
+	Expect(t, info.Mode().Perm()).ToBe(os.FileMode(0o600))
+
+	corrupt := func(r io.Reader) io.Reader { return &CorruptingReader{r} }
+
+	When(t, "verification fails with the previous dest file", func(t *testing.T) {
+		dest := t.TempDir()
+		Expect(t, ioutil.WriteFile(filepath.Join(dest, "critical.conf"), []byte("old content"), 0o644)).ToBe(nil)
+		err := Copy(src, dest, Options{VerifyAndRollback: true, WrapReader: corrupt})
+		Expect(t, errors.Is(err, ErrVerifyMismatch)).ToBe(true)
+		b, err := ioutil.ReadFile(filepath.Join(dest, "critical.conf"))
+		Expect(t, err).ToBe(nil)
+		Expect(t, string(b)).ToBe("old content")
+		entries, err := ioutil.ReadDir(dest)
+		Expect(t, err).ToBe(nil)
+		Expect(t, len(entries)).ToBe(1)
+	})
+
+	When(t, "verification fails at a known offset", func(t *testing.T) {
+		src := t.TempDir()
+		Expect(t, ioutil.WriteFile(filepath.Join(src, "large"), bytes.Repeat([]byte("0123456789"), 10000), 0o644)).ToBe(nil)
+		corruptAt := func(r io.Reader) io.Reader {
+			b, err := ioutil.ReadAll(r)
+			Expect(t, err).ToBe(nil)
+			b[40000] = 'x'
+			return bytes.NewReader(b)
+		}
+		err := Copy(src, t.TempDir(), Options{VerifyAndRollback: true, WrapReader: corruptAt})
+		var mismatch *VerifyMismatchError
+		Expect(t, errors.As(err, &mismatch)).ToBe(true)
+		Expect(t, mismatch.Offset).ToBe(int64(40000))
+		Expect(t, errors.Is(err, ErrVerifyMismatch)).ToBe(true)
+
+		truncate := func(r io.Reader) io.Reader { return io.LimitReader(r, 12345) }
+		err = Copy(src, t.TempDir(), Options{VerifyAndRollback: true, WrapReader: truncate})
+		Expect(t, errors.As(err, &mismatch)).ToBe(true)
+		Expect(t, mismatch.Offset).ToBe(int64(12345))
+	})
+
+	When(t, "verification fails without the previous dest file", func(t *testing.T) {
+		dest := t.TempDir()
+		err := Copy(src, dest, Options{VerifyAndRollback: true, WrapReader: corrupt})
+		Expect(t, errors.Is(err, ErrVerifyMismatch)).ToBe(true)
+		entries, err := ioutil.ReadDir(dest)
+		Expect(t, err).ToBe(nil)
+		Expect(t, len(entries)).ToBe(0)
+	})
+}
+
+func TestOptions_Traversal(t *testing.T) {
+	src := t.TempDir()
+	Expect(t, os.MkdirAll(filepath.Join(src, "a", "aa", "aaa"), 0o755)).ToBe(nil)
+	Expect(t, os.MkdirAll(filepath.Join(src, "b", "bb"), 0o755)).ToBe(nil)
+	for _, name := range []string{"top", "a/mid", "a/aa/aaa/deep", "b/bb/deep"} {
+		Expect(t, ioutil.WriteFile(filepath.Join(src, name), []byte(name), 0o644)).ToBe(nil)
+	}
+	Expect(t, os.Chmod(filepath.Join(src, "a", "aa"), 0o555)).ToBe(nil)
+	defer os.Chmod(filepath.Join(src, "a", "aa"), 0o755)
+
+	var order []string
+	opt := Options{
+		Traversal: BreadthFirst,
+		Skip: func(info os.FileInfo, src, dest string) (bool, error) {
+			order = append(order, filepath.Base(src))
+			return false, nil
+		},
+	}
+	dest := filepath.Join(t.TempDir(), "dest")
+	err := Copy(src, dest, opt)
+	Expect(t, err).ToBe(nil)
+	Expect(t, strings.Join(order, ",")).ToBe("a,b,top,aa,mid,bb,aaa,deep,deep")
+
+	b, err := ioutil.ReadFile(filepath.Join(dest, "a", "aa", "aaa", "deep"))
+	Expect(t, err).ToBe(nil)
+	Expect(t, string(b)).ToBe("a/aa/aaa/deep")
+	info, err := os.Stat(filepath.Join(dest, "a", "aa"))
+	Expect(t, err).ToBe(nil)
+	Expect(t, info.Mode().Perm()).ToBe(os.FileMode(0o555))
+	os.Chmod(filepath.Join(dest, "a", "aa"), 0o755)
+
+	When(t, "copying fails in a deep level", func(t *testing.T) {
+		opt := Options{
+			Traversal: BreadthFirst,
+			Skip: func(info os.FileInfo, src, dest string) (bool, error) {
+				if info.Name() == "aaa" {
+					return false, fmt.Errorf("stop at aaa")
+				}
+				return false, nil
+			},
+		}
+		dest := filepath.Join(t.TempDir(), "dest")
+		err := Copy(src, dest, opt)
+		Expect(t, err).Not().ToBe(nil)
+		Expect(t, err.Error()).ToBe("stop at aaa")
+		_, err = os.Stat(filepath.Join(dest, "b"))
+		Expect(t, err).ToBe(nil)
+		_, err = os.Stat(filepath.Join(dest, "b", "bb"))
+		Expect(t, os.IsNotExist(err)).ToBe(true)
+		os.Chmod(filepath.Join(dest, "a", "aa"), 0o755)
+	})
+}
+
+func TestOptions_LinkDest(t *testing.T) {
+	src := t.TempDir()
+	Expect(t, os.Mkdir(filepath.Join(src, "sub"), 0o755)).ToBe(nil)
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "sub", "unchanged"), []byte("same"), 0o644)).ToBe(nil)
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "changed"), []byte("old"), 0o644)).ToBe(nil)
+
+	prev := filepath.Join(t.TempDir(), "day1")
+	err := Copy(src, prev, Options{PreserveTimes: true})
+	Expect(t, err).ToBe(nil)
+
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "changed"), []byte("new"), 0o644)).ToBe(nil)
+	Expect(t, os.Chtimes(filepath.Join(src, "changed"), time.Now(), time.Now().Add(time.Hour))).ToBe(nil)
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "added"), []byte("added"), 0o644)).ToBe(nil)
+
+	dest := filepath.Join(t.TempDir(), "day2")
+	err = Copy(src, dest, Options{LinkDest: prev, PreserveTimes: true})
+	Expect(t, err).ToBe(nil)
+
+	sameFile := func(a, b string) bool {
+		ainfo, err := os.Stat(a)
+		Expect(t, err).ToBe(nil)
+		binfo, err := os.Stat(b)
+		Expect(t, err).ToBe(nil)
+		return os.SameFile(ainfo, binfo)
+	}
+	Expect(t, sameFile(filepath.Join(dest, "sub", "unchanged"), filepath.Join(prev, "sub", "unchanged"))).ToBe(true)
+	Expect(t, sameFile(filepath.Join(dest, "changed"), filepath.Join(prev, "changed"))).ToBe(false)
+	b, err := ioutil.ReadFile(filepath.Join(dest, "changed"))
+	Expect(t, err).ToBe(nil)
+	Expect(t, string(b)).ToBe("new")
+	b, err = ioutil.ReadFile(filepath.Join(dest, "added"))
+	Expect(t, err).ToBe(nil)
+	Expect(t, string(b)).ToBe("added")
+}
+
+func TestOptions_OnSocket(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "js" || runtime.GOOS == "plan9" {
+		t.Skip("unix domain socket is not available")
+	}
+	// Short path, because the path of a socket is limited to about 100 bytes.
+	src, err := ioutil.TempDir("", "sock")
+	Expect(t, err).ToBe(nil)
+	defer os.RemoveAll(src)
+	l, err := net.Listen("unix", filepath.Join(src, "app.sock"))
+	Expect(t, err).ToBe(nil)
+	defer l.Close()
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "app.pid"), []byte("123"), 0o644)).ToBe(nil)
+
+	dest := t.TempDir()
+	err = Copy(src, dest)
+	Expect(t, err).ToBe(nil)
+	_, err = os.Lstat(filepath.Join(dest, "app.sock"))
+	Expect(t, os.IsNotExist(err)).ToBe(true)
+	b, err := ioutil.ReadFile(filepath.Join(dest, "app.pid"))
+	Expect(t, err).ToBe(nil)
+	Expect(t, string(b)).ToBe("123")
+
+	When(t, "OnSocket says ErrorSocket", func(t *testing.T) {
+		err := Copy(src, t.TempDir(), Options{OnSocket: func(string) SocketAction { return ErrorSocket }})
+		Expect(t, errors.Is(err, ErrSocket)).ToBe(true)
+	})
+
+	When(t, "OnSocket says RecreateSocket", func(t *testing.T) {
+		dest, err := ioutil.TempDir("", "sock")
+		Expect(t, err).ToBe(nil)
+		defer os.RemoveAll(dest)
+		report, err := CopyWithReport(src, dest, Options{OnSocket: func(string) SocketAction { return RecreateSocket }})
+		Expect(t, err).ToBe(nil)
+		Expect(t, report.Sockets).ToBe(int64(1))
+		info, err := os.Lstat(filepath.Join(dest, "app.sock"))
+		Expect(t, err).ToBe(nil)
+		Expect(t, info.Mode()&os.ModeSocket).Not().ToBe(os.FileMode(0))
+	})
+}
+
+func TestOptions_SyncMode(t *testing.T) {
+	src := t.TempDir()
+	Expect(t, os.Mkdir(filepath.Join(src, "sub"), 0o755)).ToBe(nil)
+	for _, name := range []string{"a", "b", "sub/c"} {
+		Expect(t, ioutil.WriteFile(filepath.Join(src, name), []byte(name), 0o644)).ToBe(nil)
+	}
+	for _, opt := range []Options{
+		{Sync: true},
+		{SyncMode: SyncPerFile},
+		{SyncMode: SyncBatched},
+		{SyncMode: SyncBatched, NumOfWorkers: 4},
+		{SyncMode: SyncBatched, VerifyAndRollback: true},
+	} {
+		dest := t.TempDir()
+		err := Copy(src, dest, opt)
+		Expect(t, err).ToBe(nil)
+		b, err := ioutil.ReadFile(filepath.Join(dest, "sub", "c"))
+		Expect(t, err).ToBe(nil)
+		Expect(t, string(b)).ToBe("sub/c")
+	}
+
+	When(t, "src is a file", func(t *testing.T) {
+		dest := filepath.Join(t.TempDir(), "a")
+		err := Copy(filepath.Join(src, "a"), dest, Options{SyncMode: SyncBatched})
+		Expect(t, err).ToBe(nil)
+		b, err := ioutil.ReadFile(dest)
+		Expect(t, err).ToBe(nil)
+		Expect(t, string(b)).ToBe("a")
+	})
+
+	When(t, "src is read-only", func(t *testing.T) {
+		src := t.TempDir()
+		Expect(t, ioutil.WriteFile(filepath.Join(src, "ro"), []byte("ro"), 0o444)).ToBe(nil)
+		dest := t.TempDir()
+		err := Copy(src, dest, Options{SyncMode: SyncBatched})
+		Expect(t, err).ToBe(nil)
+		b, err := ioutil.ReadFile(filepath.Join(dest, "ro"))
+		Expect(t, err).ToBe(nil)
+		Expect(t, string(b)).ToBe("ro")
+	})
+}
+
+func TestOptions_DestPrefixSuffix(t *testing.T) {
+	src := t.TempDir()
+	Expect(t, os.Mkdir(filepath.Join(src, "sub"), 0o755)).ToBe(nil)
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "sub", "file.txt"), []byte("staged"), 0o644)).ToBe(nil)
+
+	dest := t.TempDir()
+	err := Copy(src, dest, Options{DestSuffix: ".staged"})
+	Expect(t, err).ToBe(nil)
+	b, err := ioutil.ReadFile(filepath.Join(dest, "sub", "file.txt.staged"))
+	Expect(t, err).ToBe(nil)
+	Expect(t, string(b)).ToBe("staged")
+
+	dest = t.TempDir()
+	err = Copy(src, dest, Options{DestPrefix: "staged_"})
+	Expect(t, err).ToBe(nil)
+	_, err = os.Stat(filepath.Join(dest, "sub", "staged_file.txt"))
+	Expect(t, err).ToBe(nil)
+
+	When(t, "with Mirror", func(t *testing.T) {
+		dest := t.TempDir()
+		Expect(t, ioutil.WriteFile(filepath.Join(dest, "extra"), []byte("extra"), 0o644)).ToBe(nil)
+		err := Copy(src, dest, Options{DestSuffix: ".staged", Mirror: true})
+		Expect(t, err).ToBe(nil)
+		_, err = os.Stat(filepath.Join(dest, "sub", "file.txt.staged"))
+		Expect(t, err).ToBe(nil)
+		_, err = os.Stat(filepath.Join(dest, "extra"))
+		Expect(t, os.IsNotExist(err)).ToBe(true)
+	})
+}
+
+func TestOptions_AppendMode(t *testing.T) {
+	src := t.TempDir()
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "app.log"), []byte("day2\n"), 0o644)).ToBe(nil)
+	dest := t.TempDir()
+	Expect(t, ioutil.WriteFile(filepath.Join(dest, "app.log"), []byte("day1\n"), 0o644)).ToBe(nil)
+
+	err := Copy(src, dest, Options{AppendMode: true})
+	Expect(t, err).ToBe(nil)
+	b, err := ioutil.ReadFile(filepath.Join(dest, "app.log"))
+	Expect(t, err).ToBe(nil)
+	Expect(t, string(b)).ToBe("day1\nday2\n")
+
+	When(t, "dest file doesn't exist", func(t *testing.T) {
+		dest := t.TempDir()
+		err := Copy(src, dest, Options{AppendMode: true, CopyBufferSize: 2})
+		Expect(t, err).ToBe(nil)
+		b, err := ioutil.ReadFile(filepath.Join(dest, "app.log"))
+		Expect(t, err).ToBe(nil)
+		Expect(t, string(b)).ToBe("day2\n")
+	})
+
+	When(t, "conflicting options are given", func(t *testing.T) {
+		err := Copy(src, t.TempDir(), Options{AppendMode: true, VerifyAndRollback: true})
+		Expect(t, errors.Is(err, ErrConflictingOptions)).ToBe(true)
+		Expect(t, err.Error()).ToBe("conflicting options: AppendMode and VerifyAndRollback")
+		_, err = Estimate(src, Options{AppendMode: true, PreCreateDest: true})
+		Expect(t, errors.Is(err, ErrConflictingOptions)).ToBe(true)
+	})
+}
+
+func TestOptions_ValidateSymlinkTarget(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks with such targets can't be created on Windows")
+	}
+	src := t.TempDir()
+	Expect(t, os.Symlink("target", filepath.Join(src, "good"))).ToBe(nil)
+	Expect(t, os.Symlink(strings.Repeat("long/", 200), filepath.Join(src, "long"))).ToBe(nil)
+	Expect(t, os.Symlink("bell\x07", filepath.Join(src, "control"))).ToBe(nil)
+
+	var rejected []string
+	opt := Options{
+		ValidateSymlinkTarget: SafeSymlinkTarget(256),
+		OnError: func(src, dest string, err error) error {
+			if errors.Is(err, ErrUnsafeSymlinkTarget) {
+				rejected = append(rejected, filepath.Base(src))
+				return nil
+			}
+			return err
+		},
+	}
+	dest := t.TempDir()
+	err := Copy(src, dest, opt)
+	Expect(t, err).ToBe(nil)
+	Expect(t, rejected).ToBe([]string{"control", "long"})
+	target, err := os.Readlink(filepath.Join(dest, "good"))
+	Expect(t, err).ToBe(nil)
+	Expect(t, target).ToBe("target")
+	_, err = os.Lstat(filepath.Join(dest, "long"))
+	Expect(t, os.IsNotExist(err)).ToBe(true)
+
+	When(t, "the target contains a null byte", func(t *testing.T) {
+		err := SafeSymlinkTarget(0)("target\x00/etc/passwd")
+		Expect(t, errors.Is(err, ErrUnsafeSymlinkTarget)).ToBe(true)
+		Expect(t, SafeSymlinkTarget(0)(strings.Repeat("long/", 200))).ToBe(nil)
+	})
+}
+
+func TestOptions_RewriteSymlinks(t *testing.T) {
+	src := t.TempDir()
+	Expect(t, os.MkdirAll(filepath.Join(src, "dir", "sub"), 0o755)).ToBe(nil)
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "dir", "file"), []byte("file"), 0o644)).ToBe(nil)
+	Expect(t, os.Symlink(filepath.Join(src, "dir", "file"), filepath.Join(src, "dir", "sub", "inside"))).ToBe(nil)
+	outside := filepath.Join(t.TempDir(), "outside")
+	Expect(t, os.Symlink(outside, filepath.Join(src, "dir", "sub", "outside"))).ToBe(nil)
+
+	When(t, "RewriteToDest", func(t *testing.T) {
+		dest := t.TempDir()
+		Expect(t, Copy(src, dest, Options{RewriteSymlinks: RewriteToDest})).ToBe(nil)
+		target, err := os.Readlink(filepath.Join(dest, "dir", "sub", "inside"))
+		Expect(t, err).ToBe(nil)
+		Expect(t, target).ToBe(filepath.Join(dest, "dir", "file"))
+		target, err = os.Readlink(filepath.Join(dest, "dir", "sub", "outside"))
+		Expect(t, err).ToBe(nil)
+		Expect(t, target).ToBe(outside)
+	})
+
+	When(t, "RewriteToRelative", func(t *testing.T) {
+		dest := t.TempDir()
+		Expect(t, Copy(src, dest, Options{RewriteSymlinks: RewriteToRelative})).ToBe(nil)
+		target, err := os.Readlink(filepath.Join(dest, "dir", "sub", "inside"))
+		Expect(t, err).ToBe(nil)
+		Expect(t, target).ToBe(filepath.Join("..", "file"))
+		b, err := ioutil.ReadFile(filepath.Join(dest, "dir", "sub", "inside"))
+		Expect(t, err).ToBe(nil)
+		Expect(t, string(b)).ToBe("file")
+	})
+
+	When(t, "RewriteSymlinkTarget is given", func(t *testing.T) {
+		dest := t.TempDir()
+		err := Copy(src, dest, Options{RewriteSymlinkTarget: func(target string) string {
+			return strings.Replace(target, "outside", "elsewhere", 1)
+		}})
+		Expect(t, err).ToBe(nil)
+		target, err := os.Readlink(filepath.Join(dest, "dir", "sub", "outside"))
+		Expect(t, err).ToBe(nil)
+		Expect(t, target).ToBe(filepath.Join(filepath.Dir(outside), "elsewhere"))
+	})
+}
+
+func TestOptions_KeepNewestPerDir(t *testing.T) {
+	src := t.TempDir()
+	Expect(t, os.Mkdir(filepath.Join(src, "sub"), 0o755)).ToBe(nil)
+	base := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	days := map[string]int{"snap-1": 4, "snap-2": 1, "snap-3": 3, "snap-4": 2, "sub/snap-a": 1, "sub/snap-b": 2}
+	for name, day := range days {
+		path := filepath.Join(src, name)
+		Expect(t, ioutil.WriteFile(path, []byte(name), 0o644)).ToBe(nil)
+		mtime := base.AddDate(0, 0, day)
+		Expect(t, os.Chtimes(path, mtime, mtime)).ToBe(nil)
+	}
+
+	dest := t.TempDir()
+	err := Copy(src, dest, Options{KeepNewestPerDir: 2})
+	Expect(t, err).ToBe(nil)
+	names := func(dir string) []string {
+		entries, err := ioutil.ReadDir(dir)
+		Expect(t, err).ToBe(nil)
+		names := []string{}
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		return names
+	}
+	Expect(t, names(dest)).ToBe([]string{"snap-1", "snap-3", "sub"})
+	Expect(t, names(filepath.Join(dest, "sub"))).ToBe([]string{"snap-a", "snap-b"})
+}
+
+func TestPlan(t *testing.T) {
+	src := t.TempDir()
+	Expect(t, os.Mkdir(filepath.Join(src, "new"), 0o755)).ToBe(nil)
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "new", "file"), []byte("new"), 0o644)).ToBe(nil)
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "changed"), []byte("changed"), 0o644)).ToBe(nil)
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "same"), []byte("same"), 0o644)).ToBe(nil)
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "skipped"), []byte("skipped"), 0o644)).ToBe(nil)
+	Expect(t, os.Symlink("same", filepath.Join(src, "link"))).ToBe(nil)
+
+	dest := t.TempDir()
+	Expect(t, ioutil.WriteFile(filepath.Join(dest, "changed"), []byte("old"), 0o644)).ToBe(nil)
+	Expect(t, ioutil.WriteFile(filepath.Join(dest, "same"), []byte("same"), 0o644)).ToBe(nil)
+	Expect(t, ioutil.WriteFile(filepath.Join(dest, "extra"), []byte("extra"), 0o644)).ToBe(nil)
+
+	opt := Options{
+		SkipIfContentEqual: true,
+		Mirror:             true,
+		Skip: func(info os.FileInfo, src, dest string) (bool, error) {
+			return info.Name() == "skipped", nil
+		},
+	}
+	ops, err := Plan(src, dest, opt)
+	Expect(t, err).ToBe(nil)
+	Expect(t, ops).ToBe([]PlannedOp{
+		{Kind: PlanOverwrite, Src: filepath.Join(src, "changed"), Dest: filepath.Join(dest, "changed"), Bytes: 7},
+		{Kind: PlanSymlink, Src: filepath.Join(src, "link"), Dest: filepath.Join(dest, "link")},
+		{Kind: PlanMkdir, Src: filepath.Join(src, "new"), Dest: filepath.Join(dest, "new")},
+		{Kind: PlanCreate, Src: filepath.Join(src, "new", "file"), Dest: filepath.Join(dest, "new", "file"), Bytes: 3},
+		{Kind: PlanSkip, Src: filepath.Join(src, "same"), Dest: filepath.Join(dest, "same"), Reason: "same content"},
+		{Kind: PlanSkip, Src: filepath.Join(src, "skipped"), Dest: filepath.Join(dest, "skipped"), Reason: "Skip"},
+		{Kind: PlanDelete, Dest: filepath.Join(dest, "extra"), Reason: "Mirror"},
+	})
+	entries, err := ioutil.ReadDir(dest)
+	Expect(t, err).ToBe(nil)
+	Expect(t, len(entries)).ToBe(3)
+	b, err := ioutil.ReadFile(filepath.Join(dest, "changed"))
+	Expect(t, err).ToBe(nil)
+	Expect(t, string(b)).ToBe("old")
+
+	When(t, "a dest directory is to be replaced", func(t *testing.T) {
+		Expect(t, os.Mkdir(filepath.Join(dest, "new"), 0o755)).ToBe(nil)
+		Expect(t, ioutil.WriteFile(filepath.Join(dest, "new", "file"), []byte("old"), 0o644)).ToBe(nil)
+		opt := Options{OnDirExists: func(src, dest string) DirExistsAction { return Replace }}
+		ops, err := Plan(filepath.Join(src, "new"), filepath.Join(dest, "new"), opt)
+		Expect(t, err).ToBe(nil)
+		Expect(t, ops[0].Kind).ToBe(PlanOverwrite)
+
+		ops, err = Plan(src, dest, opt)
+		Expect(t, err).ToBe(nil)
+		kinds := []string{}
+		for _, op := range ops {
+			kinds = append(kinds, op.Kind.String())
+		}
+		Expect(t, kinds).ToBe([]string{"overwrite", "symlink", "delete", "mkdir", "create", "overwrite", "create"})
+	})
+}
+
+func TestOptions_AllowReadFromWithBuffer(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "file")
+	Expect(t, ioutil.WriteFile(src, bytes.Repeat([]byte("0123456789"), 10000), 0o644)).ToBe(nil)
+	for _, opt := range []Options{
+		{CopyBufferSize: 64, AllowReadFromWithBuffer: true},
+		{CopyBufferSize: 64, AllowReadFromWithBuffer: true, WrapReader: func(r io.Reader) io.Reader { return r }},
+		{CopyBufferSize: 64, AllowReadFromWithBuffer: true, FS: os.DirFS(filepath.Dir(src))},
+	} {
+		dest := filepath.Join(t.TempDir(), "file")
+		from := src
+		if opt.FS != nil {
+			from = "file"
+		}
+		err := Copy(from, dest, opt)
+		Expect(t, err).ToBe(nil)
+		b, err := ioutil.ReadFile(dest)
+		Expect(t, err).ToBe(nil)
+		Expect(t, len(b)).ToBe(100000)
+	}
+}
+
+func TestOptions_TimestampSink(t *testing.T) {
+	src := t.TempDir()
+	Expect(t, os.Mkdir(filepath.Join(src, "sub"), 0o755)).ToBe(nil)
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "sub", "file"), []byte("file"), 0o644)).ToBe(nil)
+	atime := time.Date(2021, 2, 3, 4, 5, 6, 123456789, time.UTC)
+	mtime := time.Date(2022, 3, 4, 5, 6, 7, 987654321, time.UTC)
+	Expect(t, os.Chtimes(filepath.Join(src, "sub", "file"), atime, mtime)).ToBe(nil)
+	Expect(t, os.Chtimes(filepath.Join(src, "sub"), atime, mtime)).ToBe(nil)
+
+	var mu sync.Mutex
+	times := map[string]Timespec{}
+	opt := Options{TimestampSink: func(dest string, spec Timespec) {
+		mu.Lock()
+		defer mu.Unlock()
+		times[dest] = spec
+	}}
+	dest := t.TempDir()
+	err := Copy(src, dest, opt)
+	Expect(t, err).ToBe(nil)
+	Expect(t, len(times)).ToBe(3)
+	for _, name := range []string{filepath.Join("sub", "file"), "sub"} {
+		spec := times[filepath.Join(dest, name)]
+		Expect(t, spec.Mtime.Equal(mtime)).ToBe(true)
+		if runtime.GOOS != "windows" {
+			Expect(t, spec.Atime.Equal(atime)).ToBe(true)
+		}
+	}
+
+	When(t, "src is on fs.FS", func(t *testing.T) {
+		times = map[string]Timespec{}
+		err := Copy("test/data/case18/assets", t.TempDir(), Options{FS: assets, AddPermission: 0o200, TimestampSink: opt.TimestampSink})
+		Expect(t, err).ToBe(nil)
+		Expect(t, len(times) > 0).ToBe(true)
+	})
+}
+
+func TestOptions_ShouldCopy(t *testing.T) {
+	src := t.TempDir()
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "existing"), []byte("new"), 0o644)).ToBe(nil)
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "added"), []byte("added"), 0o644)).ToBe(nil)
+	prepare := func(t *testing.T) string {
+		dest := t.TempDir()
+		Expect(t, ioutil.WriteFile(filepath.Join(dest, "existing"), []byte("old"), 0o644)).ToBe(nil)
+		return dest
+	}
+	read := func(path string) string {
+		b, err := ioutil.ReadFile(path)
+		Expect(t, err).ToBe(nil)
+		return string(b)
+	}
+
+	When(t, "it always says to skip", func(t *testing.T) {
+		dest := prepare(t)
+		called := []string{}
+		err := Copy(src, dest, Options{ShouldCopy: func(src, dest string, srcinfo, destinfo os.FileInfo) (bool, error) {
+			called = append(called, srcinfo.Name())
+			return false, nil
+		}})
+		Expect(t, err).ToBe(nil)
+		Expect(t, called).ToBe([]string{"existing"})
+		Expect(t, read(filepath.Join(dest, "existing"))).ToBe("old")
+		Expect(t, read(filepath.Join(dest, "added"))).ToBe("added")
+	})
+
+	When(t, "it always says to copy", func(t *testing.T) {
+		dest := prepare(t)
+		Expect(t, ioutil.WriteFile(filepath.Join(dest, "existing"), []byte("new"), 0o644)).ToBe(nil)
+		Expect(t, os.Chtimes(filepath.Join(dest, "existing"), time.Now(), time.Now().Add(-time.Hour))).ToBe(nil)
+		always := func(src, dest string, srcinfo, destinfo os.FileInfo) (bool, error) { return true, nil }
+		report, err := Sync(src, dest, Options{SkipIfContentEqual: true, ShouldCopy: always})
+		Expect(t, err).ToBe(nil)
+		Expect(t, report.Copied).ToBe([]string{"added", "existing"})
+	})
+
+	When(t, "Atomic or VerifyAndRollback is given", func(t *testing.T) {
+		for _, opt := range []Options{{Atomic: true}, {VerifyAndRollback: true}} {
+			asked := []string{}
+			opt.ShouldCopy = func(src, dest string, srcinfo, destinfo os.FileInfo) (bool, error) {
+				asked = append(asked, filepath.Base(dest))
+				return srcinfo.Name() == "existing", nil
+			}
+			dest := prepare(t)
+			Expect(t, Copy(src, dest, opt)).ToBe(nil)
+			Expect(t, asked).ToBe([]string{"existing"})
+			Expect(t, read(filepath.Join(dest, "existing"))).ToBe("new")
+			Expect(t, read(filepath.Join(dest, "added"))).ToBe("added")
+		}
+	})
+
+	When(t, "it says to copy the file SkipUnchanged would skip", func(t *testing.T) {
+		dest := prepare(t)
+		info, err := os.Stat(filepath.Join(src, "existing"))
+		Expect(t, err).ToBe(nil)
+		Expect(t, os.Chtimes(filepath.Join(dest, "existing"), info.ModTime(), info.ModTime())).ToBe(nil)
+		always := func(src, dest string, srcinfo, destinfo os.FileInfo) (bool, error) { return true, nil }
+		opt := Options{SkipUnchanged: true, ShouldCopy: always}
+		ops, err := Plan(filepath.Join(src, "existing"), filepath.Join(dest, "existing"), opt)
+		Expect(t, err).ToBe(nil)
+		Expect(t, ops[0].Kind).ToBe(PlanOverwrite)
+		Expect(t, Copy(src, dest, opt)).ToBe(nil)
+		Expect(t, read(filepath.Join(dest, "existing"))).ToBe("new")
+	})
+
+	When(t, "it fails", func(t *testing.T) {
+		dest := prepare(t)
+		err := Copy(src, dest, Options{ShouldCopy: func(src, dest string, srcinfo, destinfo os.FileInfo) (bool, error) {
+			return false, fmt.Errorf("no etag")
+		}})
+		Expect(t, err.Error()).ToBe("no etag")
+	})
+}
+
+func TestOptions_TimeBudget(t *testing.T) {
+	src := t.TempDir()
+	for i := 0; i < 100; i++ {
+		Expect(t, ioutil.WriteFile(filepath.Join(src, fmt.Sprintf("file%03d", i)), bytes.Repeat([]byte("x"), 1000), 0o644)).ToBe(nil)
+	}
+	slow := func(string) int64 { return 100 * 1000 } // 10ms for each file
+
+	for _, workers := range []int64{0, 4} {
+		dest := t.TempDir()
+		opt := Options{TimeBudget: 50 * time.Millisecond, NumOfWorkers: workers, CopyBufferSize: 100, RateLimitFunc: slow}
+		report, err := Sync(src, dest, opt)
+		Expect(t, errors.Is(err, ErrTimeBudgetExceeded)).ToBe(true)
+		Expect(t, len(report.Copied) > 0).ToBe(true)
+		Expect(t, len(report.Copied) < 100).ToBe(true)
+		for _, name := range report.Copied {
+			// Files started are completed, not partial.
+			info, err := os.Stat(filepath.Join(dest, name))
+			Expect(t, err).ToBe(nil)
+			Expect(t, info.Size()).ToBe(int64(1000))
+		}
+	}
+}
+
+func TestOptions_CollapseSymlinkChains(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hard links are not compared on Windows")
+	}
+	src := t.TempDir()
+	Expect(t, os.Mkdir(filepath.Join(src, "real"), 0o755)).ToBe(nil)
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "real", "file"), []byte("shared"), 0o644)).ToBe(nil)
+	Expect(t, os.Mkdir(filepath.Join(src, "links"), 0o755)).ToBe(nil)
+	Expect(t, os.Symlink(filepath.Join("..", "real", "file"), filepath.Join(src, "links", "b"))).ToBe(nil)
+	Expect(t, os.Symlink("b", filepath.Join(src, "links", "a"))).ToBe(nil)
+	Expect(t, os.Symlink(filepath.Join("..", "real", "file"), filepath.Join(src, "links", "c"))).ToBe(nil)
+
+	opt := Options{
+		OnSymlink:             func(string) SymlinkAction { return Deep },
+		CollapseSymlinkChains: true,
+	}
+	dest := t.TempDir()
+	err := Copy(filepath.Join(src, "links"), dest, opt)
+	Expect(t, err).ToBe(nil)
+	infos := []os.FileInfo{}
+	for _, name := range []string{"a", "b", "c"} {
+		info, err := os.Lstat(filepath.Join(dest, name))
+		Expect(t, err).ToBe(nil)
+		Expect(t, info.Mode().IsRegular()).ToBe(true)
+		b, err := ioutil.ReadFile(filepath.Join(dest, name))
+		Expect(t, err).ToBe(nil)
+		Expect(t, string(b)).ToBe("shared")
+		infos = append(infos, info)
+	}
+	Expect(t, os.SameFile(infos[0], infos[1])).ToBe(true)
+	Expect(t, os.SameFile(infos[0], infos[2])).ToBe(true)
+
+	When(t, "the chain is a loop", func(t *testing.T) {
+		src := t.TempDir()
+		Expect(t, os.Symlink("y", filepath.Join(src, "x"))).ToBe(nil)
+		Expect(t, os.Symlink("x", filepath.Join(src, "y"))).ToBe(nil)
+		err := Copy(src, t.TempDir(), opt)
+		Expect(t, errors.Is(err, ErrSymlinkLoop)).ToBe(true)
+	})
+}
+
+func TestOptions_OnProgress(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "large")
+	Expect(t, ioutil.WriteFile(src, make([]byte, 1024*1024), 0o644)).ToBe(nil)
+
+	var calls int
+	var last int64
+	opt := Options{
+		CopyBufferSize: 1024,
+		OnProgress: func(src, dest string, copied, total int64) {
+			Expect(t, total).ToBe(int64(1024 * 1024))
+			calls, last = calls+1, copied
+		},
+	}
+	err := Copy(src, filepath.Join(t.TempDir(), "large"), opt)
+	Expect(t, err).ToBe(nil)
+	Expect(t, calls).ToBe(1024)
+	Expect(t, last).ToBe(int64(1024 * 1024))
+
+	When(t, "ProgressInterval is given", func(t *testing.T) {
+		calls, last = 0, 0
+		opt.ProgressInterval = time.Hour
+		err := Copy(src, filepath.Join(t.TempDir(), "large"), opt)
+		Expect(t, err).ToBe(nil)
+		// The first chunk, and the end.
+		Expect(t, calls).ToBe(2)
+		Expect(t, last).ToBe(int64(1024 * 1024))
+	})
+}
+
+func TestOptions_BackupDir(t *testing.T) {
+	src := t.TempDir()
+	Expect(t, os.Mkdir(filepath.Join(src, "sub"), 0o755)).ToBe(nil)
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "sub", "file"), []byte("new"), 0o644)).ToBe(nil)
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "created"), []byte("new"), 0o644)).ToBe(nil)
+	dest := t.TempDir()
+	Expect(t, os.Mkdir(filepath.Join(dest, "sub"), 0o755)).ToBe(nil)
+	Expect(t, ioutil.WriteFile(filepath.Join(dest, "sub", "file"), []byte("old"), 0o644)).ToBe(nil)
+
+	bak := t.TempDir()
+	opt := Options{BackupDir: bak}
+	ops, err := Plan(src, dest, opt)
+	Expect(t, err).ToBe(nil)
+	Expect(t, ops[1]).ToBe(PlannedOp{Kind: PlanBackup, Src: filepath.Join(dest, "sub", "file"), Dest: filepath.Join(bak, "sub", "file"), Bytes: 3})
+	Expect(t, ops[2].Kind).ToBe(PlanOverwrite)
+
+	err = Copy(src, dest, opt)
+	Expect(t, err).ToBe(nil)
+	b, err := ioutil.ReadFile(filepath.Join(dest, "sub", "file"))
+	Expect(t, err).ToBe(nil)
+	Expect(t, string(b)).ToBe("new")
+	b, err = ioutil.ReadFile(filepath.Join(bak, "sub", "file"))
+	Expect(t, err).ToBe(nil)
+	Expect(t, string(b)).ToBe("old")
+	_, err = os.Stat(filepath.Join(bak, "created"))
+	Expect(t, os.IsNotExist(err)).ToBe(true)
+
+	When(t, "VerifyAndRollback is on", func(t *testing.T) {
+		Expect(t, ioutil.WriteFile(filepath.Join(dest, "sub", "file"), []byte("older"), 0o644)).ToBe(nil)
+		err := Copy(src, dest, Options{BackupDir: bak, VerifyAndRollback: true})
+		Expect(t, err).ToBe(nil)
+		b, err := ioutil.ReadFile(filepath.Join(bak, "sub", "file"))
+		Expect(t, err).ToBe(nil)
+		Expect(t, string(b)).ToBe("older")
+	})
+}
+
+func TestOptions_Backup(t *testing.T) {
+	src := t.TempDir()
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "file"), []byte("new"), 0o644)).ToBe(nil)
+	read := func(t *testing.T, path string) string {
+		b, err := ioutil.ReadFile(path)
+		Expect(t, err).ToBe(nil)
+		return string(b)
+	}
+
+	When(t, "SimpleBackup", func(t *testing.T) {
+		dest := t.TempDir()
+		for _, content := range []string{"old", "older"} {
+			Expect(t, ioutil.WriteFile(filepath.Join(dest, "file"), []byte(content), 0o644)).ToBe(nil)
+			Expect(t, Copy(src, dest, Options{Backup: SimpleBackup})).ToBe(nil)
+		}
+		Expect(t, read(t, filepath.Join(dest, "file"))).ToBe("new")
+		Expect(t, read(t, filepath.Join(dest, "file.bak"))).ToBe("older")
+	})
+
+	When(t, "NumberedBackup", func(t *testing.T) {
+		dest := t.TempDir()
+		for _, content := range []string{"old", "older"} {
+			Expect(t, ioutil.WriteFile(filepath.Join(dest, "file"), []byte(content), 0o644)).ToBe(nil)
+			Expect(t, Copy(src, dest, Options{Backup: NumberedBackup})).ToBe(nil)
+		}
+		Expect(t, read(t, filepath.Join(dest, "file.~1~"))).ToBe("old")
+		Expect(t, read(t, filepath.Join(dest, "file.~2~"))).ToBe("older")
+	})
+
+	When(t, "BackupName and BackupDir are given", func(t *testing.T) {
+		dest, bak := t.TempDir(), t.TempDir()
+		Expect(t, ioutil.WriteFile(filepath.Join(dest, "file"), []byte("old"), 0o644)).ToBe(nil)
+		err := Copy(src, dest, Options{Backup: NumberedBackup, BackupDir: bak, BackupName: func(dest string, n int) string {
+			return fmt.Sprintf("%s-v%d", dest, n)
+		}})
+		Expect(t, err).ToBe(nil)
+		Expect(t, read(t, filepath.Join(bak, "file-v1"))).ToBe("old")
+	})
+
+	When(t, "Mirror is given without BackupDir", func(t *testing.T) {
+		err := Copy(src, t.TempDir(), Options{Backup: SimpleBackup, Mirror: true})
+		Expect(t, errors.Is(err, ErrConflictingOptions)).ToBe(true)
+	})
+}
+
+func TestOptions_PathRenames(t *testing.T) {
+	src := t.TempDir()
+	Expect(t, os.MkdirAll(filepath.Join(src, "a", "b"), 0o755)).ToBe(nil)
+	for _, name := range []string{"a/b/renamed", "a/b/kept", "a/moved", "top"} {
+		Expect(t, ioutil.WriteFile(filepath.Join(src, filepath.FromSlash(name)), []byte(name), 0o644)).ToBe(nil)
+	}
+	dest := t.TempDir()
+	opt := Options{
+		Mirror: true,
+		PathRenames: map[string]string{
+			"a/b/renamed": "a/b/new-name",
+			"a/moved":     "x/y/moved",
+		},
+	}
+	err := Copy(src, dest, opt)
+	Expect(t, err).ToBe(nil)
+
+	found := []string{}
+	filepath.Walk(dest, func(path string, info os.FileInfo, err error) error {
+		if !info.IsDir() {
+			rel, _ := filepath.Rel(dest, path)
+			b, _ := ioutil.ReadFile(path)
+			found = append(found, filepath.ToSlash(rel)+"="+string(b))
+		}
+		return nil
+	})
+	Expect(t, found).ToBe([]string{
+		"a/b/kept=a/b/kept",
+		"a/b/new-name=a/b/renamed",
+		"top=top",
+		"x/y/moved=a/moved",
+	})
+}
+
+func TestOptions_AlwaysApplyPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not fully supported on Windows")
+	}
+	src := filepath.Join(t.TempDir(), "file")
+	Expect(t, ioutil.WriteFile(src, []byte("file"), 0o644)).ToBe(nil)
+	Expect(t, os.Chmod(src, 0o644)).ToBe(nil)
+	dest := filepath.Join(t.TempDir(), "file")
+	Expect(t, Copy(src, dest, Options{PreserveTimes: true})).ToBe(nil)
+	Expect(t, os.Chmod(dest, 0o600)).ToBe(nil)
+
+	err := Copy(src, dest, Options{SkipIfContentEqual: true})
+	Expect(t, err).ToBe(nil)
+	info, err := os.Stat(dest)
+	Expect(t, err).ToBe(nil)
+	Expect(t, info.Mode().Perm()).ToBe(os.FileMode(0o600))
+
+	err = Copy(src, dest, Options{SkipIfContentEqual: true, AlwaysApplyPermissions: true})
+	Expect(t, err).ToBe(nil)
+	info, err = os.Stat(dest)
+	Expect(t, err).ToBe(nil)
+	Expect(t, info.Mode().Perm()).ToBe(os.FileMode(0o644))
+
+	When(t, "called by Sync", func(t *testing.T) {
+		Expect(t, os.Chmod(dest, 0o600)).ToBe(nil)
+		report, err := Sync(src, dest, Options{AlwaysApplyPermissions: true, AddPermission: 0o020})
+		Expect(t, err).ToBe(nil)
+		Expect(t, len(report.Unchanged)).ToBe(1)
+		info, err := os.Stat(dest)
+		Expect(t, err).ToBe(nil)
+		Expect(t, info.Mode().Perm()).ToBe(os.FileMode(0o664))
+	})
+}
+
+func TestCopyStreamToFile(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), "sub", "dir", "file")
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	err := CopyStreamToFile(strings.NewReader("streamed"), dest, 0o640, mtime)
+	Expect(t, err).ToBe(nil)
+	b, err := ioutil.ReadFile(dest)
+	Expect(t, err).ToBe(nil)
+	Expect(t, string(b)).ToBe("streamed")
+	info, err := os.Stat(dest)
+	Expect(t, err).ToBe(nil)
+	Expect(t, info.ModTime().Equal(mtime)).ToBe(true)
+	if runtime.GOOS != "windows" {
+		Expect(t, info.Mode().Perm()).ToBe(os.FileMode(0o640))
+	}
+
+	When(t, "VerifyAndRollback is on", func(t *testing.T) {
+		var written int64
+		opt := Options{VerifyAndRollback: true, SyncMode: SyncPerFile, BytesWritten: &written}
+		err := CopyStreamToFile(strings.NewReader("replaced"), dest, 0o600, time.Time{}, opt)
+		Expect(t, err).ToBe(nil)
+		b, err := ioutil.ReadFile(dest)
+		Expect(t, err).ToBe(nil)
+		Expect(t, string(b)).ToBe("replaced")
+		Expect(t, written).ToBe(int64(8))
+		entries, err := ioutil.ReadDir(filepath.Dir(dest))
+		Expect(t, err).ToBe(nil)
+		Expect(t, len(entries)).ToBe(1)
+	})
+
+	When(t, "Backup is given", func(t *testing.T) {
+		dest := filepath.Join(t.TempDir(), "file")
+		Expect(t, ioutil.WriteFile(dest, []byte("old"), 0o644)).ToBe(nil)
+		err := CopyStreamToFile(strings.NewReader("new"), dest, 0o644, time.Time{}, Options{Backup: SimpleBackup})
+		Expect(t, err).ToBe(nil)
+		b, err := ioutil.ReadFile(dest)
+		Expect(t, err).ToBe(nil)
+		Expect(t, string(b)).ToBe("new")
+		b, err = ioutil.ReadFile(dest + ".bak")
+		Expect(t, err).ToBe(nil)
+		Expect(t, string(b)).ToBe("old")
+	})
+
+	When(t, "the stream fails", func(t *testing.T) {
+		dest := filepath.Join(t.TempDir(), "file")
+		r := io.MultiReader(strings.NewReader("partial"), iotest.ErrReader(io.ErrUnexpectedEOF))
+		err := CopyStreamToFile(r, dest, 0o644, mtime, Options{VerifyAndRollback: true})
+		Expect(t, errors.Is(err, io.ErrUnexpectedEOF)).ToBe(true)
+		entries, err := ioutil.ReadDir(filepath.Dir(dest))
+		Expect(t, err).ToBe(nil)
+		Expect(t, len(entries)).ToBe(0)
+	})
+}
+
+// SlowDisk simulates a spinning disk, which takes Seek
+// every time it switches files to read, as the head moves.
+type SlowDisk struct {
+	Seek time.Duration
+
+	mu        sync.Mutex
+	last      *diskReader
+	active    int
+	MaxActive int
+}
+
+func (d *SlowDisk) Wrap(r io.Reader) io.Reader {
+	return &diskReader{Reader: r, disk: d}
+}
+
+type diskReader struct {
+	io.Reader
+	disk    *SlowDisk
+	started bool
+}
+
+func (r *diskReader) Read(p []byte) (int, error) {
+	d := r.disk
+	d.mu.Lock()
+	if !r.started {
+		r.started = true
+		if d.active++; d.active > d.MaxActive {
+			d.MaxActive = d.active
+		}
+	}
+	seek := d.last != nil && d.last != r
+	d.last = r
+	d.mu.Unlock()
+	if seek {
+		time.Sleep(d.Seek)
+	}
+	n, err := r.Reader.Read(p)
+	if err == io.EOF {
+		d.mu.Lock()
+		d.active--
+		d.mu.Unlock()
+	}
+	return n, err
+}
+
+func TestOptions_IOConcurrency(t *testing.T) {
+	src := t.TempDir()
+	for i := 0; i < 8; i++ {
+		Expect(t, ioutil.WriteFile(filepath.Join(src, fmt.Sprintf("file%d", i)), bytes.Repeat([]byte{byte(i)}, 64*1024), 0o644)).ToBe(nil)
+	}
+	disk := &SlowDisk{}
+	opt := Options{NumOfWorkers: 4, IOConcurrency: 1, CopyBufferSize: 1024, WrapReader: disk.Wrap}
+	dest := t.TempDir()
+	err := Copy(src, dest, opt)
+	Expect(t, err).ToBe(nil)
+	Expect(t, disk.MaxActive).ToBe(1)
+	for i := 0; i < 8; i++ {
+		b, err := ioutil.ReadFile(filepath.Join(dest, fmt.Sprintf("file%d", i)))
+		Expect(t, err).ToBe(nil)
+		Expect(t, len(b)).ToBe(64 * 1024)
+	}
+}
+
+func TestOptions_ChecksumManifest(t *testing.T) {
+	src := t.TempDir()
+	Expect(t, os.Mkdir(filepath.Join(src, "sub"), 0o755)).ToBe(nil)
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "sub", "hello"), []byte("hello\n"), 0o644)).ToBe(nil)
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "empty"), nil, 0o644)).ToBe(nil)
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "SHA256SUMS"), []byte("stale"), 0o644)).ToBe(nil)
+
+	dest := t.TempDir()
+	manifest := filepath.Join(dest, "SHA256SUMS")
+	err := Copy(src, dest, Options{ChecksumManifest: manifest, NumOfWorkers: 4})
+	Expect(t, err).ToBe(nil)
+	b, err := ioutil.ReadFile(manifest)
+	Expect(t, err).ToBe(nil)
+	Expect(t, string(b)).ToBe("" +
+		"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855  empty\n" +
+		"5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03  sub/hello\n",
+	)
+
+	When(t, "VerifyAndRollback is on", func(t *testing.T) {
+		dest := t.TempDir()
+		manifest := filepath.Join(t.TempDir(), "SHA256SUMS")
+		err := Copy(filepath.Join(src, "sub"), dest, Options{ChecksumManifest: manifest, VerifyAndRollback: true})
+		Expect(t, err).ToBe(nil)
+		b, err := ioutil.ReadFile(manifest)
+		Expect(t, err).ToBe(nil)
+		Expect(t, string(b)).ToBe("5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03  hello\n")
+	})
+}
+
+func TestOptions_TrailingSlashSemantics(t *testing.T) {
+	for _, c := range []struct {
+		src       string
+		semantics bool
+		expected  string
+	}{
+		{"test/data/case01", false, "README.md"},
+		{"test/data/case01/", false, "README.md"},
+		{"test/data/case01", true, "case01/README.md"},
+		{"test/data/case01/", true, "README.md"},
+		{"test/data/case01/README.md", true, "README.md"},
+	} {
+		dest := t.TempDir()
+		err := Copy(c.src, dest, Options{TrailingSlashSemantics: c.semantics})
+		Expect(t, err).ToBe(nil)
+		_, err = os.Stat(filepath.Join(dest, filepath.FromSlash(c.expected)))
+		Expect(t, err).ToBe(nil)
+	}
+
+	err := Copy("test/data/case01", t.TempDir(), Options{TrailingSlashSemantics: true, StripPrefix: "test"})
+	Expect(t, errors.Is(err, ErrConflictingOptions)).ToBe(true)
+
+	When(t, "src ends with . or ..", func(t *testing.T) {
+		src := t.TempDir()
+		Expect(t, os.MkdirAll(filepath.Join(src, "dir", "sub"), 0o755)).ToBe(nil)
+		Expect(t, ioutil.WriteFile(filepath.Join(src, "dir", "sub", "file"), []byte("file"), 0o644)).ToBe(nil)
+		for _, c := range []struct {
+			src      string
+			expected string
+		}{
+			{filepath.Join(src, "dir", "sub") + string(filepath.Separator) + ".", "sub/file"},
+			{filepath.Join(src, "dir", "sub") + string(filepath.Separator) + "..", "dir/sub/file"},
+		} {
+			parent := t.TempDir()
+			dest := filepath.Join(parent, "dest")
+			err := Copy(c.src, dest, Options{TrailingSlashSemantics: true})
+			Expect(t, err).ToBe(nil)
+			_, err = os.Stat(filepath.Join(dest, filepath.FromSlash(c.expected)))
+			Expect(t, err).ToBe(nil)
+			entries, err := ioutil.ReadDir(parent)
+			Expect(t, err).ToBe(nil)
+			Expect(t, len(entries)).ToBe(1)
+		}
+	})
+}
+
+func TestOptions_CoalesceDirMetadata(t *testing.T) {
+	src := t.TempDir()
+	Expect(t, os.MkdirAll(filepath.Join(src, "a", "b"), 0o755)).ToBe(nil)
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "a", "b", "file"), []byte("file"), 0o644)).ToBe(nil)
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, dir := range []string{filepath.Join(src, "a", "b"), filepath.Join(src, "a")} {
+		Expect(t, os.Chmod(dir, 0o555)).ToBe(nil)
+		Expect(t, os.Chtimes(dir, mtime, mtime)).ToBe(nil)
+	}
+	t.Cleanup(func() {
+		os.Chmod(filepath.Join(src, "a"), 0o755)
+		os.Chmod(filepath.Join(src, "a", "b"), 0o755)
+	})
+
+	dest := t.TempDir()
+	opt := Options{CoalesceDirMetadata: true, PreserveTimes: true, NumOfWorkers: 4}
+	err := Copy(src, dest, opt)
+	Expect(t, err).ToBe(nil)
+	t.Cleanup(func() {
+		os.Chmod(filepath.Join(dest, "a"), 0o755)
+		os.Chmod(filepath.Join(dest, "a", "b"), 0o755)
+	})
+	for _, dir := range []string{filepath.Join(dest, "a", "b"), filepath.Join(dest, "a")} {
+		info, err := os.Stat(dir)
+		Expect(t, err).ToBe(nil)
+		Expect(t, info.ModTime().Equal(mtime)).ToBe(true)
+		if runtime.GOOS != "windows" {
+			Expect(t, info.Mode().Perm()).ToBe(os.FileMode(0o555))
+		}
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dest, "a", "b", "file"))
+	Expect(t, err).ToBe(nil)
+	Expect(t, string(b)).ToBe("file")
+}
+
+func TestOptions_FilesCopied(t *testing.T) {
+	src := t.TempDir()
+	Expect(t, os.MkdirAll(filepath.Join(src, "a", "b"), 0o755)).ToBe(nil)
+	for _, name := range []string{"file", "a/file", "a/b/file"} {
+		Expect(t, ioutil.WriteFile(filepath.Join(src, filepath.FromSlash(name)), []byte(name), 0o644)).ToBe(nil)
+	}
+	var files, dirs, written int64
+	var progressed int64
+	opt := Options{
+		FilesCopied:  &files,
+		DirsCopied:   &dirs,
+		BytesWritten: &written,
+		NumOfWorkers: 4,
+		OnProgress: func(src, dest string, copied, total int64) {
+			atomic.AddInt64(&progressed, 1)
+		},
+	}
+	err := Copy(src, t.TempDir(), opt)
+	Expect(t, err).ToBe(nil)
+	Expect(t, files).ToBe(int64(3))
+	Expect(t, dirs).ToBe(int64(3))
+	Expect(t, written).ToBe(int64(4 + 6 + 8))
+	Expect(t, progressed >= 3).ToBe(true)
+
+	When(t, "VerifyAndRollback is on", func(t *testing.T) {
+		files, dirs = 0, 0
+		opt.VerifyAndRollback = true
+		err := Copy(src, t.TempDir(), opt)
+		Expect(t, err).ToBe(nil)
+		Expect(t, files).ToBe(int64(3))
+		Expect(t, dirs).ToBe(int64(3))
+	})
+}
+
+func TestCopyWithReport(t *testing.T) {
+	src := t.TempDir()
+	Expect(t, os.Mkdir(filepath.Join(src, "dir"), 0o755)).ToBe(nil)
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "dir", "file"), []byte("file"), 0o644)).ToBe(nil)
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "skipped"), []byte("skipped"), 0o644)).ToBe(nil)
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "broken"), []byte("broken"), 0o644)).ToBe(nil)
+	Expect(t, os.Symlink("dir", filepath.Join(src, "link"))).ToBe(nil)
+
+	var written int64
+	opt := Options{
+		BytesWritten: &written,
+		Skip: func(info os.FileInfo, src, dest string) (bool, error) {
+			return info.Name() == "skipped", nil
+		},
+		OnErrorAction: func(src, dest string, err error) ErrorAction {
+			return Ignore
+		},
+		PermissionControl: func(srcinfo fileInfo, dest string) (func(*error), error) {
+			if filepath.Base(dest) == "broken" {
+				return nil, errors.New("broken")
+			}
+			return PerservePermission(srcinfo, dest)
+		},
+	}
+	dest := t.TempDir()
+	report, err := CopyWithReport(src, dest, opt)
+	Expect(t, err).ToBe(nil)
+	Expect(t, report.Bytes).ToBe(int64(4))
+	Expect(t, written).ToBe(int64(4))
+	Expect(t, report.Files).ToBe(int64(1))
+	Expect(t, report.Dirs).ToBe(int64(2))
+	Expect(t, report.Symlinks).ToBe(int64(1))
+	Expect(t, report.Skipped).ToBe([]string{filepath.Join(src, "skipped")})
+	Expect(t, len(report.Errors)).ToBe(1)
+	Expect(t, report.Errors[0].Src).ToBe(filepath.Join(src, "broken"))
+	Expect(t, report.Errors[0].Err.Error()).ToBe("broken")
+	Expect(t, report.Elapsed > 0).ToBe(true)
+}
+
+func TestOptions_ConfirmDelete(t *testing.T) {
+	src := t.TempDir()
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "file"), []byte("file"), 0o644)).ToBe(nil)
+	dest := t.TempDir()
+	Expect(t, ioutil.WriteFile(filepath.Join(dest, "keep"), []byte("keep"), 0o644)).ToBe(nil)
+	Expect(t, os.Mkdir(filepath.Join(dest, "delete"), 0o755)).ToBe(nil)
+
+	asked := []string{}
+	opt := Options{
+		Mirror: true,
+		ConfirmDelete: func(dest string) (bool, error) {
+			asked = append(asked, filepath.Base(dest))
+			return filepath.Base(dest) == "delete", nil
+		},
+	}
+	err := Copy(src, dest, opt)
+	Expect(t, err).ToBe(nil)
+	Expect(t, asked).ToBe([]string{"delete", "keep"})
+	_, err = os.Stat(filepath.Join(dest, "keep"))
+	Expect(t, err).ToBe(nil)
+	_, err = os.Stat(filepath.Join(dest, "delete"))
+	Expect(t, os.IsNotExist(err)).ToBe(true)
+
+	When(t, "it returns an error", func(t *testing.T) {
+		opt.ConfirmDelete = func(dest string) (bool, error) {
+			return false, errors.New("denied")
+		}
+		err := Copy(src, dest, opt)
+		Expect(t, err).Not().ToBe(nil)
+		Expect(t, err.Error()).ToBe("denied")
+	})
+}
+
+func TestOptions_SkipUnchanged(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "file")
+	Expect(t, ioutil.WriteFile(src, []byte("source"), 0o644)).ToBe(nil)
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	Expect(t, os.Chtimes(src, mtime, mtime)).ToBe(nil)
+
+	dest := filepath.Join(t.TempDir(), "file")
+	// Same size and mtime, but different content.
+	Expect(t, ioutil.WriteFile(dest, []byte("stale!"), 0o644)).ToBe(nil)
+	Expect(t, os.Chtimes(dest, mtime, mtime)).ToBe(nil)
+
+	opt := Options{SkipUnchanged: true, PreserveTimes: true}
+	ops, err := Plan(src, dest, opt)
+	Expect(t, err).ToBe(nil)
+	Expect(t, ops[0].Reason).ToBe("unchanged")
+	err = Copy(src, dest, opt)
+	Expect(t, err).ToBe(nil)
+	b, err := ioutil.ReadFile(dest)
+	Expect(t, err).ToBe(nil)
+	Expect(t, string(b)).ToBe("stale!")
+
+	When(t, "mtime is different", func(t *testing.T) {
+		Expect(t, os.Chtimes(dest, mtime, mtime.Add(time.Hour))).ToBe(nil)
+		err := Copy(src, dest, opt)
+		Expect(t, err).ToBe(nil)
+		b, err := ioutil.ReadFile(dest)
+		Expect(t, err).ToBe(nil)
+		Expect(t, string(b)).ToBe("source")
+	})
+}
+
+func TestOptions_CompareByHash(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "file")
+	Expect(t, ioutil.WriteFile(src, []byte("content"), 0o644)).ToBe(nil)
+	dest := filepath.Join(t.TempDir(), "file")
+	Expect(t, ioutil.WriteFile(dest, []byte("content"), 0o600)).ToBe(nil)
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	Expect(t, os.Chtimes(dest, mtime, mtime)).ToBe(nil)
+
+	err := Copy(src, dest, Options{CompareByHash: true})
+	Expect(t, err).ToBe(nil)
+	info, err := os.Stat(dest)
+	Expect(t, err).ToBe(nil)
+	Expect(t, info.ModTime().Equal(mtime)).ToBe(true)
+
+	When(t, "Hasher is given", func(t *testing.T) {
+		Expect(t, ioutil.WriteFile(src, []byte("changed"), 0o644)).ToBe(nil)
+		hashed := 0
+		opt := Options{CompareByHash: true, Hasher: func() hash.Hash {
+			hashed++
+			return fnv.New64a()
+		}}
+		err := Copy(src, dest, opt)
+		Expect(t, err).ToBe(nil)
+		Expect(t, hashed).ToBe(2)
+		b, err := ioutil.ReadFile(dest)
+		Expect(t, err).ToBe(nil)
+		Expect(t, string(b)).ToBe("changed")
+	})
+}
+
+func TestOptions_Verify(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "file")
+	Expect(t, ioutil.WriteFile(src, []byte("content"), 0o644)).ToBe(nil)
+	err := Copy(src, filepath.Join(t.TempDir(), "file"), Options{Verify: true})
+	Expect(t, err).ToBe(nil)
+
+	corrupt := func(r io.Reader) io.Reader { return &CorruptingReader{r} }
+	err = Copy(src, filepath.Join(t.TempDir(), "file"), Options{Verify: true, WrapReader: corrupt})
+	Expect(t, errors.Is(err, ErrVerifyMismatch)).ToBe(true)
+	var mismatch *VerifyMismatchError
+	Expect(t, errors.As(err, &mismatch)).ToBe(true)
+	Expect(t, mismatch.Offset).ToBe(int64(0))
+
+	When(t, "CompareByHash is on", func(t *testing.T) {
+		err := Copy(src, filepath.Join(t.TempDir(), "file"), Options{Verify: true, CompareByHash: true, WrapReader: corrupt})
+		Expect(t, errors.Is(err, ErrVerifyMismatch)).ToBe(true)
+		Expect(t, errors.As(err, &mismatch)).ToBe(true)
+		Expect(t, mismatch.Offset).ToBe(int64(-1))
+	})
+
+	When(t, "LineTransform is given", func(t *testing.T) {
+		err := Copy(src, filepath.Join(t.TempDir(), "file"), Options{Verify: true, LineTransform: func(src string, line []byte) []byte { return line }})
+		Expect(t, errors.Is(err, ErrConflictingOptions)).ToBe(true)
+	})
+}
+
+func TestOptions_Resume(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 10000)
+	src := filepath.Join(t.TempDir(), "file")
+	Expect(t, ioutil.WriteFile(src, content, 0o444)).ToBe(nil)
+
+	dest := filepath.Join(t.TempDir(), "file")
+	Expect(t, ioutil.WriteFile(dest+".part", content[:40000], 0o444)).ToBe(nil)
+	var written int64
+	err := Copy(src, dest, Options{Resume: true, BytesWritten: &written})
+	Expect(t, err).ToBe(nil)
+	Expect(t, written).ToBe(int64(len(content) - 40000))
+	b, err := ioutil.ReadFile(dest)
+	Expect(t, err).ToBe(nil)
+	Expect(t, bytes.Equal(b, content)).ToBe(true)
+	info, err := os.Stat(dest)
+	Expect(t, err).ToBe(nil)
+	Expect(t, info.Mode().Perm()).ToBe(os.FileMode(0o444))
+	_, err = os.Stat(dest + ".part")
+	Expect(t, os.IsNotExist(err)).ToBe(true)
+
+	When(t, "the partial file doesn't match src", func(t *testing.T) {
+		dest := filepath.Join(t.TempDir(), "file")
+		Expect(t, ioutil.WriteFile(dest+"~", []byte("corrupted"), 0o644)).ToBe(nil)
+		var written int64
+		err := Copy(src, dest, Options{Resume: true, ResumeSuffix: "~", BytesWritten: &written})
+		Expect(t, err).ToBe(nil)
+		Expect(t, written).ToBe(int64(len(content)))
+		b, err := ioutil.ReadFile(dest)
+		Expect(t, err).ToBe(nil)
+		Expect(t, bytes.Equal(b, content)).ToBe(true)
+	})
+
+	When(t, "AppendMode is given", func(t *testing.T) {
+		err := Copy(src, filepath.Join(t.TempDir(), "file"), Options{Resume: true, AppendMode: true})
+		Expect(t, errors.Is(err, ErrConflictingOptions)).ToBe(true)
+	})
+}
+
+func TestOptions_Atomic(t *testing.T) {
+	src := t.TempDir()
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "critical.conf"), []byte("new content"), 0o600)).ToBe(nil)
+	dest := t.TempDir()
+	Expect(t, ioutil.WriteFile(filepath.Join(dest, "critical.conf"), []byte("old content"), 0o644)).ToBe(nil)
+
+	err := Copy(src, dest, Options{Atomic: true, SyncMode: SyncPerFile})
+	Expect(t, err).ToBe(nil)
+	b, err := ioutil.ReadFile(filepath.Join(dest, "critical.conf"))
+	Expect(t, err).ToBe(nil)
+	Expect(t, string(b)).ToBe("new content")
+
+	When(t, "copying fails halfway", func(t *testing.T) {
+		dest := t.TempDir()
+		Expect(t, ioutil.WriteFile(filepath.Join(dest, "critical.conf"), []byte("old content"), 0o644)).ToBe(nil)
+		broken := func(r io.Reader) io.Reader {
+			return io.MultiReader(io.LimitReader(r, 3), &ErrorReader{err: io.ErrUnexpectedEOF})
+		}
+		err := Copy(src, dest, Options{Atomic: true, WrapReader: broken})
+		Expect(t, errors.Is(err, io.ErrUnexpectedEOF)).ToBe(true)
+		b, err := ioutil.ReadFile(filepath.Join(dest, "critical.conf"))
+		Expect(t, err).ToBe(nil)
+		Expect(t, string(b)).ToBe("old content")
+		entries, err := ioutil.ReadDir(dest)
+		Expect(t, err).ToBe(nil)
+		Expect(t, len(entries)).ToBe(1)
+	})
+
+	When(t, "Verify is also given", func(t *testing.T) {
+		dest := t.TempDir()
+		Expect(t, ioutil.WriteFile(filepath.Join(dest, "critical.conf"), []byte("old content"), 0o644)).ToBe(nil)
+		corrupt := func(r io.Reader) io.Reader { return &CorruptingReader{r} }
+		err := Copy(src, dest, Options{Atomic: true, Verify: true, WrapReader: corrupt})
+		Expect(t, errors.Is(err, ErrVerifyMismatch)).ToBe(true)
+		b, err := ioutil.ReadFile(filepath.Join(dest, "critical.conf"))
+		Expect(t, err).ToBe(nil)
+		Expect(t, string(b)).ToBe("old content")
+	})
+}
+
+func TestOptions_ErrorPolicy(t *testing.T) {
+	src := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", filepath.Join("c", "d.txt")} {
+		Expect(t, os.MkdirAll(filepath.Dir(filepath.Join(src, name)), 0o755)).ToBe(nil)
+		Expect(t, ioutil.WriteFile(filepath.Join(src, name), []byte(name), 0o644)).ToBe(nil)
+	}
+	// A directory in the way of b.txt makes it fail to copy.
+	dest := t.TempDir()
+	Expect(t, os.MkdirAll(filepath.Join(dest, "b.txt", "x"), 0o755)).ToBe(nil)
+
+	err := Copy(src, dest, Options{ErrorPolicy: ContinueAndCollect})
+	var collected *CollectedErrors
+	Expect(t, errors.As(err, &collected)).ToBe(true)
+	Expect(t, collected.Paths()).ToBe([]string{filepath.Join(src, "b.txt")})
+	var perr *os.PathError
+	Expect(t, errors.As(err, &perr)).ToBe(true)
+	// Not by Unwrap() []error, which errors.As ignores before Go 1.20.
+	perr = nil
+	Expect(t, collected.As(&perr)).ToBe(true)
+	Expect(t, collected.Is(perr)).ToBe(true)
+	for _, name := range []string{"a.txt", filepath.Join("c", "d.txt")} {
+		b, err := ioutil.ReadFile(filepath.Join(dest, name))
+		Expect(t, err).ToBe(nil)
+		Expect(t, string(b)).ToBe(name)
+	}
+
+	When(t, "FailFast by default", func(t *testing.T) {
+		err := Copy(src, dest)
+		Expect(t, err).Not().ToBe(nil)
+		Expect(t, errors.As(err, &collected)).ToBe(false)
+	})
+
+	When(t, "OnError is given", func(t *testing.T) {
+		err := Copy(src, dest, Options{ErrorPolicy: ContinueAndCollect, OnError: func(src, dest string, err error) error { return nil }})
+		Expect(t, errors.Is(err, ErrConflictingOptions)).ToBe(true)
+	})
+}
+
+func TestOptions_Retry(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "file")
+	Expect(t, ioutil.WriteFile(src, []byte("content"), 0o644)).ToBe(nil)
+	transient := errors.New("transient")
+	// flaky fails the first n times it's read.
+	flaky := func(n int) (func(io.Reader) io.Reader, *int) {
+		calls := 0
+		return func(r io.Reader) io.Reader {
+			calls++
+			if calls <= n {
+				return &ErrorReader{err: transient}
+			}
+			return r
+		}, &calls
+	}
+
+	wrap, calls := flaky(2)
+	dest := filepath.Join(t.TempDir(), "file")
+	start := time.Now()
+	err := Copy(src, dest, Options{WrapReader: wrap, Retry: RetryPolicy{Attempts: 2, Backoff: 10 * time.Millisecond}})
+	Expect(t, err).ToBe(nil)
+	Expect(t, *calls).ToBe(3)
+	Expect(t, time.Since(start) >= 30*time.Millisecond).ToBe(true)
+	b, err := ioutil.ReadFile(dest)
+	Expect(t, err).ToBe(nil)
+	Expect(t, string(b)).ToBe("content")
+
+	When(t, "attempts run out", func(t *testing.T) {
+		wrap, calls := flaky(2)
+		err := Copy(src, filepath.Join(t.TempDir(), "file"), Options{WrapReader: wrap, Retry: RetryPolicy{Attempts: 1}})
+		Expect(t, errors.Is(err, transient)).ToBe(true)
+		Expect(t, *calls).ToBe(2)
+	})
+
+	When(t, "RetryIf rejects the error", func(t *testing.T) {
+		wrap, calls := flaky(2)
+		retryIf := func(err error) bool { return !errors.Is(err, transient) }
+		err := Copy(src, filepath.Join(t.TempDir(), "file"), Options{WrapReader: wrap, Retry: RetryPolicy{Attempts: 3, RetryIf: retryIf}})
+		Expect(t, errors.Is(err, transient)).ToBe(true)
+		Expect(t, *calls).ToBe(1)
+	})
+
+	When(t, "AppendMode is given", func(t *testing.T) {
+		src := filepath.Join(t.TempDir(), "file")
+		Expect(t, ioutil.WriteFile(src, []byte("abcdef"), 0o644)).ToBe(nil)
+		dest := filepath.Join(t.TempDir(), "file")
+		Expect(t, ioutil.WriteFile(dest, []byte("OLD"), 0o644)).ToBe(nil)
+		calls := 0
+		partial := func(r io.Reader) io.Reader {
+			if calls++; calls == 1 {
+				return io.MultiReader(io.LimitReader(r, 3), &ErrorReader{err: transient})
+			}
+			return r
+		}
+		err := Copy(src, dest, Options{AppendMode: true, WrapReader: partial, Retry: RetryPolicy{Attempts: 1}})
+		Expect(t, err).ToBe(nil)
+		b, err := ioutil.ReadFile(dest)
+		Expect(t, err).ToBe(nil)
+		Expect(t, string(b)).ToBe("OLDabcdef")
+	})
+}
+
+func TestOptions_Exclude(t *testing.T) {
+	src := t.TempDir()
+	for _, name := range []string{
+		"main.go", "debug.log", "node_modules/lib/index.js",
+		"web/node_modules/x.js", "web/app.js", "build/out.bin", "docs/build/index.md",
+	} {
+		Expect(t, os.MkdirAll(filepath.Dir(filepath.Join(src, name)), 0o755)).ToBe(nil)
+		Expect(t, ioutil.WriteFile(filepath.Join(src, name), []byte(name), 0o644)).ToBe(nil)
+	}
+	exists := func(dest, name string) bool {
+		_, err := os.Stat(filepath.Join(dest, filepath.FromSlash(name)))
+		return err == nil
+	}
+
+	dest := t.TempDir()
+	err := Copy(src, dest, Options{Exclude: []string{"node_modules/", "*.log", "/build"}})
+	Expect(t, err).ToBe(nil)
+	Expect(t, exists(dest, "main.go")).ToBe(true)
+	Expect(t, exists(dest, "web/app.js")).ToBe(true)
+	Expect(t, exists(dest, "docs/build/index.md")).ToBe(true)
+	Expect(t, exists(dest, "debug.log")).ToBe(false)
+	Expect(t, exists(dest, "node_modules")).ToBe(false)
+	Expect(t, exists(dest, "web/node_modules")).ToBe(false)
+	Expect(t, exists(dest, "build")).ToBe(false)
+
+	When(t, "Include is given", func(t *testing.T) {
+		dest := t.TempDir()
+		err := Copy(src, dest, Options{Include: []string{"**/*.js"}, Exclude: []string{"node_modules/"}})
+		Expect(t, err).ToBe(nil)
+		Expect(t, exists(dest, "web/app.js")).ToBe(true)
+		Expect(t, exists(dest, "main.go")).ToBe(false)
+		Expect(t, exists(dest, "web/node_modules/x.js")).ToBe(false)
+		Expect(t, exists(dest, "docs/build/index.md")).ToBe(false)
+	})
+
+	When(t, "a pattern is malformed", func(t *testing.T) {
+		err := Copy(src, t.TempDir(), Options{Exclude: []string{"[a-"}})
+		Expect(t, errors.Is(err, path.ErrBadPattern)).ToBe(true)
+	})
+}
+
+func TestOptions_IgnoreFileName(t *testing.T) {
+	src := t.TempDir()
+	for name, content := range map[string]string{
+		".copyignore":        "# logs\n*.log\n!keep.log\nbuild/\n",
+		"a.log":              "a",
+		"keep.log":           "keep",
+		"build/out.bin":      "out",
+		"sub/.copyignore":    "/local.txt\n",
+		"sub/local.txt":      "local",
+		"sub/deep/local.txt": "deep",
+		"sub/deep/trace.log": "trace",
+		"other/local.txt":    "other",
+		"other/build.txt":    "build",
+	} {
+		Expect(t, os.MkdirAll(filepath.Dir(filepath.Join(src, name)), 0o755)).ToBe(nil)
+		Expect(t, ioutil.WriteFile(filepath.Join(src, name), []byte(content), 0o644)).ToBe(nil)
+	}
+	exists := func(dest, name string) bool {
+		_, err := os.Stat(filepath.Join(dest, filepath.FromSlash(name)))
+		return err == nil
+	}
+
+	dest := t.TempDir()
+	err := Copy(src, dest, Options{IgnoreFileName: ".copyignore"})
+	Expect(t, err).ToBe(nil)
+	for name, want := range map[string]bool{
+		"a.log": false, "keep.log": true, "build": false,
+		"sub/local.txt": false, "sub/deep/local.txt": true, "sub/deep/trace.log": false,
+		"other/local.txt": true, "other/build.txt": true,
+	} {
+		Expect(t, exists(dest, name)).ToBe(want)
+	}
+
+	When(t, "IgnoreFile is given", func(t *testing.T) {
+		ignore := filepath.Join(t.TempDir(), "ignore")
+		Expect(t, ioutil.WriteFile(ignore, []byte("other/\n"), 0o644)).ToBe(nil)
+		dest := t.TempDir()
+		err := Copy(src, dest, Options{IgnoreFile: ignore})
+		Expect(t, err).ToBe(nil)
+		Expect(t, exists(dest, "other")).ToBe(false)
+		Expect(t, exists(dest, "a.log")).ToBe(true)
+	})
+}
+
+func TestOptions_SkipDir(t *testing.T) {
+	src := t.TempDir()
+	for _, name := range []string{".git/HEAD", ".git/objects/ab/cdef", "main.go", "pkg/lib.go"} {
+		Expect(t, os.MkdirAll(filepath.Dir(filepath.Join(src, name)), 0o755)).ToBe(nil)
+		Expect(t, ioutil.WriteFile(filepath.Join(src, name), []byte(name), 0o644)).ToBe(nil)
+	}
+	var dirs, skipped []string
+	dest := t.TempDir()
+	err := Copy(src, dest, Options{
+		SkipDir: func(entry fs.DirEntry, src, dest string) (bool, error) {
+			Expect(t, entry.IsDir()).ToBe(true)
+			dirs = append(dirs, entry.Name())
+			return entry.Name() == ".git", nil
+		},
+		Skip: func(info os.FileInfo, src, dest string) (bool, error) {
+			skipped = append(skipped, info.Name())
+			return false, nil
+		},
+	})
+	Expect(t, err).ToBe(nil)
+	sort.Strings(dirs)
+	sort.Strings(skipped)
+	Expect(t, dirs).ToBe([]string{".git", "pkg"})
+	Expect(t, skipped).ToBe([]string{"lib.go", "main.go", "pkg"})
+	_, err = os.Stat(filepath.Join(dest, ".git"))
+	Expect(t, os.IsNotExist(err)).ToBe(true)
+	_, err = os.Stat(filepath.Join(dest, "pkg", "lib.go"))
+	Expect(t, err).ToBe(nil)
+}
+
+func TestOptions_SkipEntry(t *testing.T) {
+	src := t.TempDir()
+	for _, name := range []string{"a.txt", "b.tmp", "sub/c.tmp", "sub/d.txt"} {
+		Expect(t, os.MkdirAll(filepath.Dir(filepath.Join(src, name)), 0o755)).ToBe(nil)
+		Expect(t, ioutil.WriteFile(filepath.Join(src, name), []byte(name), 0o644)).ToBe(nil)
+	}
+	dest := t.TempDir()
+	Expect(t, ioutil.WriteFile(filepath.Join(dest, "b.tmp"), []byte("kept"), 0o644)).ToBe(nil)
+
+	var entries []string
+	err := Copy(src, dest, Options{
+		Mirror: true,
+		SkipEntry: func(entry fs.DirEntry, src, dest string) (bool, error) {
+			entries = append(entries, entry.Name())
+			return filepath.Ext(src) == ".tmp", nil
+		},
+	})
+	Expect(t, err).ToBe(nil)
+	sort.Strings(entries)
+	Expect(t, entries).ToBe([]string{"a.txt", "b.tmp", "c.tmp", "d.txt", "sub"})
+	_, err = os.Stat(filepath.Join(dest, "sub", "c.tmp"))
+	Expect(t, os.IsNotExist(err)).ToBe(true)
+	_, err = os.Stat(filepath.Join(dest, "sub", "d.txt"))
+	Expect(t, err).ToBe(nil)
+	b, err := ioutil.ReadFile(filepath.Join(dest, "b.tmp"))
+	Expect(t, err).ToBe(nil)
+	Expect(t, string(b)).ToBe("kept")
+}
+
+func TestOptions_ParallelChunkSize(t *testing.T) {
+	content := make([]byte, 1<<20+123)
+	for i := range content {
+		content[i] = byte(i * 7)
+	}
+	src := filepath.Join(t.TempDir(), "large")
+	Expect(t, ioutil.WriteFile(src, content, 0o644)).ToBe(nil)
+
+	var written int64
+	dest := filepath.Join(t.TempDir(), "large")
+	err := Copy(src, dest, Options{ParallelChunkSize: 64 * 1024, NumOfWorkers: 4, CopyBufferSize: 4096, BytesWritten: &written})
+	Expect(t, err).ToBe(nil)
+	Expect(t, written).ToBe(int64(len(content)))
+	b, err := ioutil.ReadFile(dest)
+	Expect(t, err).ToBe(nil)
+	Expect(t, bytes.Equal(b, content)).ToBe(true)
+
+	When(t, "AppendMode is given", func(t *testing.T) {
+		err := Copy(src, dest, Options{ParallelChunkSize: 64 * 1024, NumOfWorkers: 4, AppendMode: true})
+		Expect(t, errors.Is(err, ErrConflictingOptions)).ToBe(true)
+	})
+}
+
+// MemFS is a WriteFS on memory for tests.
+type MemFS struct {
+	mu      sync.Mutex
+	Dirs    map[string]os.FileMode
+	Files   map[string]*MemFile
+	Links   map[string]string
+	ModTime map[string]time.Time
+}
+
+type MemFile struct {
+	bytes.Buffer
+	Mode os.FileMode
+}
+
+func (f *MemFile) Close() error { return nil }
+
+func NewMemFS() *MemFS {
+	return &MemFS{Dirs: map[string]os.FileMode{}, Files: map[string]*MemFile{}, Links: map[string]string{}, ModTime: map[string]time.Time{}}
+}
+
+func (m *MemFS) MkdirAll(name string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for dir := name; dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		if _, ok := m.Dirs[dir]; !ok {
+			m.Dirs[dir] = perm
+		}
+	}
+	return nil
+}
+
+func (m *MemFS) Create(name string) (io.WriteCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.Dirs[filepath.Dir(name)]; !ok {
+		return nil, &os.PathError{Op: "create", Path: name, Err: os.ErrNotExist}
+	}
+	m.Files[name] = &MemFile{Mode: 0o666}
+	return m.Files[name], nil
+}
+
+func (m *MemFS) Symlink(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Links[newname] = oldname
+	return nil
+}
+
+func (m *MemFS) Chmod(name string, mode fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if f, ok := m.Files[name]; ok {
+		f.Mode = mode
+	} else {
+		m.Dirs[name] = mode
+	}
+	return nil
+}
+
+func (m *MemFS) Chtimes(name string, atime, mtime time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ModTime[name] = mtime
+	return nil
+}
+
+func TestOptions_DestFS(t *testing.T) {
+	src := t.TempDir()
+	Expect(t, os.MkdirAll(filepath.Join(src, "sub"), 0o750)).ToBe(nil)
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "sub", "file"), []byte("content"), 0o600)).ToBe(nil)
+	Expect(t, os.Symlink("sub/file", filepath.Join(src, "link"))).ToBe(nil)
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	Expect(t, os.Chtimes(filepath.Join(src, "sub", "file"), mtime, mtime)).ToBe(nil)
+
+	mem := NewMemFS()
+	dest := filepath.Join(t.TempDir(), "dest")
+	err := Copy(src, dest, Options{DestFS: mem, PreserveTimes: true, NumOfWorkers: 2})
+	Expect(t, err).ToBe(nil)
+	file := mem.Files[filepath.Join(dest, "sub", "file")]
+	Expect(t, file.String()).ToBe("content")
+	Expect(t, file.Mode).ToBe(os.FileMode(0o600))
+	Expect(t, mem.Dirs[filepath.Join(dest, "sub")]).ToBe(os.FileMode(0o750))
+	Expect(t, mem.Links[filepath.Join(dest, "link")]).ToBe("sub/file")
+	Expect(t, mem.ModTime[filepath.Join(dest, "sub", "file")].Equal(mtime)).ToBe(true)
+	_, err = os.Stat(dest)
+	Expect(t, os.IsNotExist(err)).ToBe(true)
+
+	When(t, "an option needs the dest on the OS filesystem", func(t *testing.T) {
+		err := Copy(src, dest, Options{DestFS: NewMemFS(), Mirror: true})
+		Expect(t, errors.Is(err, ErrConflictingOptions)).ToBe(true)
+	})
+}
+
+func TestOptions_FS_Symlinks(t *testing.T) {
+	src := t.TempDir()
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "file"), []byte("content"), 0o644)).ToBe(nil)
+	Expect(t, os.Symlink("file", filepath.Join(src, "link"))).ToBe(nil)
+	fsys := os.DirFS(src)
+	if _, ok := fsys.(ReadLinkFS); !ok {
+		t.Skip("os.DirFS can't read symlinks before Go 1.25")
+	}
+
+	dest := t.TempDir()
+	err := Copy(".", dest, Options{FS: fsys, OnSymlink: func(string) SymlinkAction { return Shallow }})
+	Expect(t, err).ToBe(nil)
+	target, err := os.Readlink(filepath.Join(dest, "link"))
+	Expect(t, err).ToBe(nil)
+	Expect(t, target).ToBe("file")
+
+	When(t, "OnSymlink says Deep", func(t *testing.T) {
+		dest := t.TempDir()
+		err := Copy(".", dest, Options{FS: fsys, OnSymlink: func(string) SymlinkAction { return Deep }})
+		Expect(t, err).ToBe(nil)
+		b, err := ioutil.ReadFile(filepath.Join(dest, "link"))
+		Expect(t, err).ToBe(nil)
+		Expect(t, string(b)).ToBe("content")
+	})
+
+	When(t, "FS can't read symlinks", func(t *testing.T) {
+		fsys := struct{ fs.FS }{fsys}
+		dest := t.TempDir()
+		err := Copy(".", dest, Options{FS: fsys, OnSymlink: func(string) SymlinkAction { return Shallow }})
+		Expect(t, err).ToBe(nil)
+		info, err := os.Lstat(filepath.Join(dest, "link"))
+		Expect(t, err).ToBe(nil)
+		Expect(t, info.Mode().IsRegular()).ToBe(true)
+
+		dest = t.TempDir()
+		err = Copy(".", dest, Options{FS: fsys, FSSymlinkFallback: Skip})
+		Expect(t, err).ToBe(nil)
+		_, err = os.Lstat(filepath.Join(dest, "link"))
+		Expect(t, os.IsNotExist(err)).ToBe(true)
+	})
+}
@@ -0,0 +1,412 @@
+package copy
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CopyFromArchive extracts a tar or zip archive read from r into dest,
+// through the same way as Copy, so that Skip, OnDirExists,
+// permissions and the other options are respected as well.
+// Entries named outside dest, such as "../x" or "/x", are ErrUnsafeArchivePath,
+// and symlinks pointing outside the archive are ErrUnsafeSymlinkTarget.
+// Zip is detected by its signature, and anything else is read as tar.
+// If r is an io.ReaderAt with its size known, such as *os.File or *bytes.Reader,
+// contents are read from r on demand; otherwise they are held in memory.
+func CopyFromArchive(r io.Reader, dest string, opts ...Options) error {
+	opt := Options{}
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	if opt.FS != nil {
+		return fmt.Errorf("%w: CopyFromArchive and FS", ErrConflictingOptions)
+	}
+	archive, err := openArchive(r)
+	if err != nil {
+		return err
+	}
+	opt.FS = archive
+	return Copy(".", dest, opt)
+}
+
+// archiveFS is a ReadLinkFS of the entries in an archive.
+type archiveFS struct {
+	root *archiveEntry
+}
+
+// archiveEntry is an entry in an archive, which is its own FileInfo.
+type archiveEntry struct {
+	name    string
+	mode    fs.FileMode
+	size    int64
+	modTime time.Time
+
+	// link is the target, only for a symlink.
+	link string
+	// open opens the content, only for a regular file.
+	open func() (io.ReadCloser, error)
+	// children are the entries in it, only for a directory.
+	children map[string]*archiveEntry
+}
+
+func (e *archiveEntry) Name() string       { return e.name }
+func (e *archiveEntry) Size() int64        { return e.size }
+func (e *archiveEntry) Mode() fs.FileMode  { return e.mode }
+func (e *archiveEntry) ModTime() time.Time { return e.modTime }
+func (e *archiveEntry) IsDir() bool        { return e.mode.IsDir() }
+func (e *archiveEntry) Sys() interface{}   { return nil }
+
+// archiveFile is an opened entry.
+type archiveFile struct {
+	io.ReadCloser
+	entry *archiveEntry
+}
+
+func (f *archiveFile) Stat() (fs.FileInfo, error) { return f.entry, nil }
+
+// archiveDir is an opened directory, which can't be read as a file.
+type archiveDir struct {
+	entry *archiveEntry
+}
+
+func (d *archiveDir) Stat() (fs.FileInfo, error) { return d.entry, nil }
+func (d *archiveDir) Close() error               { return nil }
+func (d *archiveDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.entry.name, Err: fs.ErrInvalid}
+}
+
+// openArchive reads the entries of the tar or zip archive from r.
+func openArchive(r io.Reader) (*archiveFS, error) {
+	if ra, ok := r.(io.ReaderAt); ok {
+		if size, ok := readerSize(r); ok {
+			magic := make([]byte, 4)
+			if _, err := ra.ReadAt(magic, 0); err == nil && isZip(magic) {
+				return readZip(ra, size)
+			}
+			return readTar(io.NewSectionReader(ra, 0, size), ra)
+		}
+	}
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(4); err == nil && isZip(magic) {
+		b, err := ioutil.ReadAll(br)
+		if err != nil {
+			return nil, err
+		}
+		return readZip(bytes.NewReader(b), int64(len(b)))
+	}
+	return readTar(br, nil)
+}
+
+// readerSize returns the size of r, if known.
+func readerSize(r io.Reader) (int64, bool) {
+	switch r := r.(type) {
+	case interface{ Size() int64 }:
+		return r.Size(), true
+	case interface{ Stat() (os.FileInfo, error) }:
+		if info, err := r.Stat(); err == nil && info.Mode().IsRegular() {
+			return info.Size(), true
+		}
+	}
+	return 0, false
+}
+
+func isZip(magic []byte) bool {
+	return bytes.Equal(magic, []byte("PK\x03\x04")) || bytes.Equal(magic, []byte("PK\x05\x06"))
+}
+
+// readTar reads the entries of the tar archive from r.
+// If ra is given, r must be an io.SectionReader of it,
+// so that contents can be read from ra by their offsets.
+func readTar(r io.Reader, ra io.ReaderAt) (*archiveFS, error) {
+	archive := newArchiveFS()
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return archive, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		e := &archiveEntry{mode: hdr.FileInfo().Mode(), size: hdr.Size, modTime: hdr.ModTime}
+		switch {
+		case hdr.Typeflag == tar.TypeLink:
+			target, err := archive.lookup(path.Clean(hdr.Linkname), false)
+			if err != nil {
+				return nil, &fs.PathError{Op: "link", Path: hdr.Name, Err: err}
+			}
+			if !target.mode.IsRegular() {
+				return nil, &fs.PathError{Op: "link", Path: hdr.Name, Err: fs.ErrInvalid}
+			}
+			e.size, e.open = target.size, target.open
+		case e.mode.IsDir():
+			e.children = map[string]*archiveEntry{}
+		case e.mode&fs.ModeSymlink != 0:
+			e.link, e.size = hdr.Linkname, int64(len(hdr.Linkname))
+		case e.mode.IsRegular() && ra != nil && !tarSparse(hdr):
+			offset, err := r.(io.Seeker).Seek(0, io.SeekCurrent)
+			if err != nil {
+				return nil, err
+			}
+			section := io.NewSectionReader(ra, offset, hdr.Size)
+			e.open = func() (io.ReadCloser, error) {
+				return ioutil.NopCloser(io.NewSectionReader(section, 0, section.Size())), nil
+			}
+		case e.mode.IsRegular():
+			b, err := ioutil.ReadAll(tr)
+			if err != nil {
+				return nil, err
+			}
+			e.size = int64(len(b))
+			e.open = func() (io.ReadCloser, error) { return ioutil.NopCloser(bytes.NewReader(b)), nil }
+		default:
+			continue // Devices and the like can't be extracted safely.
+		}
+		if err := archive.add(hdr.Name, e); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// tarSparse reports whether the entry is a sparse file,
+// whose content is not stored as it is.
+func tarSparse(hdr *tar.Header) bool {
+	if hdr.Typeflag == tar.TypeGNUSparse {
+		return true
+	}
+	for key := range hdr.PAXRecords {
+		if strings.HasPrefix(key, "GNU.sparse.") {
+			return true
+		}
+	}
+	return false
+}
+
+// readZip reads the entries of the zip archive from ra.
+func readZip(ra io.ReaderAt, size int64) (*archiveFS, error) {
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return nil, err
+	}
+	archive := newArchiveFS()
+	for _, f := range zr.File {
+		f := f
+		e := &archiveEntry{mode: f.Mode(), size: int64(f.UncompressedSize64), modTime: f.Modified}
+		switch {
+		case e.mode.IsDir():
+			e.children = map[string]*archiveEntry{}
+		case e.mode&fs.ModeSymlink != 0:
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			b, err := ioutil.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				return nil, err
+			}
+			e.link = string(b)
+		case e.mode.IsRegular():
+			e.open = func() (io.ReadCloser, error) { return f.Open() }
+		default:
+			continue
+		}
+		if err := archive.add(f.Name, e); err != nil {
+			return nil, err
+		}
+	}
+	return archive, nil
+}
+
+func newArchiveFS() *archiveFS {
+	return &archiveFS{root: &archiveEntry{name: ".", mode: fs.ModeDir | 0o755, children: map[string]*archiveEntry{}}}
+}
+
+// add puts e at name, creating the parent directories if not given yet.
+// As extracting one by one, the later entry wins over the same name,
+// and a directory wins over a symlink in the middle of the name,
+// so that nothing would be extracted through a symlink.
+func (a *archiveFS) add(name string, e *archiveEntry) error {
+	clean := path.Clean(strings.TrimSuffix(name, "/"))
+	if !fs.ValidPath(clean) || strings.Contains(clean, `\`) {
+		return &fs.PathError{Op: "extract", Path: name, Err: ErrUnsafeArchivePath}
+	}
+	if clean == "." {
+		if e.IsDir() {
+			a.root.mode, a.root.modTime = e.mode, e.modTime
+		}
+		return nil
+	}
+	names := strings.Split(clean, "/")
+	dir := a.root
+	for _, n := range names[:len(names)-1] {
+		child := dir.children[n]
+		if child == nil || !child.IsDir() {
+			child = &archiveEntry{name: n, mode: fs.ModeDir | 0o755, children: map[string]*archiveEntry{}}
+			dir.children[n] = child
+		}
+		dir = child
+	}
+	e.name = names[len(names)-1]
+	if old := dir.children[e.name]; old != nil && old.IsDir() && e.IsDir() {
+		e.children = old.children
+	}
+	dir.children[e.name] = e
+	return nil
+}
+
+// lookup returns the entry at name, following symlinks in the middle of it,
+// and the last one as well if follow is true. The links are resolved one
+// component at a time as the OS does, so ".." goes up from where a link to
+// a directory points, not from the link itself.
+func (a *archiveFS) lookup(name string, follow bool) (*archiveEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, fs.ErrInvalid
+	}
+	names := splitArchivePath(name)
+	dirs, hops := []*archiveEntry{a.root}, 0
+	for len(names) > 0 {
+		n := names[0]
+		e := dirs[len(dirs)-1]
+		if !e.IsDir() {
+			return nil, fs.ErrNotExist
+		}
+		switch n {
+		case "", ".":
+			names = names[1:]
+			continue
+		case "..":
+			if len(dirs) == 1 {
+				return nil, ErrUnsafeSymlinkTarget
+			}
+			names, dirs = names[1:], dirs[:len(dirs)-1]
+			continue
+		}
+		child := e.children[n]
+		if child == nil {
+			return nil, escapes(names, len(dirs)-1, fs.ErrNotExist)
+		}
+		names = names[1:]
+		if child.mode&fs.ModeSymlink == 0 || (len(names) == 0 && !follow) {
+			dirs = append(dirs, child)
+			continue
+		}
+		if hops++; hops > maxSymlinkHops {
+			return nil, ErrSymlinkLoop
+		}
+		if !relativeLink(child.link) {
+			return nil, ErrUnsafeSymlinkTarget
+		}
+		names = append(strings.Split(child.link, "/"), names...)
+	}
+	return dirs[len(dirs)-1], nil
+}
+
+// escapes returns ErrUnsafeSymlinkTarget if names, which don't exist from
+// depth under the root, would go above the root anyway, and err otherwise.
+func escapes(names []string, depth int, err error) error {
+	for _, n := range names {
+		switch n {
+		case "", ".":
+		case "..":
+			if depth--; depth < 0 {
+				return ErrUnsafeSymlinkTarget
+			}
+		default:
+			depth++
+		}
+	}
+	return err
+}
+
+func splitArchivePath(name string) []string {
+	if name == "." {
+		return nil
+	}
+	return strings.Split(name, "/")
+}
+
+// Open opens the entry at name, following symlinks.
+func (a *archiveFS) Open(name string) (fs.File, error) {
+	e, err := a.lookup(name, true)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if e.IsDir() {
+		return &archiveDir{entry: e}, nil
+	}
+	rc, err := e.open()
+	if err != nil {
+		return nil, err
+	}
+	return &archiveFile{ReadCloser: rc, entry: e}, nil
+}
+
+// Stat returns the entry at name, following symlinks.
+func (a *archiveFS) Stat(name string) (fs.FileInfo, error) {
+	e, err := a.lookup(name, true)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return e, nil
+}
+
+// Lstat returns the entry at name, without following the last symlink.
+func (a *archiveFS) Lstat(name string) (fs.FileInfo, error) {
+	e, err := a.lookup(name, false)
+	if err != nil {
+		return nil, &fs.PathError{Op: "lstat", Path: name, Err: err}
+	}
+	return e, nil
+}
+
+// ReadLink returns the target of the symlink at name,
+// only if it's within the archive.
+func (a *archiveFS) ReadLink(name string) (string, error) {
+	e, err := a.lookup(name, false)
+	if err != nil {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: err}
+	}
+	if e.mode&fs.ModeSymlink == 0 {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	if _, err := a.lookup(name, true); !relativeLink(e.link) || errors.Is(err, ErrUnsafeSymlinkTarget) {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: ErrUnsafeSymlinkTarget}
+	}
+	return e.link, nil
+}
+
+// relativeLink reports whether link is relative,
+// without a volume name or backslashes.
+func relativeLink(link string) bool {
+	return !path.IsAbs(link) && !strings.Contains(link, `\`) && (len(link) < 2 || link[1] != ':')
+}
+
+// ReadDir returns the entries in the directory at name, sorted by name.
+func (a *archiveFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	e, err := a.lookup(name, true)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	if !e.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	entries := make([]fs.DirEntry, 0, len(e.children))
+	for _, child := range e.children {
+		entries = append(entries, fs.FileInfoToDirEntry(child))
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
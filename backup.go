@@ -0,0 +1,80 @@
+package copy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// backingUp reports whether existing dest files are to be saved before overwritten.
+func backingUp(opt Options) bool {
+	return opt.BackupDir != "" || opt.Backup != NoBackup
+}
+
+// backuppath returns the path to save dest into.
+// In Options.BackupDir, it has the same relative path as dest in the destination,
+// and then it's named by Options.Backup.
+func backuppath(dest string, opt Options) string {
+	bak := dest
+	if opt.BackupDir != "" {
+		rel, err := filepath.Rel(opt.intent.dest, dest)
+		if err != nil || rel == "." {
+			rel = filepath.Base(dest)
+		}
+		bak = filepath.Join(opt.BackupDir, rel)
+	}
+	switch opt.Backup {
+	case SimpleBackup:
+		return backupname(bak, 0, opt)
+	case NumberedBackup:
+		for n := 1; ; n++ {
+			if name := backupname(bak, n, opt); !exists(name) {
+				return name
+			}
+		}
+	}
+	return bak
+}
+
+// backupname names the n-th backup of path, regarding Options.BackupName.
+func backupname(path string, n int, opt Options) string {
+	if opt.BackupName != nil {
+		return opt.BackupName(path, n)
+	}
+	if n == 0 {
+		return path + opt.BackupSuffix
+	}
+	return fmt.Sprintf("%s.~%d~", path, n)
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// backup moves the existing dest file into Options.BackupDir, or aside by Options.Backup,
+// before it's overwritten. In AppendMode, it's copied instead,
+// because the content is to be appended to.
+func backup(dest string, opt Options) error {
+	info, err := os.Lstat(dest)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+	bak := backuppath(dest, opt)
+	if err := os.MkdirAll(filepath.Dir(bak), os.ModePerm); err != nil {
+		return err
+	}
+	if !opt.AppendMode {
+		if err := os.Rename(dest, bak); err == nil {
+			return nil
+		}
+		// e.g. on another device, then just copy it.
+	}
+	return Copy(dest, bak, Options{PreserveTimes: true})
+}
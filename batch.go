@@ -0,0 +1,69 @@
+package copy
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultBatchMaxFileSize = 64 * 1024
+	defaultBatchLen         = 256
+)
+
+// BatchWriter writes multiple small files at once.
+type BatchWriter interface {
+	WriteBatch(files []FileData) error
+}
+
+// FileData is a small file to be written by BatchWriter.
+type FileData struct {
+	// Path is the dest path of the file.
+	Path    string
+	Data    []byte
+	Mode    os.FileMode
+	ModTime time.Time
+}
+
+// batch buffers files until BatchLen files are gathered.
+type batch struct {
+	mu    sync.Mutex
+	files []FileData
+}
+
+// add reads the src file and buffers it, flushing the batch if it's full.
+func (b *batch) add(dest string, r io.Reader, info os.FileInfo, opt Options) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if opt.BytesWritten != nil {
+		atomic.AddInt64(opt.BytesWritten, int64(len(data)))
+	}
+	if opt.FilesCopied != nil {
+		atomic.AddInt64(opt.FilesCopied, 1)
+	}
+	b.mu.Lock()
+	b.files = append(b.files, FileData{Path: dest, Data: data, Mode: info.Mode(), ModTime: info.ModTime()})
+	full := len(b.files) >= opt.BatchLen
+	b.mu.Unlock()
+	if full {
+		return b.flush(opt)
+	}
+	return nil
+}
+
+// flush writes the buffered files by BatchWriter.
+func (b *batch) flush(opt Options) error {
+	b.mu.Lock()
+	files := b.files
+	b.files = nil
+	b.mu.Unlock()
+	if len(files) == 0 {
+		return nil
+	}
+	return opt.BatchWriter.WriteBatch(files)
+}
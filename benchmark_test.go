@@ -2,7 +2,10 @@ package copy
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
 	"testing"
+	"time"
 )
 
 func BenchmarkOptions_NumOfWorkers_0(b *testing.B) {
@@ -36,3 +39,119 @@ func BenchmarkOptions_NumOfWorkers_8(b *testing.B) {
 		Copy("test/data/case19", fmt.Sprintf("test/data.copy/case19-%d-%d", num, i), opt)
 	}
 }
+
+func BenchmarkOptions_PrefetchDepth_0(b *testing.B) {
+	benchmarkPrefetchDepth(b, 0)
+}
+
+func BenchmarkOptions_PrefetchDepth_4(b *testing.B) {
+	benchmarkPrefetchDepth(b, 4)
+}
+
+func benchmarkPrefetchDepth(b *testing.B, depth int) {
+	for i := 0; i < b.N; i++ {
+		opt := Options{
+			FS:            &LatencyFS{FS: os.DirFS("test/data/case19"), Latency: 2 * time.Millisecond},
+			PrefetchDepth: depth,
+		}
+		Copy(".", fmt.Sprintf("test/data.copy/case19-prefetch-%d-%d", depth, i), opt)
+	}
+}
+
+func BenchmarkOptions_SyncMode_None(b *testing.B) {
+	benchmarkSyncMode(b, SyncNone)
+}
+
+func BenchmarkOptions_SyncMode_PerFile(b *testing.B) {
+	benchmarkSyncMode(b, SyncPerFile)
+}
+
+func BenchmarkOptions_SyncMode_Batched(b *testing.B) {
+	benchmarkSyncMode(b, SyncBatched)
+}
+
+func benchmarkSyncMode(b *testing.B, mode SyncMode) {
+	src := b.TempDir()
+	for i := 0; i < 200; i++ {
+		ioutil.WriteFile(fmt.Sprintf("%s/file%d", src, i), []byte("small"), 0o644)
+	}
+	dest := b.TempDir()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Copy(src, fmt.Sprintf("%s/%d", dest, i), Options{SyncMode: mode})
+	}
+}
+
+func BenchmarkOptions_CopyBufferSize(b *testing.B) {
+	benchmarkCopyBufferSize(b, false)
+}
+
+func BenchmarkOptions_AllowReadFromWithBuffer(b *testing.B) {
+	benchmarkCopyBufferSize(b, true)
+}
+
+func benchmarkCopyBufferSize(b *testing.B, allow bool) {
+	src := b.TempDir()
+	ioutil.WriteFile(src+"/large", make([]byte, 64*1024*1024), 0o644)
+	dest := b.TempDir()
+	opt := Options{CopyBufferSize: 4 * 1024, AllowReadFromWithBuffer: allow}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Copy(src+"/large", fmt.Sprintf("%s/large-%d", dest, i), opt)
+	}
+}
+
+func BenchmarkOptions_CopyBufferSize_ManyFiles(b *testing.B) {
+	src := b.TempDir()
+	for i := 0; i < 256; i++ {
+		ioutil.WriteFile(fmt.Sprintf("%s/file%d", src, i), make([]byte, 1024), 0o644)
+	}
+	dest := b.TempDir()
+	opt := Options{NumOfWorkers: 8, CopyBufferSize: 1024 * 1024}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Copy(src, fmt.Sprintf("%s/%d", dest, i), opt)
+	}
+}
+
+func BenchmarkOptions_IOConcurrency_0(b *testing.B) {
+	benchmarkIOConcurrency(b, 0)
+}
+
+func BenchmarkOptions_IOConcurrency_1(b *testing.B) {
+	benchmarkIOConcurrency(b, 1)
+}
+
+func benchmarkIOConcurrency(b *testing.B, n int64) {
+	src := b.TempDir()
+	for i := 0; i < 8; i++ {
+		ioutil.WriteFile(fmt.Sprintf("%s/file%d", src, i), make([]byte, 256*1024), 0o644)
+	}
+	dest := b.TempDir()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		disk := &SlowDisk{Seek: 100 * time.Microsecond}
+		opt := Options{NumOfWorkers: 8, IOConcurrency: n, CopyBufferSize: 32 * 1024, WrapReader: disk.Wrap}
+		Copy(src, fmt.Sprintf("%s/%d", dest, i), opt)
+	}
+}
+
+func BenchmarkOptions_ParallelChunkSize_0(b *testing.B) {
+	benchmarkParallelChunkSize(b, 0)
+}
+
+func BenchmarkOptions_ParallelChunkSize_8M(b *testing.B) {
+	benchmarkParallelChunkSize(b, 8*1024*1024)
+}
+
+func benchmarkParallelChunkSize(b *testing.B, size int64) {
+	src := b.TempDir()
+	ioutil.WriteFile(src+"/large", make([]byte, 64*1024*1024), 0o644)
+	dest := b.TempDir()
+	opt := Options{NumOfWorkers: 4, ParallelChunkSize: size}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Copy(src+"/large", fmt.Sprintf("%s/large-%d", dest, i), opt)
+	}
+}
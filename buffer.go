@@ -0,0 +1,28 @@
+package copy
+
+import "sync"
+
+// newBufferPool returns the pool of buffers of CopyBufferSize,
+// so that they're reused among files instead of allocated for each.
+func newBufferPool(size uint) *sync.Pool {
+	return &sync.Pool{New: func() interface{} {
+		buf := make([]byte, size)
+		return &buf
+	}}
+}
+
+// getBuffer returns a buffer of CopyBufferSize, from the pool if any.
+func getBuffer(opt Options) *[]byte {
+	if opt.intent.buffers == nil {
+		buf := make([]byte, opt.CopyBufferSize)
+		return &buf
+	}
+	return opt.intent.buffers.Get().(*[]byte)
+}
+
+// putBuffer returns the buffer to the pool if any.
+func putBuffer(buf *[]byte, opt Options) {
+	if opt.intent.buffers != nil {
+		opt.intent.buffers.Put(buf)
+	}
+}
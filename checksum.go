@@ -0,0 +1,127 @@
+package copy
+
+import (
+	"crypto"
+	_ "crypto/sha256" // The default of ChecksumAlgo.
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// checksums holds the checksums of the files written so far,
+// to be written into ChecksumManifest.
+type checksums struct {
+	mu       sync.Mutex
+	algo     crypto.Hash
+	root     string
+	manifest string
+	sums     map[string]string
+}
+
+func newChecksums(opt Options) (*checksums, error) {
+	algo := opt.ChecksumAlgo
+	if algo == 0 {
+		algo = crypto.SHA256
+	}
+	if !algo.Available() {
+		return nil, fmt.Errorf("%v is not linked into the binary", algo)
+	}
+	manifest, err := filepath.Abs(opt.ChecksumManifest)
+	if err != nil {
+		return nil, err
+	}
+	return &checksums{algo: algo, root: opt.intent.dest, manifest: manifest, sums: map[string]string{}}, nil
+}
+
+// checksum wraps r to hash the content of dest, if needed.
+func checksum(r io.Reader, dest string, opt Options) io.Reader {
+	if opt.intent.checksums == nil {
+		return r
+	}
+	return opt.intent.checksums.reader(r, dest)
+}
+
+// reader hashes the content of dest read through r,
+// and records it when r is read to the end.
+func (c *checksums) reader(r io.Reader, dest string) io.Reader {
+	if c.excluded(dest) {
+		return r
+	}
+	return &hashReader{r: r, h: c.algo.New(), done: func(sum []byte) { c.add(dest, sum) }}
+}
+
+// file hashes and records dest which is already written.
+func (c *checksums) file(dest string) error {
+	if c.excluded(dest) {
+		return nil
+	}
+	f, err := os.Open(dest)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := c.algo.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	c.add(dest, h.Sum(nil))
+	return nil
+}
+
+// excluded reports whether dest is the manifest itself.
+func (c *checksums) excluded(dest string) bool {
+	abs, err := filepath.Abs(dest)
+	return err == nil && abs == c.manifest
+}
+
+func (c *checksums) add(dest string, sum []byte) {
+	rel, err := filepath.Rel(c.root, dest)
+	if err != nil || rel == "." {
+		rel = filepath.Base(dest)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sums[filepath.ToSlash(rel)] = hex.EncodeToString(sum)
+}
+
+// write writes the manifest in the format of sha256sum(1), sorted by paths.
+func (c *checksums) write() error {
+	paths := make([]string, 0, len(c.sums))
+	for path := range c.sums {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	b := &strings.Builder{}
+	for _, path := range paths {
+		fmt.Fprintf(b, "%s  %s\n", c.sums[path], path)
+	}
+	if err := os.MkdirAll(filepath.Dir(c.manifest), os.ModePerm); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(c.manifest, []byte(b.String()), 0o644)
+}
+
+// hashReader hashes the content read through it,
+// and calls done with the sum at the end.
+type hashReader struct {
+	r    io.Reader
+	h    hash.Hash
+	done func(sum []byte)
+}
+
+func (r *hashReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.h.Write(p[:n])
+	if err == io.EOF && r.done != nil {
+		r.done(r.h.Sum(nil))
+		r.done = nil
+	}
+	return n, err
+}
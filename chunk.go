@@ -0,0 +1,54 @@
+package copy
+
+import (
+	"io"
+	"os"
+	"sync/atomic"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// copyChunks copies src into dest in ranges of Options.ParallelChunkSize,
+// by Options.NumOfWorkers at once, with ReadAt and WriteAt.
+func copyChunks(dest, src *os.File, size int64, opt Options) (int64, error) {
+	if err := dest.Truncate(size); err != nil {
+		return 0, err
+	}
+	var written int64
+	group, ctx := errgroup.WithContext(opt.intent.ctx)
+	group.SetLimit(int(opt.NumOfWorkers))
+	for offset := int64(0); offset < size; offset += opt.ParallelChunkSize {
+		offset, length := offset, opt.ParallelChunkSize
+		if offset+length > size {
+			length = size - offset
+		}
+		group.Go(func() error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			var buf []byte
+			if opt.CopyBufferSize != 0 {
+				pooled := getBuffer(opt)
+				defer putBuffer(pooled, opt)
+				buf = *pooled
+			}
+			n, err := io.CopyBuffer(&offsetWriter{f: dest, offset: offset}, io.NewSectionReader(src, offset, length), buf)
+			atomic.AddInt64(&written, n)
+			return err
+		})
+	}
+	err := group.Wait()
+	return written, err
+}
+
+// offsetWriter writes into the file from the offset, with WriteAt.
+type offsetWriter struct {
+	f      *os.File
+	offset int64
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.f.WriteAt(p, w.offset)
+	w.offset += int64(n)
+	return n, err
+}
@@ -0,0 +1,34 @@
+package copy
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+// errNotReadAsIs tells that the src file can't be cloned,
+// because it's read through wrappers such as WrapReader.
+var errNotReadAsIs = errors.New("src file is not read as it is")
+
+// clonefile clones the src file into dest as Options.CloneMode,
+// where readcloser is the src file opened, and r is what reads it.
+// It returns false if the file should be copied as usual instead.
+func clonefile(dest *os.File, readcloser io.ReadCloser, r io.Reader, src string, opt Options) (bool, error) {
+	s, ok := readcloser.(*os.File)
+	if !ok || r != readcloser {
+		if opt.CloneMode == CloneAlways {
+			return false, &os.PathError{Op: "clone", Path: src, Err: errNotReadAsIs}
+		}
+		return false, nil
+	}
+	err := clone(dest, s)
+	switch {
+	case err == nil:
+		return true, nil
+	case opt.CloneMode == CloneAlways:
+		return false, &os.PathError{Op: "clone", Path: src, Err: err}
+	case opt.OnFallback != nil:
+		opt.OnFallback(src, Clone, ByteCopy, err)
+	}
+	return false, nil
+}
@@ -0,0 +1,33 @@
+//go:build darwin
+// +build darwin
+
+package copy
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// clone makes dest share the data of src by fclonefileat(2).
+// As it can only create a new file, the clone replaces dest
+// with the mode of dest kept.
+func clone(dest, src *os.File) error {
+	info, err := dest.Stat()
+	if err != nil {
+		return err
+	}
+	tmp := dest.Name() + ".clone"
+	if err := unix.Fclonefileat(int(src.Fd()), unix.AT_FDCWD, tmp, 0); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp, info.Mode()); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, dest.Name()); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+//go:build linux
+// +build linux
+
+package copy
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// clone makes dest share the data of src by ioctl(FICLONE).
+func clone(dest, src *os.File) error {
+	return unix.IoctlFileClone(int(dest.Fd()), int(src.Fd()))
+}
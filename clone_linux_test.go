@@ -0,0 +1,70 @@
+//go:build linux
+// +build linux
+
+package copy
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/otiai10/mint"
+)
+
+func TestOptions_CloneMode(t *testing.T) {
+	src := t.TempDir()
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "file"), []byte("content"), 0o644)).ToBe(nil)
+
+	// Whether the temp dir supports cloning depends on the filesystem.
+	f, err := os.Open(filepath.Join(src, "file"))
+	Expect(t, err).ToBe(nil)
+	defer f.Close()
+	probe, err := os.Create(filepath.Join(t.TempDir(), "probe"))
+	Expect(t, err).ToBe(nil)
+	defer probe.Close()
+	cloneable := clone(probe, f) == nil
+
+	var fallbacks []string
+	dest := filepath.Join(t.TempDir(), "auto")
+	err = Copy(src, dest, Options{
+		CloneMode: CloneAuto,
+		OnFallback: func(src string, from, to CopyMethod, reason error) {
+			Expect(t, from).ToBe(Clone)
+			Expect(t, to).ToBe(ByteCopy)
+			fallbacks = append(fallbacks, filepath.Base(src))
+		},
+	})
+	Expect(t, err).ToBe(nil)
+	b, err := ioutil.ReadFile(filepath.Join(dest, "file"))
+	Expect(t, err).ToBe(nil)
+	Expect(t, string(b)).ToBe("content")
+	if cloneable {
+		Expect(t, fallbacks).ToBe([]string(nil))
+	} else {
+		Expect(t, fallbacks).ToBe([]string{"file"})
+	}
+
+	When(t, "CloneAlways is given", func(t *testing.T) {
+		dest := filepath.Join(t.TempDir(), "always")
+		err := Copy(src, dest, Options{CloneMode: CloneAlways, OnFallback: func(string, CopyMethod, CopyMethod, error) {
+			t.Error("OnFallback should not be called")
+		}})
+		if cloneable {
+			Expect(t, err).ToBe(nil)
+		} else {
+			var perr *os.PathError
+			Expect(t, errors.As(err, &perr)).ToBe(true)
+			Expect(t, perr.Op).ToBe("clone")
+		}
+	})
+
+	When(t, "the src file is wrapped", func(t *testing.T) {
+		dest := filepath.Join(t.TempDir(), "wrapped")
+		err := Copy(src, dest, Options{CloneMode: CloneAlways, LineTransform: func(src string, line []byte) []byte { return line }})
+		Expect(t, errors.Is(err, errNotReadAsIs)).ToBe(true)
+		err = Copy(src, dest, Options{CloneMode: CloneAuto, LineTransform: func(src string, line []byte) []byte { return line }})
+		Expect(t, err).ToBe(nil)
+	})
+}
@@ -0,0 +1,15 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package copy
+
+import (
+	"errors"
+	"os"
+)
+
+var errCloneUnsupported = errors.New("clone is not supported on this platform")
+
+func clone(dest, src *os.File) error {
+	return errCloneUnsupported
+}
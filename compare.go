@@ -0,0 +1,128 @@
+package copy
+
+import (
+	"bytes"
+	"hash"
+	"io"
+	"os"
+)
+
+// compareChunkSize is the size of chunks to compare contents by.
+const compareChunkSize = 32 * 1024
+
+// open opens src file, regarding the source filesystem.
+func open(src string, opt Options) (io.ReadCloser, error) {
+	if opt.FS != nil {
+		return opt.FS.Open(src)
+	}
+	return os.Open(src)
+}
+
+// sameContent reports whether dest already has the same content as src.
+// Contents are compared only if their sizes are the same,
+// and the comparison stops at the first different chunk.
+func sameContent(src, dest string, info os.FileInfo, opt Options) (bool, error) {
+	destinfo, err := statDest(dest, true, opt)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !destinfo.Mode().IsRegular() || destinfo.Size() != info.Size() {
+		return false, nil
+	}
+	s, err := open(src, opt)
+	if err != nil {
+		return false, err
+	}
+	defer s.Close()
+	d, err := os.Open(dest)
+	if err != nil {
+		return false, err
+	}
+	defer d.Close()
+	if opt.CompareByHash {
+		return equalDigests(s, d, opt.Hasher)
+	}
+	return equalReaders(s, d)
+}
+
+// equalDigests reports whether both readers have the same digest.
+func equalDigests(a, b io.Reader, hasher func() hash.Hash) (bool, error) {
+	ha, hb := hasher(), hasher()
+	if _, err := io.Copy(ha, a); err != nil {
+		return false, err
+	}
+	if _, err := io.Copy(hb, b); err != nil {
+		return false, err
+	}
+	return bytes.Equal(ha.Sum(nil), hb.Sum(nil)), nil
+}
+
+// equalReaders reads both readers chunk by chunk
+// and reports whether they have the same bytes.
+func equalReaders(a, b io.Reader) (bool, error) {
+	offset, err := firstDiff(a, b)
+	return offset < 0, err
+}
+
+// firstDiff reads both readers chunk by chunk, and returns the offset
+// of the first different byte as soon as it's found, or -1 if none.
+// If one is shorter than the other, it's the length of the shorter one.
+func firstDiff(a, b io.Reader) (int64, error) {
+	bufa, bufb := make([]byte, compareChunkSize), make([]byte, compareChunkSize)
+	var offset int64
+	for {
+		na, erra := io.ReadFull(a, bufa)
+		if erra != nil && erra != io.EOF && erra != io.ErrUnexpectedEOF {
+			return -1, erra
+		}
+		nb, errb := io.ReadFull(b, bufb)
+		if errb != nil && errb != io.EOF && errb != io.ErrUnexpectedEOF {
+			return -1, errb
+		}
+		if na != nb || !bytes.Equal(bufa[:na], bufb[:nb]) {
+			i := 0
+			for i < na && i < nb && bufa[i] == bufb[i] {
+				i++
+			}
+			return offset + int64(i), nil
+		}
+		offset += int64(na)
+		if erra != nil || errb != nil {
+			if erra != nil && errb != nil {
+				return -1, nil
+			}
+			return offset, nil
+		}
+	}
+}
+
+// sameSizeAndTime reports whether dest has the same size and mtime as src,
+// with the mtime compared in seconds like rsync does.
+func sameSizeAndTime(dest string, info os.FileInfo, opt Options) (bool, error) {
+	destinfo, err := statDest(dest, true, opt)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return destinfo.Mode().IsRegular() &&
+		destinfo.Size() == info.Size() &&
+		destinfo.ModTime().Unix() == info.ModTime().Unix(), nil
+}
+
+// shouldCopy asks Options.ShouldCopy whether to copy src onto the existing dest.
+// It's always true if dest doesn't exist.
+func shouldCopy(src, dest string, info os.FileInfo, opt Options) (bool, error) {
+	destinfo, err := statDest(dest, false, opt)
+	if os.IsNotExist(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return opt.ShouldCopy(src, dest, info, destinfo)
+}
@@ -0,0 +1,20 @@
+package copy
+
+import (
+	"context"
+	"io"
+)
+
+// contextReader stops reading src once the context is done,
+// so that copying a large file can be interrupted.
+type contextReader struct {
+	ctx context.Context
+	src io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.src.Read(p)
+}
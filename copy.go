@@ -2,78 +2,452 @@ package copy
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"io/fs"
-	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/sync/errgroup"
 	"golang.org/x/sync/semaphore"
 )
 
-type timespec struct {
+// Timespec holds the times of a file.
+type Timespec struct {
 	Mtime time.Time
 	Atime time.Time
 	Ctime time.Time
+	// Btime is the birth time, which is zero if not available.
+	Btime time.Time
+}
+
+// modTimeSpec is for the platforms or the filesystems
+// which don't tell the times other than mtime.
+func modTimeSpec(info os.FileInfo) Timespec {
+	return Timespec{
+		Mtime: info.ModTime(),
+		Atime: info.ModTime(),
+		Ctime: info.ModTime(),
+	}
 }
 
 // Copy copies src to dest, doesn't matter if src is a directory or a file.
 func Copy(src, dest string, opts ...Options) error {
 	opt := assureOptions(src, dest, opts...)
+	if err := checkConflicts(opt); err != nil {
+		return err
+	}
+	dest, err := destroot(src, dest, opt)
+	if err != nil {
+		return onError(src, dest, err, opt)
+	}
+	opt.intent.dest = dest
+	if err := insideSrc(src, dest, opt); err != nil {
+		return onError(src, dest, err, opt)
+	}
+	opt, stop, err := prepare(opt)
+	if err != nil {
+		return err
+	}
+	defer stop()
+	if err := walk(src, dest, opt); err != nil {
+		return err
+	}
+	return finish(opt)
+}
+
+// prepare sets up what's shared while copying, regarding the options.
+// stop must be called after copying.
+func prepare(opt Options) (_ Options, stop func(), err error) {
+	stop = func() {}
 	if opt.NumOfWorkers > 1 {
 		opt.intent.sem = semaphore.NewWeighted(opt.NumOfWorkers)
-		opt.intent.ctx = context.Background()
+		opt.intent.dirs = new(sync.Map)
+		if opt.MaxConcurrentDirs > 0 {
+			opt.intent.dirsem = semaphore.NewWeighted(opt.MaxConcurrentDirs)
+		} else {
+			opt.intent.dirsem = semaphore.NewWeighted(opt.NumOfWorkers)
+		}
+	}
+	if opt.CopyBufferSize != 0 {
+		opt.intent.buffers = newBufferPool(opt.CopyBufferSize)
+	}
+	if opt.BandwidthLimit > 0 {
+		opt.intent.bandwidth = newLimiter(opt.BandwidthLimit)
+	}
+	if opt.IOConcurrency > 0 {
+		opt.intent.iosem = semaphore.NewWeighted(opt.IOConcurrency)
+	}
+	if opt.BatchWriter != nil {
+		opt.intent.batch = &batch{}
+	}
+	if opt.Traversal == BreadthFirst {
+		opt.intent.bfs = &breadthFirst{}
+	} else if opt.CoalesceDirMetadata {
+		opt.intent.coalesced = &coalesced{}
+	}
+	if opt.CollapseSymlinkChains {
+		opt.intent.collapsed = new(sync.Map)
+	}
+	if opt.PreserveHardLinks && opt.FS == nil {
+		opt.intent.inodes = new(sync.Map)
+	}
+	if opt.ChownTo != nil {
+		if opt.intent.owner, err = opt.ChownTo.resolve(); err != nil {
+			return opt, stop, err
+		}
+	}
+	if opt.ChecksumManifest != "" {
+		if opt.intent.checksums, err = newChecksums(opt); err != nil {
+			return opt, stop, err
+		}
+	}
+	if opt.ErrorPolicy == ContinueAndCollect {
+		opt.intent.collected = &collector{}
+	}
+	if opt.IgnoreFile != "" {
+		if opt.intent.ignores, err = readIgnoreFile(opt.IgnoreFile); err != nil {
+			return opt, stop, err
+		}
+	}
+	if opt.TimeBudget > 0 {
+		opt.intent.expired = new(int32)
+		timer := time.AfterFunc(opt.TimeBudget, func() {
+			atomic.StoreInt32(opt.intent.expired, 1)
+		})
+		stop = func() { timer.Stop() }
+	}
+	return opt, stop, nil
+}
+
+// walk copies src to dest, with what's prepared.
+func walk(src, dest string, opt Options) error {
+	info, err := lstat(src, opt)
+	if err != nil {
+		return onError(src, dest, err, opt)
+	}
+	if err := requireParent(dest, opt); err != nil {
+		return onError(src, dest, err, opt)
+	}
+	err = switchboard(src, dest, info, opt)
+	if err == nil && opt.intent.bfs != nil {
+		err = opt.intent.bfs.run()
+	}
+	if opt.intent.coalesced != nil {
+		if ferr := opt.intent.coalesced.run(err); err == nil {
+			err = ferr
+		}
+	}
+	return err
+}
+
+// requireParent fails if the parent directory of the root dest
+// doesn't exist, when RequireDestRootParent is set.
+func requireParent(dest string, opt Options) error {
+	if !opt.RequireDestRootParent {
+		return nil
+	}
+	_, err := os.Stat(filepath.Dir(dest))
+	return err
+}
+
+// finish writes what's deferred until everything is copied.
+func finish(opt Options) error {
+	if opt.BatchWriter != nil {
+		if err := opt.intent.batch.flush(opt); err != nil {
+			return err
+		}
+	}
+	if opt.intent.checksums != nil {
+		if err := opt.intent.checksums.write(); err != nil {
+			return err
+		}
+	}
+	if opt.intent.collected != nil {
+		return opt.intent.collected.err()
+	}
+	return nil
+}
+
+// lstat returns the FileInfo of src, regarding the source filesystem.
+// On fs.FS, symlinks are followed unless it's ReadLinkFS.
+func lstat(src string, opt Options) (os.FileInfo, error) {
+	if l, ok := opt.FS.(ReadLinkFS); ok {
+		return l.Lstat(src)
 	}
 	if opt.FS != nil {
-		info, err := fs.Stat(opt.FS, src)
-		if err != nil {
-			return onError(src, dest, err, opt)
+		return fs.Stat(opt.FS, src)
+	}
+	return os.Lstat(src)
+}
+
+// readlink returns the target of the symlink src, regarding the source filesystem.
+func readlink(src string, opt Options) (string, error) {
+	if l, ok := opt.FS.(ReadLinkFS); ok {
+		return l.ReadLink(src)
+	}
+	return os.Readlink(src)
+}
+
+// CopyAsync copies src to dest in a new goroutine, just like Copy.
+// The result of the copy is sent to done exactly once, and then done is closed.
+// Calling cancel stops the copy as soon as possible, even in the middle of a file,
+// and then done receives context.Canceled.
+func CopyAsync(src, dest string, opts ...Options) (done <-chan error, cancel func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() {
+		defer close(result)
+		defer cancel()
+		result <- CopyWithContext(ctx, src, dest, opts...)
+	}()
+	return result, cancel
+}
+
+// CopyWithContext copies src to dest just like Copy,
+// but stops as soon as the context is done, even in the middle of a file,
+// and then returns the error of the context.
+func CopyWithContext(ctx context.Context, src, dest string, opts ...Options) error {
+	opt := Options{}
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	opt.intent.ctx = ctx
+	return Copy(src, dest, opt)
+}
+
+// destroot computes the destination of the root src,
+// regarding path-related options.
+func destroot(src, dest string, opt Options) (string, error) {
+	if opt.StripPrefix != "" {
+		rel, err := filepath.Rel(filepath.Clean(opt.StripPrefix), filepath.Clean(src))
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return dest, fmt.Errorf("%w: %s is not under %s", ErrPrefixMismatch, src, opt.StripPrefix)
 		}
-		return switchboard(src, dest, info, opt)
+		dest = filepath.Join(dest, rel)
+	}
+	if opt.TrailingSlashSemantics && src != "" && !os.IsPathSeparator(src[len(src)-1]) {
+		dest = filepath.Join(dest, filepath.Base(filepath.Clean(src)))
+	}
+	if opt.ForwardSlashPaths {
+		dest = filepath.ToSlash(dest)
+	}
+	return dest, nil
+}
+
+// insideSrc fails with ErrDestinationInsideSource if dest is the same file as src,
+// or under src directory even through symlinks.
+func insideSrc(src, dest string, opt Options) error {
+	if opt.FS != nil || opt.DestFS != nil {
+		return nil
 	}
 	info, err := os.Lstat(src)
 	if err != nil {
-		return onError(src, dest, err, opt)
+		return nil // Reported later, regarding OnError.
+	}
+	if destinfo, err := os.Stat(dest); err == nil && os.SameFile(info, destinfo) {
+		return &os.PathError{Op: "copy", Path: dest, Err: ErrDestinationInsideSource}
+	}
+	if !info.IsDir() {
+		return nil
+	}
+	real, err := realpath(src)
+	if err != nil {
+		return nil
+	}
+	if within(realdest(dest), real) {
+		return &os.PathError{Op: "copy", Path: dest, Err: ErrDestinationInsideSource}
+	}
+	return nil
+}
+
+// realdest resolves the symlinks of dest as realpath does,
+// as far as it exists, because dest might not exist yet.
+func realdest(dest string) string {
+	abs, err := filepath.Abs(dest)
+	if err != nil {
+		return dest
+	}
+	for dir, rest := abs, ""; ; {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			return filepath.Join(resolved, rest)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return abs
+		}
+		dir, rest = parent, filepath.Join(filepath.Base(dir), rest)
 	}
-	return switchboard(src, dest, info, opt)
+}
+
+// destname computes the name of the entry in the destination,
+// regarding name-related options.
+func destname(info os.FileInfo, opt Options) string {
+	name := info.Name()
+	if opt.NormalizeUnicode != nil {
+		name = opt.NormalizeUnicode.String(name)
+	}
+	if info.Mode().IsRegular() {
+		name = opt.DestPrefix + name + opt.DestSuffix
+	}
+	return name
+}
+
+// childpaths computes the src and the dest of the content of srcdir,
+// regarding Options.PathRenames.
+func childpaths(srcdir, destdir string, content os.FileInfo, opt Options) (string, string) {
+	cs := filepath.Join(srcdir, content.Name())
+	if len(opt.PathRenames) != 0 {
+		if rel, err := filepath.Rel(opt.intent.src, cs); err == nil {
+			if to, ok := opt.PathRenames[filepath.ToSlash(rel)]; ok {
+				return cs, destpath(opt.intent.dest, filepath.FromSlash(to), opt)
+			}
+		}
+	}
+	return cs, destpath(destdir, destname(content, opt), opt)
+}
+
+// destpath computes the destination of the entry under the destdir,
+// regarding path-related options.
+func destpath(destdir, name string, opt Options) string {
+	if opt.ForwardSlashPaths {
+		return filepath.ToSlash(filepath.Join(destdir, name))
+	}
+	return filepath.Join(destdir, name)
 }
 
 // switchboard switches proper copy functions regarding file type, etc...
 // If there would be anything else here, add a case to this switchboard.
 func switchboard(src, dest string, info os.FileInfo, opt Options) (err error) {
 	if info.Mode()&os.ModeDevice != 0 && !opt.Specials {
-		return onError(src, dest, err, opt)
+		skipped(src, dest, "device", opt)
+		return nil
+	}
+
+	if opt.intent.claimed != nil && !info.IsDir() && dest != opt.intent.resolving {
+		if other, loaded := opt.intent.claimed.LoadOrStore(dest, src); loaded {
+			return onError(src, dest, fmt.Errorf("%w: %s", ErrDestCollision, other), opt)
+		}
+	}
+
+	special := specialKind(info)
+	copyfile := func() error { return fcopy(src, dest, info, opt) }
+	if opt.AppendMode && (opt.Retry.Attempts > 0 || opt.OnErrorAction != nil) {
+		copyfile = rewinding(dest, copyfile)
+	}
+	for retries := 0; ; retries++ {
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			err = onsymlink(src, dest, opt)
+		case info.IsDir():
+			err = dcopy(src, dest, info, opt)
+		case special != "" && opt.intent.subst != nil:
+			err = opt.intent.subst.special(src, dest, info, special, opt)
+		case special != "" && opt.DestFS != nil:
+			skipped(src, dest, special, opt)
+		case info.Mode()&os.ModeNamedPipe != 0:
+			err = pcopy(src, dest, info, opt)
+		case info.Mode()&os.ModeDevice != 0:
+			err = devcopy(src, dest, info, opt)
+		case info.Mode()&os.ModeSocket != 0:
+			err = onsocket(src, dest, info, opt)
+		default:
+			err = retry(copyfile, opt)
+		}
+
+		if err == nil || opt.OnErrorAction == nil {
+			return onError(src, dest, err, opt)
+		}
+		switch opt.OnErrorAction(src, dest, err) {
+		case Retry:
+			if info.Mode().IsRegular() && retries < maxRetriesOnError {
+				continue
+			}
+			return err
+		case Ignore:
+			ignored(src, dest, err, opt)
+			return nil
+		default:
+			return err
+		}
 	}
+}
 
+// specialKind tells the kind of special file which Specials can copy, if it is.
+func specialKind(info os.FileInfo) string {
 	switch {
-	case info.Mode()&os.ModeSymlink != 0:
-		err = onsymlink(src, dest, opt)
-	case info.IsDir():
-		err = dcopy(src, dest, info, opt)
 	case info.Mode()&os.ModeNamedPipe != 0:
-		err = pcopy(dest, info)
-	default:
-		err = fcopy(src, dest, info, opt)
+		return "named pipe"
+	case info.Mode()&os.ModeDevice != 0:
+		return "device"
 	}
+	return ""
+}
 
-	return onError(src, dest, err, opt)
+// stopped returns the reason not to start copying another entry, if any.
+func stopped(opt Options) error {
+	if err := opt.intent.ctx.Err(); err != nil {
+		return err
+	}
+	if opt.intent.expired != nil && atomic.LoadInt32(opt.intent.expired) != 0 {
+		return ErrTimeBudgetExceeded
+	}
+	return nil
+}
+
+// stopping reports whether err is what stopped returns,
+// which stops copying instead of being handled as an error of the entry.
+func stopping(err error) bool {
+	return errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, ErrTimeBudgetExceeded)
 }
 
 // copyNextOrSkip decide if this src should be copied or not.
 // Because this "copy" could be called recursively,
 // "info" MUST be given here, NOT nil.
 func copyNextOrSkip(src, dest string, info os.FileInfo, opt Options) error {
+	if err := stopped(opt); err != nil {
+		return err
+	}
+	if opt.SkipDir != nil && info.IsDir() {
+		if prune, err := opt.SkipDir(fs.FileInfoToDirEntry(info), src, dest); err != nil {
+			return err
+		} else if prune {
+			skipped(src, dest, "SkipDir", opt)
+			return nil
+		}
+	}
+	if len(opt.Exclude) != 0 || len(opt.Include) != 0 || len(opt.intent.ignores) != 0 {
+		if reason, err := filtered(src, info, opt); err != nil {
+			return err
+		} else if reason != "" {
+			skipped(src, dest, reason, opt)
+			return nil
+		}
+	}
 	if opt.Skip != nil {
 		skip, err := opt.Skip(info, src, dest)
 		if err != nil {
 			return err
 		}
 		if skip {
+			skipped(src, dest, "Skip", opt)
 			return nil
 		}
 	}
+	if opt.intent.bfs != nil && info.IsDir() {
+		// Copied in the next level.
+		opt.intent.bfs.enqueue(src, dest, info, opt)
+		return nil
+	}
 	return switchboard(src, dest, info, opt)
 }
 
@@ -82,12 +456,154 @@ func copyNextOrSkip(src, dest string, info os.FileInfo, opt Options) error {
 // and file permission.
 func fcopy(src, dest string, info os.FileInfo, opt Options) (err error) {
 
-	var readcloser io.ReadCloser
-	if opt.FS != nil {
-		readcloser, err = opt.FS.Open(src)
-	} else {
-		readcloser, err = os.Open(src)
+	if opt.OnEmptyFile != nil && info.Mode().IsRegular() && info.Size() == 0 {
+		switch opt.OnEmptyFile(src, dest) {
+		case SkipEmpty:
+			skipped(src, dest, "empty file", opt)
+			return nil
+		case ErrorEmpty:
+			return &os.PathError{Op: "copy", Path: src, Err: ErrEmptyFile}
+		} // case "CopyEmpty" is default behaviour. Go through.
+	}
+
+	if opt.SymlinkFiles && opt.FS == nil {
+		if opt.intent.subst != nil {
+			return opt.intent.subst.symlink(src, dest, opt)
+		}
+		if err := slink(src, dest, opt); err != nil {
+			return err
+		}
+		if opt.intent.report != nil {
+			opt.intent.report.symlinked()
+		}
+		return nil
+	}
+
+	if opt.ShouldCopy != nil && opt.intent.sync == nil {
+		if yes, err := shouldCopy(src, dest, info, opt); err != nil {
+			return err
+		} else if !yes {
+			skipped(src, dest, "ShouldCopy", opt)
+			return reapply(src, dest, info, opt)
+		}
+		// Overridden by ShouldCopy.
+		opt.SkipIfContentEqual, opt.SkipUnchanged, opt.OnFileExists = false, false, nil
+	}
+
+	if opt.intent.sync != nil {
+		if same, err := opt.intent.sync.unchanged(src, dest, info, opt); err != nil {
+			return err
+		} else if same {
+			skipped(src, dest, "unchanged", opt)
+			return reapply(src, dest, info, opt)
+		}
+		opt.SkipIfContentEqual = false // Already compared.
+		defer opt.intent.sync.copied(src, &err)
+	}
+
+	if opt.SkipUnchanged && opt.intent.sync == nil {
+		if same, err := sameSizeAndTime(dest, info, opt); err != nil {
+			return err
+		} else if same {
+			skipped(src, dest, "unchanged", opt)
+			return reapply(src, dest, info, opt)
+		}
+	}
+
+	if opt.SkipIfContentEqual {
+		if same, err := sameContent(src, dest, info, opt); err != nil {
+			return err
+		} else if same {
+			skipped(src, dest, "same content", opt)
+			return reapply(src, dest, info, opt)
+		}
+	}
+
+	if opt.OnFileExists != nil {
+		if destinfo, err := statDest(dest, false, opt); err == nil && !destinfo.IsDir() {
+			switch opt.OnFileExists(src, dest) {
+			case SkipExisting:
+				skipped(src, dest, "OnFileExists", opt)
+				return reapply(src, dest, info, opt)
+			case ErrorExisting:
+				return &os.PathError{Op: "copy", Path: dest, Err: os.ErrExist}
+			case RenameWithSuffix:
+				opt.DedupeDestNames = true
+			case OverwriteIfNewer:
+				if !info.ModTime().After(destinfo.ModTime()) {
+					skipped(src, dest, "not newer", opt)
+					return reapply(src, dest, info, opt)
+				}
+			} // case "Overwrite" is default behaviour. Go through.
+		} else if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if opt.intent.subst != nil {
+		return opt.intent.subst.file(src, dest, info, opt)
+	}
+
+	if opt.ClearDestFlags {
+		if err := clearFlags(dest); err != nil {
+			return err
+		}
+	}
+
+	if backingUp(opt) && !opt.DedupeDestNames && !opt.VerifyAndRollback && !opt.Atomic {
+		if err := backup(dest, opt); err != nil {
+			return err
+		}
+	}
+
+	if opt.intent.inodes != nil {
+		if linked, err := hardlink(src, dest, info, opt); err != nil {
+			return err
+		} else if linked {
+			if opt.FilesCopied != nil {
+				atomic.AddInt64(opt.FilesCopied, 1)
+			}
+			return nil
+		}
+	}
+
+	if opt.LinkDest != "" {
+		if linked, err := linkdest(src, dest, info, opt); err != nil {
+			return err
+		} else if linked {
+			if opt.FilesCopied != nil {
+				atomic.AddInt64(opt.FilesCopied, 1)
+			}
+			return nil
+		}
 	}
+
+	if opt.VerifyAndRollback || opt.Atomic {
+		return fcopyAtomic(src, dest, info, opt)
+	}
+	if opt.Resume {
+		return fcopyResumable(src, dest, info, opt)
+	}
+	if opt.DestFS != nil {
+		return fcopyFS(src, dest, info, opt)
+	}
+	return fwrite(src, dest, info, opt)
+}
+
+// fwrite is the latter half of fcopy, which creates dest, writes the content of src
+// and applies the metadata, after fcopy has decided to copy the file onto dest.
+// fcopyAtomic and fcopyResumable call it with their temporary files,
+// without deciding again whether to copy.
+func fwrite(src, dest string, info os.FileInfo, opt Options) (err error) {
+	var f *os.File
+	if opt.PreCreateDest {
+		if f, dest, err = create(dest, info, opt); err != nil {
+			return
+		}
+		defer fclose(f, &err)
+	}
+
+	readcloser, err := open(src, opt)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil
@@ -95,132 +611,507 @@ func fcopy(src, dest string, info os.FileInfo, opt Options) (err error) {
 		return
 	}
 	defer fclose(readcloser, &err)
+	if opt.intent.resumeAt > 0 {
+		if err := skip(readcloser, opt.intent.resumeAt); err != nil {
+			return err
+		}
+	}
 
-	if err = os.MkdirAll(filepath.Dir(dest), os.ModePerm); err != nil {
-		return
+	if opt.BatchWriter != nil && f == nil && info.Size() <= opt.BatchMaxFileSize {
+		return opt.intent.batch.add(dest, checksum(wrapReader(progress(readcloser, src, dest, info.Size(), opt), src, opt), dest, opt), info, opt)
 	}
 
-	f, err := os.Create(dest)
+	if f == nil {
+		if f, dest, err = create(dest, info, opt); err != nil {
+			return
+		}
+		defer fclose(f, &err)
+	}
+
+	chmodfunc, err := opt.PermissionControl(info, dest)
 	if err != nil {
-		return
+		return err
+	}
+	// Extended attributes and alternate data streams
+	// can't be written to the file made read-only.
+	deferChmod := (opt.PreserveXattrs || opt.PreserveADS) && opt.FS == nil
+	if !deferChmod {
+		chmodfunc(&err)
+	}
+
+	var buf []byte = nil
+	var w io.Writer = f
+	var r io.Reader = checksum(wrapReader(progress(readcloser, src, dest, info.Size(), opt), src, opt), dest, opt)
+
+	if opt.CopyBufferSize != 0 {
+		pooled := getBuffer(opt)
+		defer putBuffer(pooled, opt)
+		buf = *pooled
+		// Disable using `ReadFrom` by io.CopyBuffer.
+		// See https://github.com/otiai10/copy/pull/60#discussion_r627320811 for more details.
+		// Unless allowed, and the src file is read as it is, which makes `ReadFrom` worth it.
+		if !opt.AllowReadFromWithBuffer || opt.FS != nil || r != readcloser {
+			w = struct{ io.Writer }{f}
+		}
+		// r = struct{ io.Reader }{s}
 	}
-	defer fclose(f, &err)
 
+	var n int64
+	copied := false
+	if opt.CloneMode != CloneNever {
+		if copied, err = clonefile(f, readcloser, r, src, opt); err != nil {
+			return err
+		} else if copied {
+			n = info.Size()
+		}
+	}
+
+	if !copied {
+		if opt.intent.iosem != nil {
+			if err := opt.intent.iosem.Acquire(opt.intent.ctx, 1); err != nil {
+				return err
+			}
+		}
+		if s, ok := readcloser.(*os.File); ok && opt.Sparse && r == readcloser {
+			n, copied, err = sparse(f, s, info.Size(), buf)
+		}
+		if s, ok := readcloser.(*os.File); ok && !copied && r == readcloser &&
+			opt.ParallelChunkSize > 0 && opt.NumOfWorkers > 1 && info.Size() > opt.ParallelChunkSize {
+			n, err = copyChunks(f, s, info.Size(), opt)
+			copied = true
+		}
+		if !copied {
+			// If w is the dest file and r is the src file as it is,
+			// io.CopyBuffer lets the kernel copy the data by `ReadFrom`,
+			// with copy_file_range(2) or sendfile(2) on Linux.
+			n, err = io.CopyBuffer(w, r, buf)
+		}
+		if opt.intent.iosem != nil {
+			opt.intent.iosem.Release(1)
+		}
+	}
+	if opt.BytesWritten != nil {
+		atomic.AddInt64(opt.BytesWritten, n)
+	}
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case opt.SyncMode == SyncBatched && opt.intent.fsyncs != nil:
+		opt.intent.fsyncs.add(dest)
+	case opt.SyncMode != SyncNone:
+		err = f.Sync()
+	}
+
+	if opt.Verify {
+		if err := verify(src, dest, opt); err != nil {
+			return &os.PathError{Op: "verify", Path: dest, Err: err}
+		}
+	}
+
+	if opt.PreserveADS && opt.FS == nil {
+		if err := preserveADS(src, dest); err != nil {
+			return err
+		}
+	}
+	if opt.PreserveOwner || opt.ChownTo != nil {
+		if err := applyOwner(src, dest, info, opt); err != nil {
+			return err
+		}
+	}
+	if deferChmod {
+		if opt.PreserveXattrs {
+			if err := preserveXattrs(src, dest, opt); err != nil {
+				return err
+			}
+		}
+		if chmodfunc(&err); err != nil {
+			return err
+		}
+	}
+	if opt.PreserveMode {
+		if err := preserveMode(info, dest, opt); err != nil {
+			return err
+		}
+	}
+	if opt.PreserveACLs && opt.FS == nil {
+		if err := preserveACLs(src, dest, false, opt); err != nil {
+			return err
+		}
+	}
+	if opt.PreserveSELinux && opt.FS == nil {
+		if err := preserveSELinux(src, dest); err != nil {
+			return err
+		}
+	}
+	if opt.PreserveTimes {
+		if err := preserveTimes(info, dest, opt); err != nil {
+			return err
+		}
+	}
+	if opt.PreserveWindowsAttrs && opt.FS == nil {
+		if err := preserveWindowsAttrs(src, dest); err != nil {
+			return err
+		}
+	}
+	if opt.PreserveFileFlags && opt.FS == nil {
+		if err := preserveFlags(src, dest); err != nil {
+			return err
+		}
+	}
+	if opt.TimestampSink != nil {
+		opt.TimestampSink(dest, getTimeSpec(info))
+	}
+	if opt.FilesCopied != nil && err == nil {
+		atomic.AddInt64(opt.FilesCopied, 1)
+	}
+
+	return
+}
+
+// reapply brings the permission, the owner and the times of dest,
+// which is not copied again, into line with src,
+// only if AlwaysApplyPermissions is true.
+func reapply(src, dest string, info os.FileInfo, opt Options) (err error) {
+	if !opt.AlwaysApplyPermissions {
+		return nil
+	}
 	chmodfunc, err := opt.PermissionControl(info, dest)
 	if err != nil {
 		return err
 	}
-	chmodfunc(&err)
+	if chmodfunc(&err); err != nil {
+		return err
+	}
+	if opt.PreserveOwner || opt.ChownTo != nil {
+		if err := applyOwner(src, dest, info, opt); err != nil {
+			return err
+		}
+	}
+	if opt.PreserveMode {
+		if err := preserveMode(info, dest, opt); err != nil {
+			return err
+		}
+	}
+	if opt.PreserveTimes {
+		if err := preserveTimes(info, dest, opt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dcopy is for a directory,
+// with scanning contents inside the directory
+// and pass everything to "copy" recursively.
+func dcopy(srcdir, destdir string, info os.FileInfo, opt Options) (err error) {
+	if opt.SkipDirMarker != "" {
+		if marked, err := hasMarker(srcdir, destdir, opt); err != nil {
+			return err
+		} else if marked {
+			skipped(srcdir, destdir, "marked by "+opt.SkipDirMarker, opt)
+			return nil
+		}
+	}
+
+	if skip, err := onDirExists(opt, srcdir, destdir); err != nil {
+		return err
+	} else if skip {
+		skipped(srcdir, destdir, "OnDirExists", opt)
+		return nil
+	}
+
+	if opt.RateLimitFunc != nil {
+		if rate := opt.RateLimitFunc(srcdir); rate > 0 {
+			opt.intent.limiter = newLimiter(rate)
+		}
+	}
+
+	if opt.IgnoreFileName != "" {
+		if opt.intent.ignores, err = dirIgnores(srcdir, opt); err != nil {
+			return err
+		}
+	}
+
+	if opt.intent.subst != nil {
+		finish, err := dcontents(srcdir, destdir, info, opt)
+		if err == nil && finish != nil {
+			err = finish()
+		}
+		return err
+	}
+
+	if opt.ClearDestFlags {
+		if err := clearFlags(destdir); err != nil {
+			return err
+		}
+	}
+
+	// Make dest dir with DefaultDirMode so that everything writable.
+	unlock := lockdir(destdir, opt)
+	chmodfunc, err := permissionControl(info, destdir, opt)
+	unlock()
+	if err != nil {
+		return err
+	}
+
+	finish, err := dcontents(srcdir, destdir, info, opt)
+	if err == nil && opt.intent.bfs != nil {
+		// Subdirectories are only queued so far,
+		// then finish this directory after all of them are copied.
+		opt.intent.bfs.finally(func(failed error) error {
+			return dfinish(srcdir, destdir, finish, chmodfunc, failed, opt)
+		})
+		return nil
+	}
+	if err == nil && opt.intent.coalesced != nil {
+		opt.intent.coalesced.add(func(failed error) error {
+			return dfinish(srcdir, destdir, finish, chmodfunc, failed, opt)
+		})
+		return nil
+	}
+	return dfinish(srcdir, destdir, finish, chmodfunc, err, opt)
+}
+
+// dcontents copies the contents of srcdir into destdir,
+// and returns the function to be called after that, if any.
+func dcontents(srcdir, destdir string, info os.FileInfo, opt Options) (finish func() error, err error) {
+	// Even if PermissionControl doesn't create it, dest dir must exist here.
+	if opt.intent.subst != nil {
+		err = opt.intent.subst.dir(srcdir, destdir, info, opt)
+	} else {
+		err = mkdirAll(destdir, dirMode(info, opt), opt)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	contents, pruned, err := readdir(srcdir, destdir, opt)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if opt.KeepNewestPerDir > 0 {
+		var dropped []os.FileInfo
+		contents, dropped = newest(contents, opt.KeepNewestPerDir)
+		for _, content := range dropped {
+			cs, cd := childpaths(srcdir, destdir, content, opt)
+			skipped(cs, cd, "not newest", opt)
+		}
+	}
+
+	if opt.SyncMode == SyncBatched {
+		opt.intent.fsyncs = &fsyncs{}
+	}
+
+	if yes, err := shouldCopyDirectoryConcurrent(opt, srcdir, destdir); err != nil {
+		return nil, err
+	} else if yes {
+		if err := dcopyConcurrent(srcdir, destdir, contents, opt); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := dcopySequential(srcdir, destdir, contents, opt); err != nil {
+			return nil, err
+		}
+	}
+
+	if opt.SyncMode == SyncBatched {
+		if err := opt.intent.fsyncs.flush(destdir); err != nil {
+			return nil, err
+		}
+	}
+
+	return func() error {
+		if opt.Mirror {
+			// Entries skipped by SkipEntry still exist in srcdir.
+			if err := mirror(destdir, append(pruned, contents...), opt); err != nil {
+				return err
+			}
+		}
+
+		if opt.intent.subst != nil {
+			return nil // Nothing is written to have the metadata.
+		}
+
+		if opt.PreserveTimes {
+			if err := preserveTimes(info, destdir, opt); err != nil {
+				return err
+			}
+		}
+
+		if opt.PreserveOwner || opt.ChownTo != nil {
+			if err := applyOwner(srcdir, destdir, info, opt); err != nil {
+				return err
+			}
+		}
+
+		if opt.PreserveMode {
+			if err := preserveMode(info, destdir, opt); err != nil {
+				return err
+			}
+		}
+
+		if opt.PreserveXattrs && opt.FS == nil {
+			if err := preserveXattrs(srcdir, destdir, opt); err != nil {
+				return err
+			}
+		}
+
+		if opt.PreserveACLs && opt.FS == nil {
+			if err := preserveACLs(srcdir, destdir, true, opt); err != nil {
+				return err
+			}
+		}
 
-	var buf []byte = nil
-	var w io.Writer = f
-	var r io.Reader = readcloser
+		if opt.PreserveSELinux && opt.FS == nil {
+			if err := preserveSELinux(srcdir, destdir); err != nil {
+				return err
+			}
+		}
 
-	if opt.WrapReader != nil {
-		r = opt.WrapReader(r)
-	}
+		if opt.TimestampSink != nil {
+			opt.TimestampSink(destdir, getTimeSpec(info))
+		}
+		return nil
+	}, nil
+}
 
-	if opt.CopyBufferSize != 0 {
-		buf = make([]byte, opt.CopyBufferSize)
-		// Disable using `ReadFrom` by io.CopyBuffer.
-		// See https://github.com/otiai10/copy/pull/60#discussion_r627320811 for more details.
-		w = struct{ io.Writer }{f}
-		// r = struct{ io.Reader }{s}
+// dfinish calls finish unless failed, and then applies the permission of destdir
+// even if failed, and the file flags and Windows attributes of destdir only if succeeded.
+func dfinish(srcdir, destdir string, finish func() error, chmodfunc func(*error), failed error, opt Options) (err error) {
+	if opt.PreserveFileFlags && opt.FS == nil {
+		// Deferred before chmodfunc, so that it's applied at the very last.
+		defer func() {
+			if err == nil {
+				err = preserveFlags(srcdir, destdir)
+			}
+		}()
 	}
-
-	if _, err = io.CopyBuffer(w, r, buf); err != nil {
-		return err
+	if opt.PreserveWindowsAttrs && opt.FS == nil {
+		// Also after chmodfunc, which would change ReadOnly.
+		defer func() {
+			if err == nil {
+				err = preserveWindowsAttrs(srcdir, destdir)
+			}
+		}()
 	}
-
-	if opt.Sync {
-		err = f.Sync()
+	defer chmodfunc(&err)
+	if failed != nil {
+		return failed
 	}
-
-	if opt.PreserveOwner {
-		if err := preserveOwner(src, dest, info); err != nil {
+	if finish != nil {
+		if err := finish(); err != nil {
 			return err
 		}
 	}
-	if opt.PreserveTimes {
-		if err := preserveTimes(info, dest); err != nil {
-			return err
-		}
+	if opt.DirsCopied != nil {
+		atomic.AddInt64(opt.DirsCopied, 1)
 	}
-
-	return
+	return nil
 }
 
-// dcopy is for a directory,
-// with scanning contents inside the directory
-// and pass everything to "copy" recursively.
-func dcopy(srcdir, destdir string, info os.FileInfo, opt Options) (err error) {
-	if skip, err := onDirExists(opt, srcdir, destdir); err != nil {
-		return err
-	} else if skip {
-		return nil
+// readdir lists the contents of srcdir, regarding the source filesystem.
+// The entries skipped by SkipEntry are returned as pruned without being stat'ed.
+func readdir(srcdir, destdir string, opt Options) (contents, pruned []os.FileInfo, err error) {
+	var entries []fs.DirEntry
+	if opt.FS == nil {
+		entries, err = os.ReadDir(srcdir)
+	} else {
+		entries, err = fs.ReadDir(opt.FS, srcdir)
 	}
-
-	// Make dest dir with 0755 so that everything writable.
-	chmodfunc, err := opt.PermissionControl(info, destdir)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
-	defer chmodfunc(&err)
-
-	var contents []os.FileInfo
-	if opt.FS != nil {
-		entries, err := fs.ReadDir(opt.FS, srcdir)
-		if err != nil {
-			return err
-		}
-		for _, e := range entries {
-			info, err := e.Info()
-			if err != nil {
-				return err
+	contents = make([]os.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		if opt.SkipEntry != nil {
+			cs, cd := childpaths(srcdir, destdir, entryInfo{e}, opt)
+			if skip, err := opt.SkipEntry(e, cs, cd); err != nil {
+				return nil, nil, err
+			} else if skip {
+				skipped(cs, cd, "SkipEntry", opt)
+				pruned = append(pruned, entryInfo{e})
+				continue
 			}
-			contents = append(contents, info)
 		}
-	} else {
-		contents, err = ioutil.ReadDir(srcdir)
-	}
-
-	if err != nil {
+		info, err := e.Info()
 		if os.IsNotExist(err) {
-			return nil
+			continue // Removed after listed, as ioutil.ReadDir does.
 		}
-		return
+		if err != nil {
+			return nil, nil, err
+		}
+		contents = append(contents, info)
 	}
+	return contents, pruned, nil
+}
 
-	if yes, err := shouldCopyDirectoryConcurrent(opt, srcdir, destdir); err != nil {
-		return err
-	} else if yes {
-		if err := dcopyConcurrent(srcdir, destdir, contents, opt); err != nil {
-			return err
+// entryInfo is the FileInfo of a DirEntry not stat'ed,
+// which only tells the name and the type.
+type entryInfo struct {
+	fs.DirEntry
+}
+
+func (e entryInfo) Size() int64        { return 0 }
+func (e entryInfo) Mode() os.FileMode  { return e.Type() }
+func (e entryInfo) ModTime() time.Time { return time.Time{} }
+func (e entryInfo) Sys() interface{}   { return nil }
+
+// newest drops the regular files in contents except the newest n files,
+// keeping the order of contents.
+func newest(contents []os.FileInfo, n int) (kept, dropped []os.FileInfo) {
+	files := []int{}
+	for i, content := range contents {
+		if content.Mode().IsRegular() {
+			files = append(files, i)
 		}
-	} else {
-		if err := dcopySequential(srcdir, destdir, contents, opt); err != nil {
-			return err
+	}
+	if len(files) <= n {
+		return contents, nil
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return contents[files[i]].ModTime().After(contents[files[j]].ModTime())
+	})
+	drop := make(map[int]bool, len(files)-n)
+	for _, i := range files[n:] {
+		drop[i] = true
+	}
+	for i, content := range contents {
+		if drop[i] {
+			dropped = append(dropped, content)
+		} else {
+			kept = append(kept, content)
 		}
 	}
+	return kept, dropped
+}
 
-	if opt.PreserveTimes {
-		if err := preserveTimes(info, destdir); err != nil {
-			return err
-		}
+func dcopySequential(srcdir, destdir string, contents []os.FileInfo, opt Options) error {
+	if opt.PrefetchDepth > 0 {
+		return dcopyPrefetch(srcdir, destdir, contents, opt)
 	}
+	for _, content := range contents {
+		cs, cd := childpaths(srcdir, destdir, content, opt)
 
-	if opt.PreserveOwner {
-		if err := preserveOwner(srcdir, destdir, info); err != nil {
+		if err := copyNextOrSkip(cs, cd, content, opt); err != nil {
+			// If any error, exit immediately
 			return err
 		}
 	}
-
-	return
+	return nil
 }
 
-func dcopySequential(srcdir, destdir string, contents []os.FileInfo, opt Options) error {
-	for _, content := range contents {
-		cs, cd := filepath.Join(srcdir, content.Name()), filepath.Join(destdir, content.Name())
+// dcopyPrefetch copies contents sequentially in the order warmed up by the prefetcher.
+func dcopyPrefetch(srcdir, destdir string, contents []os.FileInfo, opt Options) error {
+	p := prefetch(srcdir, contents, opt)
+	defer p.stop()
+	for content := range p.queue {
+		cs, cd := childpaths(srcdir, destdir, content, opt)
 
 		if err := copyNextOrSkip(cs, cd, content, opt); err != nil {
 			// If any error, exit immediately
@@ -233,33 +1124,89 @@ func dcopySequential(srcdir, destdir string, contents []os.FileInfo, opt Options
 // Copy this directory concurrently regarding semaphore of opt.intent
 func dcopyConcurrent(srcdir, destdir string, contents []os.FileInfo, opt Options) error {
 	group, ctx := errgroup.WithContext(opt.intent.ctx)
-	getRoutine := func(cs, cd string, content os.FileInfo) func() error {
+	getRoutine := func(cs, cd string, content os.FileInfo, dir bool) func() error {
 		return func() error {
-			if content.IsDir() {
+			if dir {
+				defer opt.intent.dirsem.Release(1)
 				return copyNextOrSkip(cs, cd, content, opt)
 			}
+			defer opt.intent.sem.Release(1)
+			return copyNextOrSkip(cs, cd, content, opt)
+		}
+	}
+	for _, content := range contents {
+		csd, cdd := childpaths(srcdir, destdir, content, opt)
+		dir := dirlike(csd, content, opt)
+		if dir && !opt.intent.dirsem.TryAcquire(1) {
+			// No slot for another directory, then copy it in this goroutine.
+			if err := copyNextOrSkip(csd, cdd, content, opt); err != nil {
+				group.Wait()
+				return err
+			}
+			continue
+		}
+		if !dir {
+			// Wait for a worker before starting a goroutine, not in it,
+			// so that the goroutines copying files never outnumber
+			// NumOfWorkers in the whole tree, however wide it is.
 			if err := opt.intent.sem.Acquire(ctx, 1); err != nil {
+				if werr := group.Wait(); werr != nil {
+					return werr
+				}
 				return err
 			}
-			err := copyNextOrSkip(cs, cd, content, opt)
-			opt.intent.sem.Release(1)
-			return err
 		}
-	}
-	for _, content := range contents {
-		csd := filepath.Join(srcdir, content.Name())
-		cdd := filepath.Join(destdir, content.Name())
-		group.Go(getRoutine(csd, cdd, content))
+		group.Go(getRoutine(csd, cdd, content, dir))
 	}
 	return group.Wait()
 }
 
+// dirlike reports whether content is a directory, or a symlink to one,
+// which may be copied as a directory with its own workers for the files,
+// so it mustn't hold a worker for files while waiting for them.
+func dirlike(src string, content os.FileInfo, opt Options) bool {
+	if content.IsDir() {
+		return true
+	}
+	if content.Mode()&os.ModeSymlink == 0 {
+		return false
+	}
+	var info os.FileInfo
+	var err error
+	if opt.FS != nil {
+		info, err = fs.Stat(opt.FS, src)
+	} else {
+		info, err = os.Stat(src)
+	}
+	return err == nil && info.IsDir()
+}
+
+// hasMarker reports whether the directory has SkipDirMarker file,
+// in either src or dest regarding MarkerSide.
+func hasMarker(srcdir, destdir string, opt Options) (bool, error) {
+	var err error
+	if opt.MarkerSide == MarkerInDest {
+		_, err = statDest(filepath.Join(destdir, opt.SkipDirMarker), false, opt)
+	} else {
+		_, err = lstat(filepath.Join(srcdir, opt.SkipDirMarker), opt)
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
 func onDirExists(opt Options, srcdir, destdir string) (bool, error) {
-	_, err := os.Stat(destdir)
+	if opt.DestFS != nil {
+		return false, nil // OnDirExists can't be used with it.
+	}
+	_, err := statDest(destdir, true, opt)
 	if err == nil && opt.OnDirExists != nil && destdir != opt.intent.dest {
 		switch opt.OnDirExists(srcdir, destdir) {
 		case Replace:
-			if err := os.RemoveAll(destdir); err != nil {
+			if opt.intent.subst != nil {
+				opt.intent.subst.remove(srcdir, destdir, "OnDirExists")
+			} else if err := os.RemoveAll(destdir); err != nil {
 				return false, err
 			}
 		case Untouchable:
@@ -271,44 +1218,395 @@ func onDirExists(opt Options, srcdir, destdir string) (bool, error) {
 	return false, nil
 }
 
+// collapse copies the final target of the symlink chain from src,
+// or makes a hard link to the file already copied from the same target.
+func collapse(src, dest string, opt Options) error {
+	target, info, err := resolve(src)
+	if err != nil {
+		return err
+	}
+	if info.Mode().IsRegular() && opt.intent.subst == nil {
+		if first, loaded := opt.intent.collapsed.LoadOrStore(target, dest); loaded {
+			if err := mkdirAll(filepath.Dir(dest), os.ModePerm, opt); err != nil {
+				return err
+			}
+			err := os.Link(first.(string), dest)
+			if err == nil {
+				return nil
+			}
+			if opt.OnFallback != nil {
+				opt.OnFallback(src, HardLink, ByteCopy, err)
+			}
+		}
+	}
+	opt.intent.resolving = dest
+	return copyNextOrSkip(target, dest, info, opt)
+}
+
+// resolve follows the symlink chain from src to the end,
+// and returns the final target with its FileInfo.
+func resolve(src string) (string, os.FileInfo, error) {
+	visited := map[string]bool{}
+	for path := src; ; {
+		info, err := os.Lstat(path)
+		if err != nil {
+			return "", nil, err
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			return path, info, nil
+		}
+		if visited[path] {
+			return "", nil, &os.PathError{Op: "symlink", Path: src, Err: ErrSymlinkLoop}
+		}
+		visited[path] = true
+		target, err := os.Readlink(path)
+		if err != nil {
+			return "", nil, err
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(path), target)
+		}
+		path = target
+	}
+}
+
+// onsocket decides what to do on socket, whose connections can't be copied.
+func onsocket(src, dest string, info os.FileInfo, opt Options) error {
+	if opt.intent.report != nil {
+		opt.intent.report.socket()
+	}
+	action := SkipSocket
+	if opt.OnSocket != nil {
+		action = opt.OnSocket(src)
+	}
+	switch {
+	case action == ErrorSocket:
+		return &os.PathError{Op: "copy", Path: src, Err: ErrSocket}
+	case action == RecreateSocket && opt.intent.subst != nil:
+		return opt.intent.subst.special(src, dest, info, "socket", opt)
+	case action == RecreateSocket && opt.DestFS == nil:
+		return mksocket(src, dest, info, opt)
+	}
+	skipped(src, dest, "socket", opt)
+	return nil
+}
+
 func onsymlink(src, dest string, opt Options) error {
-	switch opt.OnSymlink(src) {
+	if _, ok := opt.FS.(ReadLinkFS); opt.FS != nil && !ok {
+		return fsymlink(src, dest, opt)
+	}
+	action, err := symlinkAction(src, opt)
+	if err != nil {
+		return err
+	}
+	switch action {
 	case Shallow:
-		if err := lcopy(src, dest); err != nil {
+		if opt.FollowDirSymlinks && opt.FS == nil {
+			if info, err := os.Stat(src); err == nil && info.IsDir() {
+				return dfollow(src, dest, info, opt)
+			}
+		}
+		if opt.intent.subst != nil {
+			return opt.intent.subst.symlink(src, dest, opt)
+		}
+		if err := lcopy(src, dest, opt); err != nil {
 			return err
 		}
-		if opt.PreserveTimes {
+		if opt.intent.report != nil {
+			opt.intent.report.symlinked()
+		}
+		if opt.PreserveXattrs && opt.FS == nil {
+			if err := preserveXattrs(src, dest, opt); err != nil {
+				return err
+			}
+		}
+		if opt.PreserveTimes && opt.FS == nil && opt.DestFS == nil {
 			return preserveLtimes(src, dest)
 		}
 		return nil
 	case Deep:
-		orig, err := os.Readlink(src)
+		if opt.CollapseSymlinkChains && opt.FS == nil {
+			return onloop(src, dest, collapse(src, dest, opt), opt)
+		}
+		orig, err := readlink(src, opt)
 		if err != nil {
 			return err
 		}
-		info, err := os.Lstat(orig)
+		if opt.FS != nil {
+			// Relative to the symlink, as paths of fs.FS are never absolute.
+			orig = path.Join(path.Dir(filepath.ToSlash(src)), orig)
+		}
+		info, err := lstat(orig, opt)
 		if err != nil {
 			return err
 		}
+		switch {
+		case info.IsDir():
+			if opt, err = follow(src, orig, opt); err != nil {
+				return onloop(src, dest, err, opt)
+			}
+			opt.intent.hops = 0
+		case info.Mode()&os.ModeSymlink != 0:
+			if opt.intent.hops++; opt.intent.hops > maxSymlinkHops {
+				return onloop(src, dest, &os.PathError{Op: "symlink", Path: src, Err: ErrSymlinkLoop}, opt)
+			}
+		default:
+			opt.intent.hops = 0
+		}
+		opt.intent.resolving = dest
 		return copyNextOrSkip(orig, dest, info, opt)
 	case Skip:
 		fallthrough
 	default:
+		skipped(src, dest, "OnSymlink", opt)
 		return nil // do nothing
 	}
 }
 
+// symlinkAction asks OnSymlinkEx or OnSymlink what to do on the symlink src.
+func symlinkAction(src string, opt Options) (SymlinkAction, error) {
+	if opt.OnSymlinkEx == nil {
+		return opt.OnSymlink(src), nil
+	}
+	target, err := readlink(src, opt)
+	if err != nil {
+		return Skip, err
+	}
+	var info os.FileInfo
+	if opt.FS != nil {
+		info, err = fs.Stat(opt.FS, path.Join(path.Dir(filepath.ToSlash(src)), target))
+	} else {
+		info, err = os.Stat(src)
+	}
+	if err != nil {
+		info = nil // Dangling, or pointing outside FS.
+	}
+	return opt.OnSymlinkEx(src, target, info), nil
+}
+
+// dfollow is for a symlink pointing to a directory,
+// with copying the resolved directory as a real one,
+// unless following it would recurse into itself.
+func dfollow(src, dest string, info os.FileInfo, opt Options) error {
+	opt, err := follow(src, src, opt)
+	if err != nil {
+		return onloop(src, dest, err, opt)
+	}
+	return dcopy(src, dest, info, opt)
+}
+
+// follow records the directory target, which the symlink src is followed to,
+// and fails with ErrSymlinkLoop if following it would recurse into itself:
+// target contains src, or it's already followed on the current branch of the tree.
+func follow(src, target string, opt Options) (Options, error) {
+	var parent string
+	var info os.FileInfo
+	var err error
+	if opt.FS != nil {
+		// Relative to the root, as paths of fs.FS are never absolute.
+		target, parent = path.Clean(target), path.Dir(filepath.ToSlash(src))
+	} else {
+		if target, err = realpath(target); err != nil {
+			return opt, err
+		}
+		if parent, err = realpath(filepath.Dir(src)); err != nil {
+			return opt, err
+		}
+		if info, err = os.Stat(target); err != nil {
+			return opt, err
+		}
+	}
+	if within(parent, target) {
+		return opt, &os.PathError{Op: "symlink", Path: src, Err: ErrSymlinkLoop}
+	}
+	for _, visited := range opt.intent.followed {
+		if visited.path == target || (info != nil && visited.info != nil && os.SameFile(visited.info, info)) {
+			return opt, &os.PathError{Op: "symlink", Path: src, Err: ErrSymlinkLoop}
+		}
+	}
+	followed := opt.intent.followed
+	opt.intent.followed = append(followed[:len(followed):len(followed)], followedDir{path: target, info: info})
+	return opt, nil
+}
+
+// onloop skips the symlink src if err is ErrSymlinkLoop and SkipSymlinkLoops is set.
+func onloop(src, dest string, err error, opt Options) error {
+	if opt.SkipSymlinkLoops && errors.Is(err, ErrSymlinkLoop) {
+		skipped(src, dest, "symlink loop", opt)
+		return nil
+	}
+	return err
+}
+
+// realpath resolves all the symlinks of the path
+// and makes it absolute.
+func realpath(path string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(resolved)
+}
+
+// within reports whether the path is the dir itself or under the dir.
+func within(path, dir string) bool {
+	if path == dir {
+		return true
+	}
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// wrapReader wraps the reader of src file,
+// regarding the options to read it.
+func wrapReader(r io.Reader, src string, opt Options) io.Reader {
+	if opt.WrapReader != nil {
+		r = opt.WrapReader(r)
+	}
+
+	if opt.LineTransform != nil {
+		r = transformLines(r, src, opt)
+	}
+
+	if opt.intent.ctx.Done() != nil {
+		r = &contextReader{opt.intent.ctx, r}
+	}
+
+	limiters := []*limiter{}
+	if opt.intent.limiter != nil {
+		limiters = append(limiters, opt.intent.limiter)
+	}
+	if opt.intent.bandwidth != nil {
+		limiters = append(limiters, opt.intent.bandwidth)
+	}
+	if opt.FileBandwidthLimit > 0 {
+		limiters = append(limiters, newLimiter(opt.FileBandwidthLimit))
+	}
+	if len(limiters) != 0 {
+		r = &throttledReader{r, limiters}
+	}
+
+	return r
+}
+
+// create creates dest file along with its parent directories,
+// with the mode given by fileMode if it doesn't exist yet.
+// If DedupeDestNames is true, it doesn't overwrite the existing file
+// but creates a file with another name, which is returned.
+func create(dest string, info os.FileInfo, opt Options) (*os.File, string, error) {
+	if err := mkdirAll(filepath.Dir(dest), os.ModePerm, opt); err != nil {
+		return nil, dest, err
+	}
+	perm := fileMode(info, opt)
+	if opt.AppendMode {
+		f, err := os.OpenFile(dest, os.O_APPEND|os.O_CREATE|os.O_WRONLY, perm)
+		return f, dest, err
+	}
+	if !opt.DedupeDestNames {
+		f, err := os.OpenFile(dest, os.O_RDWR|os.O_CREATE|os.O_TRUNC, perm)
+		return f, dest, err
+	}
+	dir, name := filepath.Split(dest)
+	base, ext := strings.TrimSuffix(name, filepath.Ext(name)), filepath.Ext(name)
+	if base == "" { // e.g. ".bashrc"
+		base, ext = name, ""
+	}
+	for n := 1; ; n++ {
+		// O_EXCL makes sure that no one else has created it meanwhile.
+		f, err := os.OpenFile(dest, os.O_RDWR|os.O_CREATE|os.O_EXCL, perm)
+		if !os.IsExist(err) {
+			return f, dest, err
+		}
+		dest = destpath(dir, opt.DedupeFormat(base, n)+ext, opt)
+	}
+}
+
+// slink is for a file to be linked instead of copied,
+// with creating a new symlink pointing to src.
+func slink(src, dest string, opt Options) error {
+	target, err := filepath.Abs(src)
+	if err != nil {
+		return err
+	}
+	if opt.RelativeSymlinkTargets {
+		dir, err := filepath.Abs(filepath.Dir(dest))
+		if err != nil {
+			return err
+		}
+		if target, err = filepath.Rel(dir, target); err != nil {
+			return err
+		}
+	}
+	if err := mkdirAll(filepath.Dir(dest), os.ModePerm, opt); err != nil {
+		return err
+	}
+	if err := os.Symlink(target, dest); err != nil {
+		return err
+	}
+	if opt.PreserveTimes {
+		return preserveLtimes(src, dest)
+	}
+	return nil
+}
+
 // lcopy is for a symlink,
 // with just creating a new symlink by replicating src symlink.
-func lcopy(src, dest string) error {
-	src, err := os.Readlink(src)
+func lcopy(src, dest string, opt Options) error {
+	target, err := readlink(src, opt)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil
 		}
 		return err
 	}
-	return os.Symlink(src, dest)
+	if opt.RewriteSymlinks != KeepSymlinkTargets && opt.FS == nil {
+		target = rewriteSymlink(target, dest, opt)
+	}
+	if opt.RewriteSymlinkTarget != nil {
+		target = opt.RewriteSymlinkTarget(target)
+	}
+	if opt.ValidateSymlinkTarget != nil {
+		if err := opt.ValidateSymlinkTarget(target); err != nil {
+			return &os.PathError{Op: "symlink", Path: src, Err: err}
+		}
+	}
+	if len(opt.PathRenames) != 0 {
+		// The parent might not be copied, if renamed.
+		if err := mkdirAll(filepath.Dir(dest), os.ModePerm, opt); err != nil {
+			return err
+		}
+	}
+	if opt.DestFS != nil {
+		return opt.DestFS.Symlink(target, dest)
+	}
+	return os.Symlink(target, dest)
+}
+
+// lockdir locks the destination directory while copying concurrently,
+// so that only one goroutine creates the same directory at a time.
+func lockdir(dir string, opt Options) (unlock func()) {
+	if opt.intent.dirs == nil {
+		return func() {}
+	}
+	mu, _ := opt.intent.dirs.LoadOrStore(filepath.Clean(dir), new(sync.Mutex))
+	mu.(*sync.Mutex).Lock()
+	return mu.(*sync.Mutex).Unlock
+}
+
+// mkdirAll creates the directory and its parents if not exist,
+// tolerating the directory created by someone else meanwhile.
+func mkdirAll(dir string, perm os.FileMode, opt Options) error {
+	defer lockdir(dir, opt)()
+	if opt.DestFS != nil {
+		return opt.DestFS.MkdirAll(dir, perm)
+	}
+	err := os.MkdirAll(dir, perm)
+	if err != nil {
+		if info, serr := os.Stat(dir); serr == nil && info.IsDir() {
+			return nil
+		}
+	}
+	return err
 }
 
 // fclose ANYHOW closes file,
@@ -323,9 +1621,25 @@ func fclose(f io.Closer, reported *error) {
 // onError lets caller to handle errors
 // occured when copying a file.
 func onError(src, dest string, err error, opt Options) error {
+	if opt.intent.collected != nil && err != nil && !stopping(err) {
+		opt.intent.collected.add(src, dest, err)
+		ignored(src, dest, err, opt)
+		return nil
+	}
+	if opt.OnErrorAction != nil {
+		if err == nil || opt.OnErrorAction(src, dest, err) == Ignore {
+			ignored(src, dest, err, opt)
+			return nil
+		}
+		return err
+	}
 	if opt.OnError == nil {
 		return err
 	}
 
-	return opt.OnError(src, dest, err)
+	if ferr := opt.OnError(src, dest, err); ferr != nil {
+		return ferr
+	}
+	ignored(src, dest, err, opt)
+	return nil
 }
@@ -0,0 +1,56 @@
+package copy
+
+import (
+	"path/filepath"
+	"sync"
+)
+
+// CopyAll copies each of srcs into the directory dest, named by its base name,
+// as if Copy is called for each of them with the same options in one go:
+// the workers, BandwidthLimit, TimeBudget and ChecksumManifest are shared,
+// and what's done is reported as one.
+// Sources are copied one by one in the given order.
+// StripPrefix and TrailingSlashSemantics decide where each goes, as Copy,
+// so that directories can be merged into the same dest.
+// If a file is to be copied where another source has been copied,
+// it's an error of ErrDestCollision, unless DedupeDestNames is set.
+func CopyAll(dest string, srcs []string, opts ...Options) (CopyReport, error) {
+	return withReport(opts, func(opt Options) error {
+		return copyAll(dest, srcs, opt)
+	})
+}
+
+func copyAll(dest string, srcs []string, o Options) error {
+	opt := assureOptions("", dest, o)
+	if err := checkConflicts(opt); err != nil {
+		return err
+	}
+	if !opt.DedupeDestNames {
+		opt.intent.claimed = new(sync.Map)
+	}
+	opt, stop, err := prepare(opt)
+	if err != nil {
+		return err
+	}
+	defer stop()
+	for _, src := range srcs {
+		root := dest
+		if opt.StripPrefix == "" && !opt.TrailingSlashSemantics {
+			root = filepath.Join(dest, filepath.Base(filepath.Clean(src)))
+		}
+		if root, err = destroot(src, root, opt); err == nil {
+			err = insideSrc(src, root, opt)
+		}
+		if err != nil {
+			if err := onError(src, root, err, opt); err != nil {
+				return err
+			}
+			continue
+		}
+		opt.intent.src, opt.intent.dest = src, root
+		if err := walk(src, root, opt); err != nil {
+			return err
+		}
+	}
+	return finish(opt)
+}
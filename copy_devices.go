@@ -0,0 +1,40 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package copy
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// devcopy is for device files, created by mknod
+// with the same device numbers as src.
+func devcopy(src, dest string, info os.FileInfo, opt Options) error {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		skipped(src, dest, "device", opt) // e.g. in FS, without the device numbers.
+		return nil
+	}
+	if err := mkdirAll(filepath.Dir(dest), os.ModePerm, opt); err != nil {
+		return err
+	}
+	mode := uint32(info.Mode().Perm())
+	if info.Mode()&os.ModeCharDevice != 0 {
+		mode |= unix.S_IFCHR
+	} else {
+		mode |= unix.S_IFBLK
+	}
+	if err := unix.Mknod(dest, mode, int(stat.Rdev)); err != nil {
+		err = &os.PathError{Op: "mknod", Path: dest, Err: err}
+		if opt.OnDeviceError != nil && opt.OnDeviceError(src, err) == SkipDevice {
+			skipped(src, dest, "device", opt)
+			return nil
+		}
+		return err
+	}
+	return specialMetadata(src, dest, info, opt)
+}
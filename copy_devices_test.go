@@ -0,0 +1,45 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package copy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	. "github.com/otiai10/mint"
+)
+
+func TestOptions_Specials_Devices(t *testing.T) {
+	src := "/dev/null"
+	srcinfo, err := os.Lstat(src)
+	if err != nil {
+		t.Skip("no device to copy:", err)
+	}
+
+	dest := filepath.Join(t.TempDir(), "null")
+	err = Copy(src, dest)
+	Expect(t, err).ToBe(nil)
+	_, err = os.Lstat(dest)
+	Expect(t, os.IsNotExist(err)).ToBe(true)
+
+	err = Copy(src, dest, Options{Specials: true})
+	if errors.Is(err, syscall.EPERM) {
+		When(t, "mknod is not permitted", func(t *testing.T) {
+			dest := filepath.Join(t.TempDir(), "null")
+			err := Copy(src, dest, Options{Specials: true, OnDeviceError: func(string, error) DeviceAction { return SkipDevice }})
+			Expect(t, err).ToBe(nil)
+			_, err = os.Lstat(dest)
+			Expect(t, os.IsNotExist(err)).ToBe(true)
+		})
+		return
+	}
+	Expect(t, err).ToBe(nil)
+	info, err := os.Lstat(dest)
+	Expect(t, err).ToBe(nil)
+	Expect(t, info.Mode()).ToBe(srcinfo.Mode())
+	Expect(t, info.Sys().(*syscall.Stat_t).Rdev).ToBe(srcinfo.Sys().(*syscall.Stat_t).Rdev)
+}
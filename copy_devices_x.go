@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package copy
+
+import (
+	"os"
+)
+
+func devcopy(src, dest string, info os.FileInfo, opt Options) error {
+	skipped(src, dest, "device", opt)
+	return nil // Unsupported
+}
@@ -9,10 +9,42 @@ import (
 	"syscall"
 )
 
-// pcopy is for just named pipes
-func pcopy(dest string, info os.FileInfo) error {
-	if err := os.MkdirAll(filepath.Dir(dest), os.ModePerm); err != nil {
+// pcopy is for just named pipes,
+// with its metadata applied in the same way as regular files.
+func pcopy(src, dest string, info os.FileInfo, opt Options) error {
+	if err := mkdirAll(filepath.Dir(dest), os.ModePerm, opt); err != nil {
 		return err
 	}
-	return syscall.Mkfifo(dest, uint32(info.Mode()))
+	if err := syscall.Mkfifo(dest, uint32(info.Mode().Perm())); err != nil {
+		return err
+	}
+	return specialMetadata(src, dest, info, opt)
+}
+
+// specialMetadata applies the metadata of special file src to dest,
+// in the same way as regular files.
+func specialMetadata(src, dest string, info os.FileInfo, opt Options) (err error) {
+	chmodfunc, err := opt.PermissionControl(info, dest)
+	if err != nil {
+		return err
+	}
+	if chmodfunc(&err); err != nil {
+		return err
+	}
+	if opt.PreserveOwner || opt.ChownTo != nil {
+		if err := applyOwner(src, dest, info, opt); err != nil {
+			return err
+		}
+	}
+	if opt.PreserveMode {
+		if err := preserveMode(info, dest, opt); err != nil {
+			return err
+		}
+	}
+	if opt.PreserveTimes {
+		if err := preserveTimes(info, dest, opt); err != nil {
+			return err
+		}
+	}
+	return nil
 }
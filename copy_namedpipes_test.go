@@ -0,0 +1,40 @@
+//go:build !windows && !plan9 && !netbsd && !aix && !illumos && !solaris && !js
+// +build !windows,!plan9,!netbsd,!aix,!illumos,!solaris,!js
+
+package copy
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	. "github.com/otiai10/mint"
+)
+
+func TestCopy_NamedPipe_Metadata(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "fifo")
+	Expect(t, syscall.Mkfifo(src, 0o600)).ToBe(nil)
+	Expect(t, os.Chmod(src, 0o640)).ToBe(nil)
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	Expect(t, os.Chtimes(src, mtime, mtime)).ToBe(nil)
+
+	dest := filepath.Join(t.TempDir(), "fifo")
+	err := Copy(src, dest, Options{PreserveTimes: true, PreserveOwner: true})
+	Expect(t, err).ToBe(nil)
+	info, err := os.Lstat(dest)
+	Expect(t, err).ToBe(nil)
+	Expect(t, info.Mode()&os.ModeNamedPipe != 0).ToBe(true)
+	Expect(t, info.Mode().Perm()).ToBe(os.FileMode(0o640))
+	Expect(t, info.ModTime().Equal(mtime)).ToBe(true)
+
+	When(t, "AddPermission is given", func(t *testing.T) {
+		dest := filepath.Join(t.TempDir(), "fifo")
+		err := Copy(src, dest, Options{AddPermission: 0o004})
+		Expect(t, err).ToBe(nil)
+		info, err := os.Lstat(dest)
+		Expect(t, err).ToBe(nil)
+		Expect(t, info.Mode().Perm()).ToBe(os.FileMode(0o644))
+	})
+}
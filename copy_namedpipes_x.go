@@ -10,6 +10,6 @@ import (
 // TODO: check plan9 netbsd aix illumos solaris in future
 
 // pcopy is for just named pipes. Windows doesn't support them
-func pcopy(dest string, info os.FileInfo) error {
+func pcopy(src, dest string, info os.FileInfo, opt Options) error {
 	return nil
 }
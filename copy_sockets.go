@@ -0,0 +1,27 @@
+//go:build !windows && !plan9 && !netbsd && !aix && !illumos && !solaris && !js
+// +build !windows,!plan9,!netbsd,!aix,!illumos,!solaris,!js
+
+package copy
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+)
+
+// mksocket creates a socket file at dest as a placeholder of src,
+// by binding a socket which is closed right away without unlinking it.
+func mksocket(src, dest string, info os.FileInfo, opt Options) error {
+	if err := mkdirAll(filepath.Dir(dest), os.ModePerm, opt); err != nil {
+		return err
+	}
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: dest, Net: "unix"})
+	if err != nil {
+		return err
+	}
+	l.SetUnlinkOnClose(false)
+	if err := l.Close(); err != nil {
+		return err
+	}
+	return specialMetadata(src, dest, info, opt)
+}
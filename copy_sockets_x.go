@@ -0,0 +1,13 @@
+//go:build windows || plan9 || netbsd || aix || illumos || solaris || js
+// +build windows plan9 netbsd aix illumos solaris js
+
+package copy
+
+import (
+	"os"
+)
+
+func mksocket(src, dest string, info os.FileInfo, opt Options) error {
+	skipped(src, dest, "socket", opt)
+	return nil // Unsupported
+}
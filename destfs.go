@@ -0,0 +1,116 @@
+package copy
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// WriteFS is a writable filesystem to copy into, given by Options.DestFS,
+// such as an in-memory filesystem or a fake for tests.
+// The names are the dest paths as they would be on the OS filesystem.
+type WriteFS interface {
+	// MkdirAll creates the directory along with its parents if not exist.
+	MkdirAll(name string, perm fs.FileMode) error
+	// Create creates or truncates the file to be written.
+	Create(name string) (io.WriteCloser, error)
+	// Symlink creates newname as a symlink to oldname.
+	Symlink(oldname, newname string) error
+	// Chmod changes the mode of the file.
+	Chmod(name string, mode fs.FileMode) error
+	// Chtimes changes the access and modification times of the file.
+	Chtimes(name string, atime, mtime time.Time) error
+}
+
+// fcopyFS is for a file to be copied into Options.DestFS.
+func fcopyFS(src, dest string, info os.FileInfo, opt Options) (err error) {
+	readcloser, err := open(src, opt)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return
+	}
+	defer fclose(readcloser, &err)
+
+	if err := mkdirAll(filepath.Dir(dest), os.ModePerm, opt); err != nil {
+		return err
+	}
+	w, err := opt.DestFS.Create(dest)
+	if err != nil {
+		return err
+	}
+
+	var buf []byte
+	if opt.CopyBufferSize != 0 {
+		pooled := getBuffer(opt)
+		defer putBuffer(pooled, opt)
+		buf = *pooled
+	}
+	if opt.intent.iosem != nil {
+		if err := opt.intent.iosem.Acquire(opt.intent.ctx, 1); err != nil {
+			fclose(w, &err)
+			return err
+		}
+	}
+	n, err := io.CopyBuffer(w, wrapReader(progress(readcloser, src, dest, info.Size(), opt), src, opt), buf)
+	if opt.intent.iosem != nil {
+		opt.intent.iosem.Release(1)
+	}
+	if opt.BytesWritten != nil {
+		atomic.AddInt64(opt.BytesWritten, n)
+	}
+	if s, ok := w.(interface{ Sync() error }); ok && err == nil && opt.SyncMode != SyncNone {
+		err = s.Sync()
+	}
+	if fclose(w, &err); err != nil {
+		return err
+	}
+
+	chmodfunc, err := permissionControl(info, dest, opt)
+	if err != nil {
+		return err
+	}
+	if chmodfunc(&err); err != nil {
+		return err
+	}
+	if opt.PreserveTimes {
+		if err := preserveTimes(info, dest, opt); err != nil {
+			return err
+		}
+	}
+	if opt.TimestampSink != nil {
+		opt.TimestampSink(dest, getTimeSpec(info))
+	}
+	if opt.FilesCopied != nil {
+		atomic.AddInt64(opt.FilesCopied, 1)
+	}
+	return nil
+}
+
+// permissionControl calls PermissionControl, or for DestFS,
+// applies the mode of src with AddPermission instead.
+func permissionControl(info os.FileInfo, dest string, opt Options) (func(*error), error) {
+	if opt.DestFS == nil {
+		if info.IsDir() && (opt.DefaultDirMode != 0 || opt.CreateWithSourceMode) {
+			// Created here, PermissionControl finds it already exists.
+			if err := os.MkdirAll(dest, dirMode(info, opt)); err != nil {
+				return func(*error) {}, err
+			}
+		}
+		return opt.PermissionControl(info, dest)
+	}
+	if info.IsDir() {
+		if err := opt.DestFS.MkdirAll(dest, dirMode(info, opt)); err != nil {
+			return func(*error) {}, err
+		}
+	}
+	return func(reported *error) {
+		if err := opt.DestFS.Chmod(dest, info.Mode().Perm()|opt.AddPermission); *reported == nil {
+			*reported = err
+		}
+	}, nil
+}
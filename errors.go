@@ -0,0 +1,146 @@
+package copy
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	// ErrVerifyMismatch is returned when the copied content
+	// is different from the source on verification.
+	ErrVerifyMismatch = errors.New("copied content doesn't match the source")
+
+	// ErrTimeBudgetExceeded is returned when Options.TimeBudget is over
+	// before all the entries are copied.
+	ErrTimeBudgetExceeded = errors.New("time budget exceeded")
+
+	// ErrConflictingOptions is returned when the options
+	// which can't be used together are given.
+	ErrConflictingOptions = errors.New("conflicting options")
+
+	// ErrUnsafeSymlinkTarget is returned by SafeSymlinkTarget,
+	// or by CopyFromArchive for a symlink pointing outside the archive.
+	ErrUnsafeSymlinkTarget = errors.New("unsafe symlink target")
+
+	// ErrUnsafeArchivePath is returned by CopyFromArchive
+	// for an entry named to be extracted outside dest.
+	ErrUnsafeArchivePath = errors.New("unsafe path in archive")
+
+	// ErrDestCollision is returned by CopyAll
+	// when an entry is copied to where another source has been copied.
+	ErrDestCollision = errors.New("dest collides with another source")
+
+	// ErrDestinationInsideSource is returned when dest is src itself or under src,
+	// which would make the copy recurse endlessly.
+	ErrDestinationInsideSource = errors.New("dest is inside src")
+
+	// ErrSymlinkLoop is returned when following a symlink
+	// would make the copy recurse endlessly.
+	ErrSymlinkLoop = errors.New("symlink loop detected")
+
+	// ErrPrefixMismatch is returned when src is not under Options.StripPrefix.
+	ErrPrefixMismatch = errors.New("src does not match the prefix to strip")
+
+	// ErrSocket is returned when OnSocket says ErrorSocket.
+	ErrSocket = errors.New("socket cannot be copied")
+
+	// ErrEmptyFile is returned when OnEmptyFile says ErrorEmpty.
+	ErrEmptyFile = errors.New("empty file")
+)
+
+// VerifyMismatchError is ErrVerifyMismatch with
+// the byte offset where the first difference is found.
+type VerifyMismatchError struct {
+	// Offset is -1 if unknown, such as when compared by digests.
+	Offset int64
+}
+
+func (e *VerifyMismatchError) Error() string {
+	if e.Offset < 0 {
+		return ErrVerifyMismatch.Error()
+	}
+	return fmt.Sprintf("%s at offset %d", ErrVerifyMismatch.Error(), e.Offset)
+}
+
+func (e *VerifyMismatchError) Is(target error) bool {
+	return target == ErrVerifyMismatch
+}
+
+// CollectedErrors is returned by ErrorPolicy: ContinueAndCollect,
+// holding the errors of all the entries failed to copy.
+type CollectedErrors struct {
+	// Errors holds the errors in the order they occurred.
+	Errors []EntryError
+}
+
+func (e *CollectedErrors) Error() string {
+	if len(e.Errors) == 1 {
+		return e.Errors[0].Error()
+	}
+	return fmt.Sprintf("%d entries failed to copy, first: %v", len(e.Errors), e.Errors[0])
+}
+
+// Unwrap returns the errors, so that errors.Is and errors.As
+// can tell if any of them matches.
+func (e *CollectedErrors) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, err := range e.Errors {
+		errs[i] = err
+	}
+	return errs
+}
+
+// Is tells if any of the errors matches target,
+// for errors.Is before Go 1.20 which doesn't know Unwrap() []error.
+func (e *CollectedErrors) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first of the errors that matches target,
+// for errors.As before Go 1.20 which doesn't know Unwrap() []error.
+func (e *CollectedErrors) As(target any) bool {
+	for _, err := range e.Errors {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Paths returns the src paths of the entries failed to copy.
+func (e *CollectedErrors) Paths() []string {
+	paths := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		paths[i] = err.Src
+	}
+	return paths
+}
+
+// collector collects the errors by ErrorPolicy: ContinueAndCollect,
+// even when copying concurrently.
+type collector struct {
+	mu   sync.Mutex
+	errs []EntryError
+}
+
+func (c *collector) add(src, dest string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.errs = append(c.errs, EntryError{Src: src, Dest: dest, Err: err})
+}
+
+// err returns *CollectedErrors if any, or nil.
+func (c *collector) err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.errs) == 0 {
+		return nil
+	}
+	return &CollectedErrors{Errors: c.errs}
+}
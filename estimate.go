@@ -0,0 +1,67 @@
+package copy
+
+import "os"
+
+// EstimateResult summarizes what Copy would copy.
+type EstimateResult struct {
+	// Bytes is the total size of the files.
+	Bytes int64
+	// Files is the number of the files, including named pipes and devices.
+	Files int64
+	// Dirs is the number of the directories.
+	Dirs int64
+	// Symlinks is the number of the symlinks to be created.
+	Symlinks int64
+}
+
+// Estimate walks src and reports how much Copy would copy,
+// without touching any destination.
+// The same options as Copy are respected, such as Skip and OnSymlink,
+// so that the estimate matches what a real copy would copy.
+func Estimate(src string, opts ...Options) (EstimateResult, error) {
+	result := EstimateResult{}
+	opt := assureOptions(src, "", opts...)
+	if err := checkConflicts(opt); err != nil {
+		return result, err
+	}
+	opt, err := substituted(opt, &result)
+	if err != nil {
+		return result, err
+	}
+	info, err := lstat(src, opt)
+	if err != nil {
+		return result, onError(src, "", err, opt)
+	}
+	err = switchboard(src, "", info, opt)
+	return result, err
+}
+
+// stat always says dest doesn't exist, as there is no dest to estimate with.
+func (r *EstimateResult) stat(dest string, follow bool) (os.FileInfo, error) {
+	return nil, nothing(dest)
+}
+
+func (r *EstimateResult) dir(srcdir, destdir string, info os.FileInfo, opt Options) error {
+	r.Dirs++
+	return nil
+}
+
+func (r *EstimateResult) file(src, dest string, info os.FileInfo, opt Options) error {
+	r.Files++
+	r.Bytes += info.Size()
+	return nil
+}
+
+func (r *EstimateResult) symlink(src, dest string, opt Options) error {
+	r.Symlinks++
+	return nil
+}
+
+func (r *EstimateResult) special(src, dest string, info os.FileInfo, kind string, opt Options) error {
+	r.Files++
+	return nil
+}
+
+func (r *EstimateResult) remove(src, dest, reason string) {}
+
+func (r *EstimateResult) skip(src, dest, reason string) {}
@@ -3,6 +3,7 @@ package copy
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
@@ -42,3 +43,30 @@ func ExampleOptions() {
 	// Skipped: true
 
 }
+
+func ExamplePlan() {
+
+	ops, err := Plan(
+		"test/data/example",
+		"test/data.copy/example_planned",
+		Options{
+			Skip: func(info os.FileInfo, src, dest string) (bool, error) {
+				return strings.HasSuffix(src, ".git-like"), nil
+			},
+		},
+	)
+	fmt.Println("Error:", err)
+	for _, op := range ops {
+		fmt.Println(op.Kind, filepath.ToSlash(op.Src))
+	}
+	_, err = os.Stat("test/data.copy/example_planned")
+	fmt.Println("Untouched:", os.IsNotExist(err))
+
+	// Output:
+	// Error: <nil>
+	// mkdir test/data/example
+	// skip test/data/example/.git-like
+	// create test/data/example/README.md
+	// Untouched: true
+
+}
@@ -0,0 +1,53 @@
+//go:build linux
+// +build linux
+
+package copy
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	. "github.com/otiai10/mint"
+)
+
+func TestOptions_OnFallback(t *testing.T) {
+	// LinkDest on another device than dest, so that hard links fail.
+	prev, err := ioutil.TempDir("/dev/shm", "prev")
+	if err != nil {
+		t.Skipf("/dev/shm is not available: %v", err)
+	}
+	defer os.RemoveAll(prev)
+	dest := t.TempDir()
+	var previnfo, destinfo syscall.Stat_t
+	Expect(t, syscall.Stat(prev, &previnfo)).ToBe(nil)
+	Expect(t, syscall.Stat(dest, &destinfo)).ToBe(nil)
+	if previnfo.Dev == destinfo.Dev {
+		t.Skip("/dev/shm is on the same device as the temp dir")
+	}
+
+	src := t.TempDir()
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "file"), []byte("content"), 0o644)).ToBe(nil)
+	err = Copy(src, prev, Options{PreserveTimes: true})
+	Expect(t, err).ToBe(nil)
+
+	var fallbacks []string
+	opt := Options{
+		LinkDest: prev,
+		OnFallback: func(src string, from, to CopyMethod, reason error) {
+			Expect(t, from).ToBe(HardLink)
+			Expect(t, to).ToBe(ByteCopy)
+			Expect(t, errors.Is(reason, syscall.EXDEV)).ToBe(true)
+			fallbacks = append(fallbacks, filepath.Base(src))
+		},
+	}
+	err = Copy(src, dest, opt)
+	Expect(t, err).ToBe(nil)
+	Expect(t, fallbacks).ToBe([]string{"file"})
+	b, err := ioutil.ReadFile(filepath.Join(dest, "file"))
+	Expect(t, err).ToBe(nil)
+	Expect(t, string(b)).ToBe("content")
+}
@@ -0,0 +1,84 @@
+package copy
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// filtered tells why src is skipped by Exclude, ignore files or Include, or "" if not.
+func filtered(src string, info os.FileInfo, opt Options) (string, error) {
+	rel, err := filepath.Rel(opt.intent.src, src)
+	if err != nil {
+		return "", err
+	}
+	rel = filepath.ToSlash(rel)
+	if matched, err := matchAny(opt.Exclude, rel, info.IsDir()); err != nil {
+		return "", err
+	} else if matched {
+		return "Exclude", nil
+	}
+	if ignored, err := opt.intent.ignores.match(rel, info.IsDir()); err != nil {
+		return "", err
+	} else if ignored {
+		return "ignore file", nil
+	}
+	if len(opt.Include) == 0 || info.IsDir() {
+		return "", nil
+	}
+	if matched, err := matchAny(opt.Include, rel, false); err != nil || matched {
+		return "", err
+	}
+	return "Include", nil
+}
+
+// matchAny reports whether the relative path matches any of the patterns.
+func matchAny(patterns []string, rel string, isdir bool) (bool, error) {
+	for _, pattern := range patterns {
+		segments, dirOnly := compileGlob(pattern)
+		if dirOnly && !isdir {
+			continue
+		}
+		matched, err := matchSegments(segments, strings.Split(rel, "/"))
+		if err != nil || matched {
+			return matched, err
+		}
+	}
+	return false, nil
+}
+
+// compileGlob splits the pattern into the segments for matchSegments,
+// and tells if it matches only directories by the trailing "/".
+// A pattern without "/" but the trailing one matches the name at any depth.
+func compileGlob(pattern string) ([]string, bool) {
+	dirOnly := strings.HasSuffix(pattern, "/")
+	pattern = strings.TrimSuffix(pattern, "/")
+	if !strings.Contains(pattern, "/") {
+		pattern = "**/" + pattern
+	}
+	return strings.Split(strings.TrimPrefix(pattern, "/"), "/"), dirOnly
+}
+
+// matchSegments matches the path segments against the pattern segments,
+// where "**" matches zero or more segments.
+func matchSegments(patterns, names []string) (bool, error) {
+	for len(patterns) > 0 {
+		if patterns[0] == "**" {
+			for i := 0; i <= len(names); i++ {
+				if matched, err := matchSegments(patterns[1:], names[i:]); err != nil || matched {
+					return matched, err
+				}
+			}
+			return false, nil
+		}
+		if len(names) == 0 {
+			return false, nil
+		}
+		if matched, err := path.Match(patterns[0], names[0]); err != nil || !matched {
+			return false, err
+		}
+		patterns, names = patterns[1:], names[1:]
+	}
+	return len(names) == 0, nil
+}
@@ -0,0 +1,30 @@
+package copy
+
+import (
+	"io/fs"
+)
+
+// ReadLinkFS is an fs.FS which can read symlinks, such as os.DirFS since Go 1.25,
+// in the same shape as fs.ReadLinkFS, so that symlinks in Options.FS
+// are copied as OnSymlink says, as those on the OS filesystem.
+type ReadLinkFS interface {
+	fs.FS
+	// ReadLink returns the target of the symlink.
+	ReadLink(name string) (string, error)
+	// Lstat returns the FileInfo of the file without following symlinks.
+	Lstat(name string) (fs.FileInfo, error)
+}
+
+// fsymlink is for a symlink in Options.FS which can't read symlinks,
+// handled by FSSymlinkFallback instead of OnSymlink.
+func fsymlink(src, dest string, opt Options) error {
+	if opt.FSSymlinkFallback != Deep {
+		skipped(src, dest, "FSSymlinkFallback", opt)
+		return nil
+	}
+	info, err := fs.Stat(opt.FS, src)
+	if err != nil {
+		return err
+	}
+	return copyNextOrSkip(src, dest, info, opt)
+}
@@ -0,0 +1,30 @@
+package copy
+
+import "sync"
+
+// fsyncs holds files written in a directory,
+// to be synced at once by SyncBatched.
+type fsyncs struct {
+	mu    sync.Mutex
+	files []string
+}
+
+// add adds a file to be synced.
+func (s *fsyncs) add(file string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files = append(s.files, file)
+}
+
+// flush syncs all the files added so far, and then the directory.
+func (s *fsyncs) flush(dir string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, file := range s.files {
+		if err := fsync(file); err != nil {
+			return err
+		}
+	}
+	s.files = nil
+	return fsyncdir(dir)
+}
@@ -0,0 +1,26 @@
+//go:build !windows
+// +build !windows
+
+package copy
+
+import "os"
+
+// fsyncdir syncs the directory, so that the entries in it are on the disk.
+func fsyncdir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// fsync syncs the file, opened read-only as it may be read-only already.
+func fsync(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
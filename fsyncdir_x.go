@@ -0,0 +1,21 @@
+//go:build windows
+// +build windows
+
+package copy
+
+import "os"
+
+// fsyncdir does nothing, because directories can't be synced on Windows.
+func fsyncdir(dir string) error {
+	return nil
+}
+
+// fsync syncs the file, opened for writing as Windows needs it to flush.
+func fsync(file string) error {
+	f, err := os.OpenFile(file, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
@@ -5,5 +5,6 @@ go 1.18
 require (
 	github.com/otiai10/mint v1.5.1
 	golang.org/x/sync v0.3.0
-	golang.org/x/sys v0.0.0-20220715151400-c0bba94af5f8
+	golang.org/x/sys v0.0.0-20220722155257-8c9f86f7a55f
+	golang.org/x/text v0.3.8
 )
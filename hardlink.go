@@ -0,0 +1,34 @@
+package copy
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// hardlink makes dest a hard link to the dest file already copied
+// from another hard link to the same file as src, by PreserveHardLinks.
+// It reports false to copy src as usual, if it's the first one or can't be linked.
+func hardlink(src, dest string, info os.FileInfo, opt Options) (bool, error) {
+	id, ok := fileID(info)
+	if !ok {
+		return false, nil
+	}
+	first, loaded := opt.intent.inodes.LoadOrStore(id, dest)
+	if !loaded {
+		return false, nil
+	}
+	if err := mkdirAll(filepath.Dir(dest), os.ModePerm, opt); err != nil {
+		return false, err
+	}
+	if err := os.Remove(dest); err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	if err := os.Link(first.(string), dest); err != nil {
+		// e.g. the first one is not created yet by another goroutine.
+		if opt.OnFallback != nil {
+			opt.OnFallback(src, HardLink, ByteCopy, err)
+		}
+		return false, nil
+	}
+	return true, nil
+}
@@ -0,0 +1,24 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package copy
+
+import (
+	"os"
+	"syscall"
+)
+
+// inode identifies a file on a device.
+type inode struct {
+	dev uint64
+	ino uint64
+}
+
+// fileID returns the inode of the file, only if it has multiple hard links.
+func fileID(info os.FileInfo) (inode, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || !info.Mode().IsRegular() || stat.Nlink < 2 {
+		return inode{}, false
+	}
+	return inode{dev: uint64(stat.Dev), ino: uint64(stat.Ino)}, true
+}
@@ -0,0 +1,12 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package copy
+
+import "os"
+
+type inode struct{}
+
+func fileID(info os.FileInfo) (inode, bool) {
+	return inode{}, false // Unsupported
+}
@@ -0,0 +1,63 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package copy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/otiai10/mint"
+)
+
+func TestOptions_PreserveHardLinks(t *testing.T) {
+	src := t.TempDir()
+	Expect(t, os.Mkdir(filepath.Join(src, "sub"), 0o755)).ToBe(nil)
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "a"), []byte("shared"), 0o644)).ToBe(nil)
+	Expect(t, os.Link(filepath.Join(src, "a"), filepath.Join(src, "b"))).ToBe(nil)
+	Expect(t, os.Link(filepath.Join(src, "a"), filepath.Join(src, "sub", "c"))).ToBe(nil)
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "d"), []byte("shared"), 0o644)).ToBe(nil)
+
+	dest := filepath.Join(t.TempDir(), "dest")
+	err := Copy(src, dest, Options{PreserveHardLinks: true})
+	Expect(t, err).ToBe(nil)
+	a, err := os.Stat(filepath.Join(dest, "a"))
+	Expect(t, err).ToBe(nil)
+	for _, name := range []string{"b", filepath.Join("sub", "c")} {
+		info, err := os.Stat(filepath.Join(dest, name))
+		Expect(t, err).ToBe(nil)
+		Expect(t, os.SameFile(a, info)).ToBe(true)
+	}
+	d, err := os.Stat(filepath.Join(dest, "d"))
+	Expect(t, err).ToBe(nil)
+	Expect(t, os.SameFile(a, d)).ToBe(false)
+
+	plain := filepath.Join(t.TempDir(), "plain")
+	err = Copy(src, plain)
+	Expect(t, err).ToBe(nil)
+	a, err = os.Stat(filepath.Join(plain, "a"))
+	Expect(t, err).ToBe(nil)
+	b, err := os.Stat(filepath.Join(plain, "b"))
+	Expect(t, err).ToBe(nil)
+	Expect(t, os.SameFile(a, b)).ToBe(false)
+
+	When(t, "copied again by Atomic with changed content", func(t *testing.T) {
+		src := t.TempDir()
+		Expect(t, ioutil.WriteFile(filepath.Join(src, "a"), []byte("old"), 0o644)).ToBe(nil)
+		Expect(t, os.Link(filepath.Join(src, "a"), filepath.Join(src, "b"))).ToBe(nil)
+		dest := filepath.Join(t.TempDir(), "dest")
+		Expect(t, Copy(src, dest, Options{PreserveHardLinks: true, Atomic: true})).ToBe(nil)
+		Expect(t, ioutil.WriteFile(filepath.Join(src, "a"), []byte("new"), 0o644)).ToBe(nil)
+		Expect(t, Copy(src, dest, Options{PreserveHardLinks: true, Atomic: true})).ToBe(nil)
+		for _, name := range []string{"a", "b"} {
+			b, err := ioutil.ReadFile(filepath.Join(dest, name))
+			Expect(t, err).ToBe(nil)
+			Expect(t, string(b)).ToBe("new")
+		}
+		entries, err := ioutil.ReadDir(dest)
+		Expect(t, err).ToBe(nil)
+		Expect(t, len(entries)).ToBe(2)
+	})
+}
@@ -0,0 +1,104 @@
+package copy
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreRule is a line of an ignore file in the .gitignore syntax.
+type ignoreRule struct {
+	// base is the slash-separated directory of the ignore file relative to src,
+	// or "" for the root, under which the rule is applied.
+	base     string
+	segments []string
+	dirOnly  bool
+	negate   bool
+}
+
+// ignoreRules are the rules applied in order, where the last matching one wins.
+type ignoreRules []ignoreRule
+
+// match reports whether the slash-separated path relative to src is ignored.
+func (rules ignoreRules) match(rel string, isdir bool) (bool, error) {
+	ignored := false
+	for _, rule := range rules {
+		sub := rel
+		if rule.base != "" {
+			if !strings.HasPrefix(rel, rule.base+"/") {
+				continue
+			}
+			sub = rel[len(rule.base)+1:]
+		}
+		if rule.dirOnly && !isdir {
+			continue
+		}
+		matched, err := matchSegments(rule.segments, strings.Split(sub, "/"))
+		if err != nil {
+			return false, err
+		}
+		if matched {
+			ignored = !rule.negate
+		}
+	}
+	return ignored, nil
+}
+
+// parseIgnore parses the rules of an ignore file in the directory base.
+func parseIgnore(r io.Reader, base string) (ignoreRules, error) {
+	rules := ignoreRules{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := ignoreRule{base: base}
+		if strings.HasPrefix(line, "!") {
+			rule.negate, line = true, line[1:]
+		} else if strings.HasPrefix(line, `\#`) || strings.HasPrefix(line, `\!`) {
+			line = line[1:]
+		}
+		rule.segments, rule.dirOnly = compileGlob(line)
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+// readIgnoreFile reads the ignore file given by Options.IgnoreFile.
+func readIgnoreFile(name string) (ignoreRules, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseIgnore(f, "")
+}
+
+// dirIgnores returns the rules applied under srcdir,
+// adding those of Options.IgnoreFileName in srcdir, if it exists.
+func dirIgnores(srcdir string, opt Options) (ignoreRules, error) {
+	f, err := open(filepath.Join(srcdir, opt.IgnoreFileName), opt)
+	if os.IsNotExist(err) {
+		return opt.intent.ignores, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	base, err := filepath.Rel(opt.intent.src, srcdir)
+	if err != nil {
+		return nil, err
+	}
+	if base = filepath.ToSlash(base); base == "." {
+		base = ""
+	}
+	rules, err := parseIgnore(f, base)
+	if err != nil {
+		return nil, err
+	}
+	// Not to share the backing array with the other subtrees.
+	return append(opt.intent.ignores[:len(opt.intent.ignores):len(opt.intent.ignores)], rules...), nil
+}
@@ -0,0 +1,46 @@
+package copy
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// linkdest makes dest a hard link to the file of the same relative path
+// in Options.LinkDest, if it's unchanged from src.
+// It reports false to copy src as usual, if it's changed or can't be linked.
+func linkdest(src, dest string, info os.FileInfo, opt Options) (bool, error) {
+	ref, same, err := linkable(src, info, opt)
+	if err != nil || !same {
+		return false, err
+	}
+	if err := mkdirAll(filepath.Dir(dest), os.ModePerm, opt); err != nil {
+		return false, err
+	}
+	if err := os.Remove(dest); err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	if err := os.Link(ref, dest); err != nil {
+		// e.g. on another device, then just copy it.
+		if opt.OnFallback != nil {
+			opt.OnFallback(src, HardLink, ByteCopy, err)
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+// linkable returns the file of the same relative path in Options.LinkDest,
+// and reports whether it's unchanged from src.
+func linkable(src string, info os.FileInfo, opt Options) (string, bool, error) {
+	rel, err := filepath.Rel(opt.intent.src, src)
+	if err != nil {
+		return "", false, nil
+	}
+	ref := filepath.Join(opt.LinkDest, rel)
+	opt.intent.subst = nil // ref is always what it is, not in dest.
+	same, err := sameSizeAndTime(ref, info, opt)
+	if err == nil && !same && opt.SkipIfContentEqual {
+		same, err = sameContent(src, ref, info, opt)
+	}
+	return ref, same, err
+}
@@ -0,0 +1,71 @@
+package copy
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// mirror deletes the entries in destdir which don't exist in srcdir.
+// Entries skipped by Skip are not deleted,
+// as they still exist in srcdir.
+func mirror(destdir string, contents []os.FileInfo, opt Options) error {
+	if opt.intent.subst != nil {
+		if _, err := opt.intent.subst.stat(destdir, false); err != nil {
+			return nil // Nothing to delete in destdir yet to be made.
+		}
+	}
+	extra, err := extraneous(destdir, contents, opt)
+	if err != nil {
+		return err
+	}
+	for _, dest := range extra {
+		if opt.intent.subst != nil {
+			opt.intent.subst.remove("", dest, "Mirror")
+			continue
+		}
+		if opt.ConfirmDelete != nil {
+			if yes, err := opt.ConfirmDelete(dest); err != nil {
+				return err
+			} else if !yes {
+				continue
+			}
+		}
+		if err := os.RemoveAll(dest); err != nil {
+			return err
+		}
+		if opt.intent.sync != nil {
+			opt.intent.sync.deleted(dest, opt)
+		}
+	}
+	return nil
+}
+
+// extraneous returns the entries in destdir which don't exist in srcdir.
+func extraneous(destdir string, contents []os.FileInfo, opt Options) ([]string, error) {
+	names := make(map[string]bool, len(contents))
+	for _, content := range contents {
+		names[destname(content, opt)] = true
+	}
+	entries, err := os.ReadDir(destdir)
+	if err != nil {
+		return nil, err
+	}
+	extra := []string{}
+	for _, e := range entries {
+		if !names[e.Name()] && !renamedTo(destpath(destdir, e.Name(), opt), opt) {
+			extra = append(extra, destpath(destdir, e.Name(), opt))
+		}
+	}
+	return extra, nil
+}
+
+// renamedTo reports whether dest is, or is a parent of,
+// a destination given by PathRenames.
+func renamedTo(dest string, opt Options) bool {
+	for _, to := range opt.PathRenames {
+		if within(destpath(opt.intent.dest, filepath.FromSlash(to), opt), dest) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package copy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Move moves src to dest by os.Rename, or by copying and then removing src
+// if they are on different filesystems, which can't be renamed across.
+// On copying, the options are respected just as Copy,
+// and src is removed only after everything is copied without any error,
+// including the verification by Options.Verify.
+// The entries not copied on purpose, such as by Skip,
+// and those with errors ignored by OnError are left in src.
+func Move(src, dest string, opts ...Options) error {
+	opt := Options{}
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	if opt.FS != nil {
+		return fmt.Errorf("%w: Move and FS", ErrConflictingOptions)
+	}
+	if opt.DestFS != nil {
+		return fmt.Errorf("%w: Move and DestFS", ErrConflictingOptions)
+	}
+	err := os.Rename(src, dest)
+	if err == nil || !crossDevice(err) {
+		return err
+	}
+	report, err := CopyWithReport(src, dest, opt)
+	if err != nil {
+		return err
+	}
+	kept := report.Skipped
+	for _, e := range report.Errors {
+		kept = append(kept, e.Src)
+	}
+	return removeMoved(src, kept)
+}
+
+// removeMoved removes src after copied by Move,
+// except the entries kept in src and the directories containing them.
+func removeMoved(src string, kept []string) error {
+	if len(kept) == 0 {
+		return os.RemoveAll(src)
+	}
+	dirs := []string{}
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		for _, k := range kept {
+			if within(path, k) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+		if info.IsDir() {
+			dirs = append(dirs, path)
+			return nil
+		}
+		return os.Remove(path)
+	})
+	if err != nil {
+		return err
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if containsAny(dirs[i], kept) {
+			continue
+		}
+		if err := os.Remove(dirs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// containsAny reports whether any of paths is within dir.
+func containsAny(dir string, paths []string) bool {
+	for _, p := range paths {
+		if within(p, dir) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,18 @@
+//go:build !plan9
+// +build !plan9
+
+package copy
+
+import (
+	"errors"
+	"runtime"
+	"syscall"
+)
+
+// errNotSameDevice is ERROR_NOT_SAME_DEVICE, returned by renaming across volumes on Windows.
+const errNotSameDevice = syscall.Errno(17)
+
+// crossDevice reports whether err is of renaming across filesystems.
+func crossDevice(err error) bool {
+	return errors.Is(err, syscall.EXDEV) || (runtime.GOOS == "windows" && errors.Is(err, errNotSameDevice))
+}
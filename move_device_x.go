@@ -0,0 +1,9 @@
+//go:build plan9
+// +build plan9
+
+package copy
+
+// Unsupported
+func crossDevice(err error) bool {
+	return false
+}
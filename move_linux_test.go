@@ -0,0 +1,62 @@
+package copy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	. "github.com/otiai10/mint"
+	"golang.org/x/sys/unix"
+)
+
+func TestMove_CrossDevice(t *testing.T) {
+	other, err := ioutil.TempDir("/dev/shm", "copy-move-")
+	if err != nil {
+		t.Skip("no other filesystem to move across:", err)
+	}
+	defer os.RemoveAll(other)
+
+	src := t.TempDir()
+	Expect(t, os.MkdirAll(filepath.Join(src, "dir", "sub"), 0o755)).ToBe(nil)
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "dir", "file"), []byte("moved"), 0o644)).ToBe(nil)
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "dir", "sub", "file_skip"), []byte("kept"), 0o644)).ToBe(nil)
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "file"), []byte("moved"), 0o644)).ToBe(nil)
+
+	err = os.Rename(filepath.Join(src, "file"), filepath.Join(other, "file"))
+	if !crossDevice(err) {
+		t.Skip("/dev/shm is on the same filesystem:", err)
+	}
+
+	dest := filepath.Join(other, "dest")
+	err = Move(src, dest, Options{Skip: func(info os.FileInfo, src, dest string) (bool, error) {
+		return strings.HasSuffix(src, "_skip"), nil
+	}, Verify: true})
+	Expect(t, err).ToBe(nil)
+	b, err := ioutil.ReadFile(filepath.Join(dest, "dir", "file"))
+	Expect(t, err).ToBe(nil)
+	Expect(t, string(b)).ToBe("moved")
+	_, err = os.Stat(filepath.Join(src, "dir", "file"))
+	Expect(t, os.IsNotExist(err)).ToBe(true)
+	_, err = os.Stat(filepath.Join(src, "file"))
+	Expect(t, os.IsNotExist(err)).ToBe(true)
+	_, err = os.Stat(filepath.Join(src, "dir", "sub", "file_skip"))
+	Expect(t, err).ToBe(nil)
+	_, err = os.Stat(filepath.Join(dest, "dir", "sub", "file_skip"))
+	Expect(t, os.IsNotExist(err)).ToBe(true)
+
+	When(t, "src has a device, which is not copied without Specials", func(t *testing.T) {
+		src := t.TempDir()
+		if err := unix.Mknod(filepath.Join(src, "null"), syscall.S_IFCHR|0o666, int(unix.Mkdev(1, 3))); err != nil {
+			t.Skip("mknod is not permitted:", err)
+		}
+		dest := filepath.Join(other, "device")
+		Expect(t, Move(src, dest)).ToBe(nil)
+		_, err := os.Lstat(filepath.Join(src, "null"))
+		Expect(t, err).ToBe(nil)
+		_, err = os.Lstat(filepath.Join(dest, "null"))
+		Expect(t, os.IsNotExist(err)).ToBe(true)
+	})
+}
@@ -2,11 +2,18 @@ package copy
 
 import (
 	"context"
+	"crypto"
+	"crypto/sha256"
+	"fmt"
+	"hash"
 	"io"
 	"io/fs"
 	"os"
+	"sync"
+	"time"
 
 	"golang.org/x/sync/semaphore"
+	"golang.org/x/text/unicode/norm"
 )
 
 // Options specifies optional actions on copying.
@@ -15,18 +22,139 @@ type Options struct {
 	// OnSymlink can specify what to do on symlink
 	OnSymlink func(src string) SymlinkAction
 
+	// OnSymlinkEx can specify what to do on symlink, instead of OnSymlink,
+	// regarding where it points, such as inside or outside src.
+	// target is as read from the symlink, and info is of what it points to,
+	// which is nil if it doesn't exist.
+	OnSymlinkEx func(src, target string, info os.FileInfo) SymlinkAction
+
+	// CollapseSymlinkChains makes Deep follow a chain of symlinks
+	// such as a -> b -> file to the end, with loops detected,
+	// and copy the final target. If more than one symlink reach
+	// the same file, their dest files are hard-linked together
+	// instead of copied again.
+	CollapseSymlinkChains bool
+
+	// FollowDirSymlinks makes symlinks pointing to directories copied
+	// as real directories, even if OnSymlink says Shallow.
+	// Symlinks pointing to files are still handled by OnSymlink.
+	FollowDirSymlinks bool
+
+	// ValidateSymlinkTarget can reject the target of symlink
+	// before the symlink is created in dest by Shallow,
+	// e.g. when copying an untrusted tree.
+	// The error returned is handled by OnError.
+	// See SafeSymlinkTarget for a ready-made one.
+	ValidateSymlinkTarget func(target string) error
+
+	// RewriteSymlinks rewrites absolute targets of symlinks copied by Shallow,
+	// if they point inside src, so that they point inside dest instead.
+	// It's ignored when FS is given.
+	RewriteSymlinks SymlinkRewrite
+
+	// RewriteSymlinkTarget can rewrite the target of each symlink copied by Shallow,
+	// after RewriteSymlinks and before ValidateSymlinkTarget.
+	RewriteSymlinkTarget func(target string) string
+
+	// OnSocket can specify what to do on unix domain socket,
+	// whose connections can't be copied. By default, sockets are skipped.
+	OnSocket func(src string) SocketAction
+
+	// SkipSymlinkLoops skips symlinks which would make the copy recurse endlessly,
+	// such as those pointing to their parents, followed by Deep or FollowDirSymlinks.
+	// By default, it fails with ErrSymlinkLoop.
+	SkipSymlinkLoops bool
+
 	// OnDirExists can specify what to do when there is a directory already existing in destination.
 	OnDirExists func(src, dest string) DirExistsAction
 
+	// OnEmptyFile can specify what to do on a regular file with zero bytes.
+	OnEmptyFile func(src, dest string) EmptyFileAction
+
+	// OnFileExists can specify what to do when there is a file already existing in destination,
+	// consulted before opening it. By default, it's overwritten.
+	// It can't be used with DestFS.
+	OnFileExists func(src, dest string) FileExistsAction
+
 	// OnErr lets called decide whether or not to continue on particular copy error.
 	OnError func(src, dest string, err error) error
 
+	// OnErrorAction lets caller decide what to do on particular copy error,
+	// whether to abort, ignore the error, or retry copying the file.
+	// A file is retried up to 3 times, then the error is returned.
+	// If given, OnErrorAction takes precedence over OnError.
+	OnErrorAction func(src, dest string, err error) ErrorAction
+
+	// Retry copies a file again on error, such as a timeout on NFS
+	// or a sharing violation on Windows, before the error is handled
+	// by OnError, OnErrorAction or ErrorPolicy.
+	Retry RetryPolicy
+
+	// ErrorPolicy decides whether to stop copying at the first error (default),
+	// or to go on copying the other entries and return all the errors at the end.
+	// OnError and OnErrorAction can't be used with ContinueAndCollect.
+	ErrorPolicy ErrorPolicy
+
+	// Exclude skips the entries matching any of the glob patterns,
+	// such as "node_modules/" and "*.log", along with everything under them.
+	// Patterns are matched against the slash-separated path relative to src,
+	// where "**" matches any number of directories, and a trailing "/"
+	// matches only directories. A pattern without "/" but the trailing one
+	// matches the name at any depth. It's applied before Skip.
+	Exclude []string
+
+	// Include, if given, copies only the files matching any of the glob patterns
+	// in the same syntax as Exclude, while directories are walked anyway
+	// to find the files under them. Exclude takes precedence over it.
+	Include []string
+
+	// IgnoreFileName is the name of ignore files, such as ".gitignore" or ".copyignore",
+	// looked up in each src directory. The entries under the directory
+	// matching their rules in the .gitignore syntax are skipped.
+	IgnoreFileName string
+
+	// IgnoreFile is the path to an ignore file in the .gitignore syntax,
+	// whose rules are matched against the paths relative to src.
+	IgnoreFile string
+
 	// Skip can specify which files should be skipped
 	Skip func(srcinfo os.FileInfo, src, dest string) (bool, error)
 
+	// SkipEntry is called for each entry as soon as its directory is read,
+	// before the entry is stat'ed, so that skipping many entries is cheap.
+	// Unlike Skip, the entry only tells its name and type without Info called.
+	// Entries skipped by it are not deleted by Mirror, as they still exist in src.
+	SkipEntry func(entry fs.DirEntry, src, dest string) (bool, error)
+
+	// SkipDir is called only for directories, before Skip,
+	// and prunes the directory along with everything under it if true,
+	// without reading the directory at all, e.g. for ".git" or caches.
+	SkipDir func(entry fs.DirEntry, src, dest string) (prune bool, err error)
+
+	// SkipDirMarker skips directories which have a file with this name,
+	// such as ".nocopy", along with everything under them.
+	SkipDirMarker string
+
+	// KeepNewestPerDir copies only the newest N regular files
+	// by mtime in each directory, and the others are skipped.
+	// Directories and the other entries are copied as usual.
+	// If 0, all the files are copied.
+	KeepNewestPerDir int
+
+	// MarkerSide specifies whether SkipDirMarker is looked for
+	// in src directories (default) or in dest directories.
+	MarkerSide MarkerSide
+
 	// Specials includes special files to be copied. default false.
+	// Device files are created by mknod with the same device numbers,
+	// which usually needs the privilege. See OnDeviceError.
 	Specials bool
 
+	// OnDeviceError can specify what to do when a device file
+	// can't be created by Specials, such as by a non-root user.
+	// By default, it's an error.
+	OnDeviceError func(src string, err error) DeviceAction
+
 	// AddPermission to every entities,
 	// NO MORE THAN 0777
 	// @OBSOLETE
@@ -41,39 +169,468 @@ type Options struct {
 	// See permission_control.go for more detail.
 	PermissionControl PermissionControlFunc
 
+	// DefaultDirMode is the mode with which dest directories are created
+	// before PermissionControl is applied, 0755 by default.
+	// It should be writable by the owner, so that the contents can be copied.
+	DefaultDirMode os.FileMode
+
+	// DefaultFileMode is the mode with which dest files are created
+	// before PermissionControl is applied, 0666 by default.
+	// Both are subject to umask.
+	DefaultFileMode os.FileMode
+
+	// CreateWithSourceMode creates dest files with the mode of src,
+	// and directories with that mode plus the owner's permissions,
+	// instead of DefaultFileMode and DefaultDirMode,
+	// so that they are never more accessible than src while being copied.
+	CreateWithSourceMode bool
+
+	// AlwaysApplyPermissions applies PermissionControl, and PreserveOwner,
+	// ChownTo and PreserveTimes if given, even to existing dest files
+	// which are not copied again, such as by SkipIfContentEqual,
+	// ShouldCopy or Sync, so that copying again fixes their metadata too.
+	AlwaysApplyPermissions bool
+
+	// RequireDestRootParent makes Copy fail if the parent directory
+	// of dest doesn't exist, instead of creating missing parents.
+	RequireDestRootParent bool
+
+	// PreCreateDest creates (or truncates) each dest file first,
+	// even before opening the src file, so that watchers can see
+	// the dest file appear as soon as its copy starts.
+	// Be careful that the dest file is visible while it's partially written,
+	// and it's left empty or partial if the copy fails.
+	// It can't be used with Atomic or VerifyAndRollback.
+	PreCreateDest bool
+
+	// DedupeDestNames never overwrites existing dest files,
+	// but copies files with new names such as "file (1).txt" instead.
+	DedupeDestNames bool
+
+	// DedupeFormat makes a new name of the file without the extension,
+	// such as "file (1)" for "file", used by DedupeDestNames.
+	DedupeFormat func(base string, n int) string
+
+	// PathRenames maps slash-separated relative paths in src
+	// to the relative paths in dest, such as "a/b.txt" to "c/d.txt".
+	// Entries not in the map are copied to their default paths,
+	// and parent directories of the renamed paths are created if needed.
+	PathRenames map[string]string
+
+	// BackupDir is a directory to save existing dest files into,
+	// right before they are overwritten, with the same relative paths.
+	// It's useful to undo merging src into dest.
+	BackupDir string
+
+	// Backup saves the existing dest file with another name,
+	// right before it's overwritten, such as "file.txt.bak" or "file.txt.~1~".
+	// If BackupDir is also given, it's saved there with the name.
+	// Mirror can't be used with it without BackupDir.
+	Backup BackupMode
+
+	// BackupSuffix is the suffix of the name by SimpleBackup, ".bak" by default.
+	BackupSuffix string
+
+	// BackupName customizes the backup path of dest for Backup.
+	// n is 0 for SimpleBackup, or the number from 1 for NumberedBackup,
+	// which is incremented until the returned path doesn't exist.
+	BackupName func(dest string, n int) string
+
+	// AppendMode appends the content of each src file to the end of
+	// the existing dest file, instead of overwriting it.
+	// Be careful that copying again duplicates the content,
+	// unless SkipIfContentEqual skips files already copied.
+	// A file copied again by Retry or OnErrorAction is truncated back
+	// to the size before the first attempt, not to append the content twice.
+	// It can't be used with the options which replace dest files,
+	// such as VerifyAndRollback, Atomic, PreCreateDest, DedupeDestNames,
+	// LinkDest, PreserveHardLinks and SymlinkFiles.
+	AppendMode bool
+
+	// VerifyAndRollback copies each file into a temporary file first,
+	// and replaces the dest file with it only after verifying
+	// that its content is the same as the src file.
+	// If the verification fails, the temporary file is removed
+	// and the dest file is left intact, with VerifyMismatchError returned.
+	// PreCreateDest and LineTransform can't be used with it.
+	VerifyAndRollback bool
+
+	// Atomic copies each file into a temporary file next to dest first,
+	// and renames it over dest only after it's copied successfully,
+	// and synced if SyncMode is given, so that a crash never leaves
+	// a partial file with the final name, and the existing dest file
+	// is never truncated by a failed copy. If Verify is also given,
+	// the temporary file is verified before renamed, as VerifyAndRollback.
+	// PreCreateDest can't be used with it.
+	Atomic bool
+
+	// Verify reads each dest file again after copying it,
+	// and compares it with the src file, byte by byte or by digests
+	// with CompareByHash, to return VerifyMismatchError if different.
+	// Unlike VerifyAndRollback, the dest file is left as copied.
+	// Files written by BatchWriter are not verified,
+	// and LineTransform and AppendMode can't be used with it.
+	Verify bool
+
+	// Resume writes each file into a partial file, dest with ResumeSuffix,
+	// and renames it into place when it's complete.
+	// If a partial file is left by an interrupted copy, it's continued
+	// from the end of it, as long as it has the same digest, by Hasher
+	// or SHA-256 by default, as the beginning of the src file.
+	// Otherwise, the file is copied from the beginning again.
+	// Resume renames files into place by itself, so Atomic isn't needed,
+	// and VerifyAndRollback, Atomic, LineTransform, DedupeDestNames and AppendMode can't be used with it.
+	Resume bool
+
+	// ResumeSuffix is the suffix of partial files by Resume, ".part" by default.
+	ResumeSuffix string
+
 	// Sync file after copy.
 	// Useful in case when file must be on the disk
 	// (in case crash happens, for example),
-	// at the expense of some performance penalty
+	// at the expense of some performance penalty.
+	// It's the same as SyncMode: SyncPerFile.
 	Sync bool
 
+	// SyncMode specifies how to make copied files durable on the disk.
+	// See SyncPerFile and SyncBatched for the guarantees of each.
+	// By default, it's SyncNone, or SyncPerFile if Sync is true.
+	SyncMode SyncMode
+
+	// Mirror deletes entries in dest directories
+	// which don't exist in the corresponding src directories,
+	// like `rsync --delete`.
+	// Entries skipped by Skip are not deleted.
+	Mirror bool
+
+	// ConfirmDelete is called before Mirror deletes each entry in dest,
+	// and it's deleted only if true is returned.
+	// If an error is returned, copying stops with it.
+	// Plan doesn't call it, but lists all the entries to be deleted.
+	ConfirmDelete func(dest string) (bool, error)
+
+	// SymlinkFiles creates symlinks pointing to src files
+	// instead of copying them, while directories are still created.
+	// Be careful that the destination shares the data with the source,
+	// so that writing to dest files modifies src files.
+	// PreserveTimes is applied to the symlinks themselves.
+	// It is ignored when FS is given.
+	SymlinkFiles bool
+
+	// RelativeSymlinkTargets makes the symlinks created by SymlinkFiles
+	// point to src files by relative paths, instead of absolute paths.
+	RelativeSymlinkTargets bool
+
+	// SkipUnchanged skips copying files whose dest has the same size
+	// and mtime in seconds as src, like rsync does by default.
+	// Because the mtime is compared, copy with PreserveTimes to make use of it.
+	// If SkipIfContentEqual is also true, files with different mtime
+	// are then compared by the content.
+	SkipUnchanged bool
+
+	// SkipIfContentEqual skips copying a file if the destination
+	// already has the same content, regardless of its metadata.
+	// Contents are compared only when their sizes are the same.
+	SkipIfContentEqual bool
+
+	// CompareByHash compares contents by their digests made by Hasher,
+	// instead of byte by byte, to skip copying files with the same digest.
+	// It implies SkipIfContentEqual, and it's also used where
+	// contents are compared, such as by Sync and LinkDest.
+	CompareByHash bool
+
+	// Hasher makes the hash function used by CompareByHash.
+	// If nil, sha256.New is used.
+	Hasher func() hash.Hash
+
+	// ShouldCopy decides whether to copy the src file
+	// onto the dest file which already exists, e.g. by comparing etags.
+	// If given, it overrides the other comparisons,
+	// such as SkipIfContentEqual, SkipUnchanged, OnFileExists
+	// and the size and mtime compared by Sync.
+	// If it returns true, the file is copied, and if false, it's skipped.
+	ShouldCopy func(src, dest string, srcinfo, destinfo os.FileInfo) (bool, error)
+
+	// PreserveHardLinks makes hard links in dest among the files
+	// which are hard links to the same file in src, instead of copying
+	// the same content again, like `rsync --hard-links`.
+	// Only the hard links within src are regarded.
+	// If one can't be linked, it's copied with OnFallback called.
+	// It does nothing on Windows and Plan 9.
+	PreserveHardLinks bool
+
+	// LinkDest is a reference tree such as the previous backup, like rsync's --link-dest.
+	// If a file of the same relative path in LinkDest has the same size and mtime
+	// as the src file, the dest file is made a hard link to it instead of copied.
+	// With SkipIfContentEqual, the contents are compared if they don't.
+	// If the hard link can't be made, e.g. across devices, the file is copied.
+	LinkDest string
+
+	// OnFallback is called when copying a file by a faster method fails,
+	// and it falls back to a slower method, with the reason of the failure.
+	// It doesn't change the behavior, but lets you notice
+	// that the faster method doesn't work, e.g. on another filesystem.
+	OnFallback func(src string, from, to CopyMethod, reason error)
+
+	// OnProgress is called as each file is copied,
+	// with the bytes copied so far and the size of the file,
+	// or -1 if the size is unknown, such as by CopyStreamToFile.
+	OnProgress func(src, dest string, copied, total int64)
+
+	// ProgressInterval makes OnProgress called at most once per the interval
+	// for each file, in addition to once when the file is completely read.
+	// If 0, OnProgress is called every time a chunk is read.
+	ProgressInterval time.Duration
+
 	// Preserve the atime and the mtime of the entries.
 	// On linux we can preserve only up to 1 millisecond accuracy.
 	PreserveTimes bool
 
+	// ChecksumManifest is a path to write the checksums of the copied files,
+	// in the format of sha256sum(1) with the paths relative to dest,
+	// so that they can be checked by `sha256sum -c` in dest.
+	// Only the files written by this copy are listed, sorted by paths,
+	// and the manifest itself is excluded.
+	ChecksumManifest string
+
+	// ChecksumAlgo is the hash function for ChecksumManifest.
+	// If 0, crypto.SHA256 is used. Other functions have to be linked
+	// into the binary, such as by importing crypto/sha512.
+	ChecksumAlgo crypto.Hash
+
+	// TimestampSink is called with the times of the src entry
+	// after each file or directory is copied,
+	// so that the exact times can be recorded elsewhere,
+	// even if the dest filesystem can't store them.
+	TimestampSink func(dest string, times Timespec)
+
 	// Preserve the uid and the gid of all entries.
 	PreserveOwner bool
 
+	// UIDMap and GIDMap shift the uid and the gid preserved by PreserveOwner,
+	// such as for copying into the rootfs of a user namespace container.
+	// IDs not in any range are preserved as they are.
+	UIDMap []IDMap
+	GIDMap []IDMap
+
+	// MapOwner, if given, is called with the uid and the gid
+	// preserved by PreserveOwner, after UIDMap and GIDMap are applied,
+	// and returns those to be set instead.
+	MapOwner func(uid, gid int) (int, int)
+
+	// PreserveMode applies the full mode of src, including the setuid,
+	// setgid and sticky bits, after the owner is set,
+	// because changing the owner clears setuid and setgid on most platforms.
+	// It overrides PermissionControl, except that AddPermission is still added.
+	PreserveMode bool
+
+	// ChownTo sets the owner of all entries to the given user and group,
+	// overriding PreserveOwner. The names are resolved once before copying,
+	// and Copy fails if they can't be resolved.
+	// Numeric IDs can be given as well, such as &Owner{User: "1000", Group: "1000"}.
+	ChownTo *Owner
+
+	// PreserveXattrs preserves the extended attributes of files,
+	// directories and symlinks on Linux and macOS, such as "user.*".
+	// Because "security.selinux" is also copied unless XattrFilter
+	// excludes it, PreserveSELinux isn't needed together.
+	PreserveXattrs bool
+
+	// XattrFilter, if given, is called with the name of each extended
+	// attribute, such as "user.comment", and it's preserved only if true.
+	XattrFilter func(name string) bool
+
+	// PreserveACLs preserves the POSIX ACLs of files and directories,
+	// including the default ACLs of directories, on Linux.
+	// PreserveXattrs also copies them, unless XattrFilter excludes them.
+	PreserveACLs bool
+
+	// OnACLUnsupported is called when dest doesn't support ACLs by PreserveACLs,
+	// and copying stops if it returns an error.
+	// If nil, ACLs are just not preserved on such a filesystem.
+	OnACLUnsupported func(dest string, err error) error
+
+	// PreserveSELinux preserves the SELinux security contexts of the entries,
+	// stored in the "security.selinux" extended attribute, on Linux.
+	// It does nothing if SELinux is not available, or on other platforms.
+	PreserveSELinux bool
+
+	// Preserve the file flags of the entries, such as immutable and append-only,
+	// set by chattr(1) on Linux or chflags(1) on BSD and macOS.
+	// They are applied after everything else is done.
+	PreserveFileFlags bool
+
+	// ClearDestFlags clears immutable and append-only flags of
+	// existing dest entries, so that they can be overwritten.
+	ClearDestFlags bool
+
+	// Preserve the alternate data streams of files on NTFS,
+	// such as Zone.Identifier. Only available on Windows.
+	PreserveADS bool
+
+	// PreserveWindowsAttrs preserves the Hidden, System, ReadOnly and Archive
+	// attributes and the creation time of the entries. Only available on Windows.
+	// They are applied after the permission and the times.
+	PreserveWindowsAttrs bool
+
 	// The byte size of the buffer to use for copying files.
 	// If zero, the internal default buffer of 32KB is used.
 	// See https://golang.org/pkg/io/#CopyBuffer for more information.
 	CopyBufferSize uint
 
+	// AllowReadFromWithBuffer keeps using `ReadFrom` of the dest file,
+	// such as copy_file_range(2) or sendfile(2), even if CopyBufferSize is given,
+	// as long as the src file on the OS filesystem is read as it is,
+	// without WrapReader, LineTransform, RateLimitFunc, BandwidthLimit,
+	// FileBandwidthLimit or a cancelable context.
+	// Then the buffer is used only if the fast path isn't available,
+	// so CopyBufferSize doesn't strictly control how the file is read.
+	AllowReadFromWithBuffer bool
+
+	// CloneMode clones each file instead of copying the bytes,
+	// if src and dest are on the same copy-on-write filesystem,
+	// such as Btrfs and XFS by ioctl(FICLONE) on Linux, or APFS by clonefile(2) on macOS.
+	// Cloning is instant and takes no extra space until either file is modified.
+	// It's applied only if the src file on the OS filesystem is read as it is,
+	// as AllowReadFromWithBuffer, and not to the files written by BatchWriter.
+	CloneMode CloneMode
+
+	// ParallelChunkSize, if given with NumOfWorkers more than 1,
+	// copies each file larger than it in ranges of this size
+	// by NumOfWorkers at once, with pread(2) and pwrite(2),
+	// for fast disks or network filesystems faster with multiple streams.
+	// It's applied only if the src file on the OS filesystem is read as it is,
+	// as AllowReadFromWithBuffer.
+	ParallelChunkSize int64
+
+	// Sparse keeps the holes of sparse src files, such as VM images,
+	// by copying only the data regions found by SEEK_DATA and SEEK_HOLE,
+	// instead of writing the holes out as zeros.
+	// It's applied only if the src file on the OS filesystem is read as it is,
+	// as AllowReadFromWithBuffer, and only on Linux, macOS and FreeBSD.
+	// Otherwise, or if the filesystem doesn't support it, files are copied as usual.
+	Sparse bool
+
+	// BytesWritten, if given, is increased atomically by the number of bytes
+	// written to the destination files, even when copying concurrently.
+	BytesWritten *int64
+
+	// FilesCopied and DirsCopied, if given, are increased atomically
+	// each time a file or a directory is completely copied,
+	// so that they can drive a progress bar with BytesWritten and OnProgress.
+	FilesCopied *int64
+	DirsCopied  *int64
+
+	// BatchWriter, if given, receives small files in batches
+	// instead of creating them one by one, which is useful for
+	// archives and object stores as the destination.
+	// Files larger than BatchMaxFileSize are copied as usual.
+	BatchWriter BatchWriter
+
+	// BatchMaxFileSize is the max byte size of files written by BatchWriter.
+	// If zero, 64KB is used.
+	BatchMaxFileSize int64
+
+	// BatchLen is the number of files written by BatchWriter at once.
+	// If zero, 256 is used.
+	BatchLen int
+
 	// If you want to add some limitation on reading src file,
 	// you can wrap the src and provide new reader,
 	// such as `RateLimitReader` in the test case.
 	WrapReader func(src io.Reader) io.Reader
 
+	// LineTransform can rewrite contents of text files line by line,
+	// e.g. for substituting variables in config templates.
+	// The line is given without the trailing newline,
+	// which is appended again after the transform if it existed.
+	// Binary files are copied without the transform.
+	LineTransform func(src string, line []byte) []byte
+
+	// TextFile determines which files LineTransform is applied to.
+	// If nil, files which seem not binary are transformed.
+	TextFile func(src string) bool
+
+	// RateLimitFunc can limit bytes per second to copy files
+	// under each directory. It's called for every directory,
+	// and positive value limits the subtree of the directory,
+	// while zero inherits the limit of the parent directory.
+	RateLimitFunc func(srcdir string) int64
+
+	// BandwidthLimit limits bytes per second to copy all the files,
+	// shared by all the workers, in addition to RateLimitFunc.
+	BandwidthLimit int64
+
+	// FileBandwidthLimit limits bytes per second to copy each file,
+	// in addition to BandwidthLimit and RateLimitFunc.
+	FileBandwidthLimit int64
+
 	// If given, copy.Copy refers to this fs.FS instead of the OS filesystem.
 	// e.g., You can use embed.FS to copy files from embedded filesystem.
 	FS fs.FS
 
+	// FSSymlinkFallback tells what to do on symlinks in FS which is not ReadLinkFS,
+	// and can't tell where they point to. Deep (default) copies the content
+	// which FS resolves them to, and the others skip them.
+	FSSymlinkFallback SymlinkAction
+
+	// If given, copy.Copy writes into this WriteFS instead of the OS filesystem,
+	// e.g. an in-memory filesystem or a fake for tests.
+	// PermissionControl is not used, but the mode of src with AddPermission is applied,
+	// and named pipes are skipped. The options which need the dest on the OS filesystem,
+	// such as Mirror, PreserveOwner and VerifyAndRollback, can't be used with it.
+	DestFS WriteFS
+
 	// NumOfWorkers represents the number of workers used for
 	// concurrent copying contents of directories.
 	// If 0 or 1, it does not use goroutine for copying directories.
 	// Please refer to https://pkg.go.dev/golang.org/x/sync/semaphore for more details.
 	NumOfWorkers int64
 
+	// MaxConcurrentDirs limits the number of directories
+	// copied concurrently, separately from NumOfWorkers for files.
+	// If a directory cannot get the slot, it is copied in the goroutine
+	// of its parent directory instead of a new goroutine.
+	// If 0, NumOfWorkers is used.
+	// If NumOfWorkers is 0 or 1, this option will be ignored.
+	MaxConcurrentDirs int64
+
+	// CoalesceDirMetadata applies the permissions, times, owners and
+	// the other metadata of directories all at once after everything is copied,
+	// from the deepest, instead of each time a directory is copied,
+	// so that they are not interleaved with writes on a high-latency filesystem.
+	// Extraneous entries are also deleted by Mirror at the end.
+	// If copying fails, the permissions are still applied at the end,
+	// but the other metadata are not, as when a directory fails to be copied.
+	// If any of them fails, the first error is returned after all tried.
+	// In BreadthFirst traversal, directories are always finished at the end.
+	CoalesceDirMetadata bool
+
+	// IOConcurrency limits the number of files whose content is
+	// written concurrently, such as to the queue depth of the disk,
+	// while opening, creating and the other operations are still done
+	// concurrently by NumOfWorkers.
+	// If 0, it's not limited.
+	IOConcurrency int64
+
+	// Traversal specifies the order to copy directories.
+	// By default, it's DepthFirst.
+	Traversal TraversalMode
+
+	// PrefetchDepth is the number of entries to open ahead of copying
+	// in a directory, which warms up the cache of a high-latency FS.
+	// Only one background goroutine per directory does it,
+	// which is distinct from copying concurrently by NumOfWorkers.
+	// If 0, it doesn't prefetch.
+	PrefetchDepth int
+
+	// TimeBudget stops copying gracefully when the time is over,
+	// with ErrTimeBudgetExceeded returned.
+	// Unlike canceling, files being copied at the time are completed,
+	// and only new entries are not started.
+	// If 0, it's not limited.
+	TimeBudget time.Duration
+
 	// PreferConcurrent is a function to determine whether or not
 	// to use goroutine for copying contents of directories.
 	// If PreferConcurrent is nil, which is default, it does concurrent
@@ -81,6 +638,34 @@ type Options struct {
 	// If NumOfWorkers is 0 or 1, this function will be ignored.
 	PreferConcurrent func(srcdir, destdir string) (bool, error)
 
+	// TrailingSlashSemantics makes src regarded as rsync(1) does,
+	// so that src without a trailing slash is copied into `dest/(base of src)`,
+	// and only src with a trailing slash is copied into dest itself.
+	// It conflicts with StripPrefix.
+	TrailingSlashSemantics bool
+
+	// StripPrefix is removed from src to compute where to copy,
+	// so that src is copied to `dest/(src without StripPrefix)`.
+	// e.g., Copy("/data/a/b", "out", Options{StripPrefix: "/data"}) copies to "out/a/b".
+	// Copy fails if src is not under StripPrefix.
+	StripPrefix string
+
+	// ForwardSlashPaths makes destination paths use forward slashes,
+	// which are passed to the callbacks such as Skip.
+	ForwardSlashPaths bool
+
+	// NormalizeUnicode normalizes names of the entries in dest
+	// to the given form, such as NFC on Linux and NFD on macOS.
+	// If nil, names are not normalized.
+	NormalizeUnicode *norm.Form
+
+	// DestPrefix and DestSuffix are added to the names of regular files
+	// in dest, such as "staged_file.txt" and "file.txt.staged".
+	// DestSuffix goes after the extension.
+	// Names of directories and the root dest are not changed.
+	DestPrefix string
+	DestSuffix string
+
 	// Internal use only
 	intent intent
 }
@@ -90,6 +675,100 @@ type intent struct {
 	dest string
 	sem  *semaphore.Weighted
 	ctx  context.Context
+
+	// dirsem limits the number of directories copied concurrently.
+	dirsem *semaphore.Weighted
+
+	// iosem limits the number of files written concurrently.
+	iosem *semaphore.Weighted
+
+	// dirs holds a mutex for each destination directory,
+	// to serialize creation of the same directory among goroutines.
+	dirs *sync.Map
+
+	// limiter limits bytes per second of the current subtree.
+	limiter *limiter
+
+	// buffers is the pool of buffers of CopyBufferSize.
+	buffers *sync.Pool
+
+	// bandwidth limits bytes per second of the whole copy by BandwidthLimit.
+	bandwidth *limiter
+
+	// subst is given only when called by Estimate, Plan, CopyToTar or CopyToZip,
+	// so that nothing should be written to the destination.
+	subst substitute
+
+	// claimed holds the dest of each file copied by CopyAll,
+	// to detect the collision of sources.
+	claimed *sync.Map
+
+	// resolving is the dest of the symlink being copied as what it points to,
+	// which is claimed by the symlink itself.
+	resolving string
+
+	// report is given only when called by CopyWithReport, to record what's done.
+	report *reporter
+
+	// sync is given only when called by Sync, to record what's done.
+	sync *syncState
+
+	// batch holds files to be written by BatchWriter.
+	batch *batch
+
+	// collapsed holds dest files copied from the final targets
+	// of symlink chains, by CollapseSymlinkChains.
+	collapsed *sync.Map
+
+	// checksums holds the checksums of the files for ChecksumManifest.
+	checksums *checksums
+
+	// owner is the resolved IDs of ChownTo.
+	owner *ids
+
+	// inodes holds the first dest file copied from each inode
+	// which has multiple hard links, by PreserveHardLinks.
+	inodes *sync.Map
+
+	// expired is set to 1 when TimeBudget is over.
+	expired *int32
+
+	// resumeAt is the offset of the src file to continue copying from,
+	// given only by Resume for the partial file.
+	resumeAt int64
+
+	// collected holds the errors by ErrorPolicy: ContinueAndCollect.
+	collected *collector
+
+	// ignores holds the rules of the ignore files applied to the current subtree.
+	ignores ignoreRules
+
+	// coalesced is given only by CoalesceDirMetadata,
+	// to hold directories to be finished at the end.
+	coalesced *coalesced
+
+	// bfs is given only when copying breadth-first,
+	// to hold directories to be copied later.
+	bfs *breadthFirst
+
+	// fsyncs holds files written in the current directory,
+	// to be synced at once by SyncBatched.
+	fsyncs *fsyncs
+
+	// followed holds directories which symlinks are
+	// followed to so far on the current branch of the tree.
+	followed []followedDir
+
+	// hops is the number of symlinks followed in a row by Deep.
+	hops int
+}
+
+// followedDir is a directory which a symlink is followed to.
+type followedDir struct {
+	// path is the real path, or the path in Options.FS.
+	path string
+	// info is to identify the directory by the device and inode, if any.
+	info os.FileInfo
 }
 
 // SymlinkAction represents what to do on symlink.
@@ -104,6 +783,88 @@ const (
 	Skip
 )
 
+// SocketAction represents what to do on unix domain socket.
+type SocketAction int
+
+const (
+	// SkipSocket does nothing with socket (default behavior).
+	SkipSocket SocketAction = iota
+	// ErrorSocket fails with ErrSocket.
+	ErrorSocket
+	// RecreateSocket creates a socket file in dest as a placeholder,
+	// which nothing listens to, with the metadata applied as regular files.
+	RecreateSocket
+)
+
+// DeviceAction represents what to do when a device file can't be created.
+type DeviceAction int
+
+const (
+	// ErrorDevice fails with the error (default behavior).
+	ErrorDevice DeviceAction = iota
+	// SkipDevice does nothing with the device file.
+	SkipDevice
+)
+
+// CopyMethod represents how to copy a file.
+type CopyMethod int
+
+const (
+	// ByteCopy reads the src file and writes the dest file.
+	ByteCopy CopyMethod = iota
+	// HardLink makes the dest file a hard link, used by LinkDest,
+	// PreserveHardLinks and CollapseSymlinkChains.
+	HardLink
+	// Clone makes the dest file share the data of the src file
+	// on a copy-on-write filesystem, used by CloneMode.
+	Clone
+)
+
+// CloneMode represents whether to clone files instead of copying the bytes.
+type CloneMode int
+
+const (
+	// CloneNever always copies the bytes (default behavior).
+	CloneNever CloneMode = iota
+	// CloneAuto clones files if possible,
+	// and otherwise copies the bytes with OnFallback called.
+	CloneAuto
+	// CloneAlways clones files, and fails if it's not possible.
+	CloneAlways
+)
+
+// SyncMode represents how to sync copied files.
+type SyncMode int
+
+const (
+	// SyncNone doesn't sync anything (default behavior),
+	// then files can be lost or partial on crash.
+	SyncNone SyncMode = iota
+	// SyncPerFile syncs each file as soon as it's written,
+	// then every file copied before crash has its content on the disk,
+	// though its directory entry may not.
+	SyncPerFile
+	// SyncBatched syncs the files in a directory at once
+	// after all of them are written, and then the directory itself,
+	// then every directory finished before crash has both its files
+	// and their entries on the disk, while the files in a directory
+	// being copied can be lost or partial on crash.
+	// The root file, if src is a file, is synced as SyncPerFile.
+	SyncBatched
+)
+
+// SymlinkRewrite represents how to rewrite the targets of symlinks pointing inside src.
+type SymlinkRewrite int
+
+const (
+	// KeepSymlinkTargets keeps the targets as they are (default behavior).
+	KeepSymlinkTargets SymlinkRewrite = iota
+	// RewriteToDest makes them the absolute paths under dest.
+	RewriteToDest
+	// RewriteToRelative makes them the relative paths from the symlinks in dest.
+	RewriteToRelative
+)
+
 // DirExistsAction represents what to do on dest dir.
 type DirExistsAction int
 
@@ -116,6 +877,117 @@ const (
 	Untouchable
 )
 
+// MarkerSide represents where to look for SkipDirMarker.
+type MarkerSide int
+
+const (
+	// MarkerInSrc looks for the marker in src directories (default behavior).
+	MarkerInSrc MarkerSide = iota
+	// MarkerInDest looks for the marker in dest directories.
+	MarkerInDest
+)
+
+// EmptyFileAction represents what to do on empty file.
+type EmptyFileAction int
+
+const (
+	// CopyEmpty copies the empty file as usual (default behavior).
+	CopyEmpty EmptyFileAction = iota
+	// SkipEmpty does nothing with the empty file.
+	SkipEmpty
+	// ErrorEmpty fails with ErrEmptyFile.
+	ErrorEmpty
+)
+
+// FileExistsAction represents what to do on existing dest file.
+type FileExistsAction int
+
+const (
+	// Overwrite truncates and overwrites the existing file (default behavior).
+	Overwrite FileExistsAction = iota
+	// SkipExisting does nothing with the file, and leaves it as it is.
+	SkipExisting
+	// ErrorExisting fails with os.ErrExist.
+	ErrorExisting
+	// RenameWithSuffix copies the file with a new name, as DedupeDestNames does.
+	RenameWithSuffix
+	// OverwriteIfNewer overwrites the existing file only if src is modified later than it.
+	OverwriteIfNewer
+)
+
+// BackupMode represents how to name the backup of existing dest file.
+type BackupMode int
+
+const (
+	// NoBackup saves nothing, unless BackupDir is given (default behavior).
+	NoBackup BackupMode = iota
+	// SimpleBackup saves it with BackupSuffix, overwriting the previous backup.
+	SimpleBackup
+	// NumberedBackup saves it with a new number, such as "file.txt.~1~",
+	// like "cp --backup=numbered" of GNU coreutils.
+	NumberedBackup
+)
+
+// TraversalMode represents the order to copy directories.
+type TraversalMode int
+
+const (
+	// DepthFirst copies each subdirectory recursively
+	// as soon as it's found (default behavior).
+	DepthFirst TraversalMode = iota
+	// BreadthFirst copies the entries of a level
+	// before going down to the entries of the next level.
+	// Directories in the same level are copied one by one,
+	// while their files can still be copied concurrently by NumOfWorkers.
+	// Directories are finished with their permissions, times and Mirror
+	// only after all the levels are copied, from the deepest one,
+	// so that their subdirectories can be created in them.
+	BreadthFirst
+)
+
+// ErrorAction represents what to do on copy error.
+type ErrorAction int
+
+const (
+	// Abort returns the error and stops copying (default behavior).
+	Abort ErrorAction = iota
+	// Ignore suppresses the error and goes on to the next entry.
+	Ignore
+	// Retry copies the file again.
+	Retry
+)
+
+// RetryPolicy represents how to retry copying a file on error.
+type RetryPolicy struct {
+	// Attempts is the max number of retries, 0 by default not to retry.
+	Attempts int
+	// Backoff is the time to wait before the first retry,
+	// which is doubled on each retry. If zero, it's retried immediately.
+	Backoff time.Duration
+	// RetryIf reports whether to retry on the error.
+	// If nil, any error but cancellation and TimeBudget is retried.
+	RetryIf func(err error) bool
+}
+
+// ErrorPolicy represents what to do on the errors of entries.
+type ErrorPolicy int
+
+const (
+	// FailFast returns the first error and stops copying (default behavior).
+	FailFast ErrorPolicy = iota
+	// ContinueAndCollect goes on to the next entry on error,
+	// and returns all the errors as *CollectedErrors at the end.
+	// Copying still stops on cancellation and TimeBudget.
+	ContinueAndCollect
+)
+
+// maxRetriesOnError is how many times a file can be retried by OnErrorAction.
+const maxRetriesOnError = 3
+
+// maxSymlinkHops is how many symlinks can be followed in a row
+// before giving up with ErrSymlinkLoop.
+const maxSymlinkHops = 40
+
 // getDefaultOptions provides default options,
 // which would be modified by usage-side.
 func getDefaultOptions(src, dest string) Options {
@@ -133,7 +1005,8 @@ func getDefaultOptions(src, dest string) Options {
 		PreserveTimes:     false,              // Do not preserve the modification time
 		CopyBufferSize:    0,                  // Do not specify, use default bufsize (32*1024)
 		WrapReader:        nil,                // Do not wrap src files, use them as they are.
-		intent:            intent{src, dest, nil, nil},
+		DedupeFormat:      dedupeFormat,       // e.g. "file (1).txt"
+		intent:            intent{src: src, dest: dest, ctx: context.Background()},
 	}
 }
 
@@ -150,6 +1023,30 @@ func assureOptions(src, dest string, opts ...Options) Options {
 	if opts[0].Skip == nil {
 		opts[0].Skip = defopt.Skip
 	}
+	if opts[0].BatchMaxFileSize == 0 {
+		opts[0].BatchMaxFileSize = defaultBatchMaxFileSize
+	}
+	if opts[0].BatchLen == 0 {
+		opts[0].BatchLen = defaultBatchLen
+	}
+	if opts[0].Sync && opts[0].SyncMode == SyncNone {
+		opts[0].SyncMode = SyncPerFile
+	}
+	if opts[0].CompareByHash {
+		opts[0].SkipIfContentEqual = true
+		if opts[0].Hasher == nil {
+			opts[0].Hasher = sha256.New
+		}
+	}
+	if opts[0].Backup == SimpleBackup && opts[0].BackupSuffix == "" {
+		opts[0].BackupSuffix = ".bak"
+	}
+	if opts[0].Resume && opts[0].ResumeSuffix == "" {
+		opts[0].ResumeSuffix = ".part"
+	}
+	if opts[0].DedupeFormat == nil {
+		opts[0].DedupeFormat = defopt.DedupeFormat
+	}
 	if opts[0].AddPermission > 0 {
 		opts[0].PermissionControl = AddPermission(opts[0].AddPermission)
 	} else if opts[0].PermissionControl == nil {
@@ -157,9 +1054,16 @@ func assureOptions(src, dest string, opts ...Options) Options {
 	}
 	opts[0].intent.src = defopt.intent.src
 	opts[0].intent.dest = defopt.intent.dest
+	if opts[0].intent.ctx == nil {
+		opts[0].intent.ctx = defopt.intent.ctx
+	}
 	return opts[0]
 }
 
+func dedupeFormat(base string, n int) string {
+	return fmt.Sprintf("%s (%d)", base, n)
+}
+
 func shouldCopyDirectoryConcurrent(opt Options, srcdir, destdir string) (bool, error) {
 	if opt.NumOfWorkers <= 1 {
 		return false, nil
@@ -169,3 +1073,119 @@ func shouldCopyDirectoryConcurrent(opt Options, srcdir, destdir string) (bool, e
 	}
 	return opt.PreferConcurrent(srcdir, destdir)
 }
+
+// checkConflicts returns ErrConflictingOptions
+// if the options which can't be used together are given.
+func checkConflicts(opt Options) error {
+	if opt.TrailingSlashSemantics && opt.StripPrefix != "" {
+		return fmt.Errorf("%w: TrailingSlashSemantics and StripPrefix", ErrConflictingOptions)
+	}
+	if opt.Verify && opt.LineTransform != nil {
+		return fmt.Errorf("%w: Verify and LineTransform", ErrConflictingOptions)
+	}
+	if opt.PreCreateDest && (opt.Atomic || opt.VerifyAndRollback) {
+		// The dest file created first would be visible before renamed.
+		return fmt.Errorf("%w: PreCreateDest and Atomic or VerifyAndRollback", ErrConflictingOptions)
+	}
+	if opt.Mirror && opt.Backup != NoBackup && opt.BackupDir == "" {
+		// Backups next to dest files would be deleted as extraneous.
+		return fmt.Errorf("%w: Mirror and Backup without BackupDir", ErrConflictingOptions)
+	}
+	if opt.DestFS != nil {
+		for _, c := range []struct {
+			name  string
+			given bool
+		}{
+			{"PreserveOwner", opt.PreserveOwner},
+			{"PreserveMode", opt.PreserveMode},
+			{"ChownTo", opt.ChownTo != nil},
+			{"PreserveXattrs", opt.PreserveXattrs},
+			{"PreserveACLs", opt.PreserveACLs},
+			{"PreserveSELinux", opt.PreserveSELinux},
+			{"PreserveFileFlags", opt.PreserveFileFlags},
+			{"ClearDestFlags", opt.ClearDestFlags},
+			{"PreserveADS", opt.PreserveADS},
+			{"PreserveWindowsAttrs", opt.PreserveWindowsAttrs},
+			{"PreserveHardLinks", opt.PreserveHardLinks},
+			{"LinkDest", opt.LinkDest != ""},
+			{"CollapseSymlinkChains", opt.CollapseSymlinkChains},
+			{"SymlinkFiles", opt.SymlinkFiles},
+			{"CloneMode", opt.CloneMode != CloneNever},
+			{"Sparse", opt.Sparse},
+			{"ParallelChunkSize", opt.ParallelChunkSize > 0},
+			{"Atomic", opt.Atomic},
+			{"VerifyAndRollback", opt.VerifyAndRollback},
+			{"Verify", opt.Verify},
+			{"Resume", opt.Resume},
+			{"AppendMode", opt.AppendMode},
+			{"DedupeDestNames", opt.DedupeDestNames},
+			{"OnFileExists", opt.OnFileExists != nil},
+			{"PreCreateDest", opt.PreCreateDest},
+			{"BatchWriter", opt.BatchWriter != nil},
+			{"BackupDir", opt.BackupDir != ""},
+			{"Backup", opt.Backup != NoBackup},
+			{"ChecksumManifest", opt.ChecksumManifest != ""},
+			{"SkipIfContentEqual", opt.SkipIfContentEqual},
+			{"SkipUnchanged", opt.SkipUnchanged},
+			{"ShouldCopy", opt.ShouldCopy != nil},
+			{"AlwaysApplyPermissions", opt.AlwaysApplyPermissions},
+			{"Mirror", opt.Mirror},
+			{"OnDirExists", opt.OnDirExists != nil},
+			{"RequireDestRootParent", opt.RequireDestRootParent},
+			{"Specials", opt.Specials},
+			{"SyncBatched", opt.SyncMode == SyncBatched},
+			{"MarkerInDest", opt.SkipDirMarker != "" && opt.MarkerSide == MarkerInDest},
+		} {
+			if c.given {
+				return fmt.Errorf("%w: DestFS and %s", ErrConflictingOptions, c.name)
+			}
+		}
+	}
+	if opt.ErrorPolicy == ContinueAndCollect {
+		if opt.OnError != nil {
+			return fmt.Errorf("%w: ContinueAndCollect and OnError", ErrConflictingOptions)
+		}
+		if opt.OnErrorAction != nil {
+			return fmt.Errorf("%w: ContinueAndCollect and OnErrorAction", ErrConflictingOptions)
+		}
+	}
+	if opt.Resume {
+		for _, c := range []struct {
+			name  string
+			given bool
+		}{
+			{"VerifyAndRollback", opt.VerifyAndRollback},
+			{"Atomic", opt.Atomic},
+			{"LineTransform", opt.LineTransform != nil},
+			{"DedupeDestNames", opt.DedupeDestNames},
+			{"AppendMode", opt.AppendMode},
+		} {
+			if c.given {
+				return fmt.Errorf("%w: Resume and %s", ErrConflictingOptions, c.name)
+			}
+		}
+	}
+	if opt.AppendMode {
+		for _, c := range []struct {
+			name  string
+			given bool
+		}{
+			{"VerifyAndRollback", opt.VerifyAndRollback},
+			{"Atomic", opt.Atomic},
+			{"Verify", opt.Verify},
+			{"PreCreateDest", opt.PreCreateDest},
+			{"DedupeDestNames", opt.DedupeDestNames},
+			{"LinkDest", opt.LinkDest != ""},
+			{"PreserveHardLinks", opt.PreserveHardLinks},
+			{"SymlinkFiles", opt.SymlinkFiles},
+			{"Sparse", opt.Sparse},
+			{"ParallelChunkSize", opt.ParallelChunkSize > 0},
+			{"CloneMode", opt.CloneMode != CloneNever},
+		} {
+			if c.given {
+				return fmt.Errorf("%w: AppendMode and %s", ErrConflictingOptions, c.name)
+			}
+		}
+	}
+	return nil
+}
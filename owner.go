@@ -0,0 +1,100 @@
+package copy
+
+import (
+	"os/user"
+	"strconv"
+)
+
+// Owner specifies the owner of the copied entries, by names or IDs.
+type Owner struct {
+	// User is a username or a numeric uid.
+	// If empty, the user is not changed.
+	User string
+	// Group is a groupname or a numeric gid.
+	// If empty, the group is not changed.
+	Group string
+}
+
+// IDMap maps the range of IDs from From to From+Size-1
+// onto the range from To, as /proc/[pid]/uid_map does.
+type IDMap struct {
+	From int
+	To   int
+	Size int
+}
+
+// ids holds the resolved uid and gid of Owner, -1 for unchanged.
+type ids struct {
+	uid int
+	gid int
+}
+
+// resolve looks up the uid and gid of the owner.
+// Names are looked up first, and then taken as numeric IDs, as chown(1) does.
+func (o *Owner) resolve() (resolved *ids, err error) {
+	resolved = &ids{uid: -1, gid: -1}
+	if o.User != "" {
+		if resolved.uid, err = lookup(o.User, func(name string) (string, error) {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return "", err
+			}
+			return u.Uid, nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if o.Group != "" {
+		if resolved.gid, err = lookup(o.Group, func(name string) (string, error) {
+			g, err := user.LookupGroup(name)
+			if err != nil {
+				return "", err
+			}
+			return g.Gid, nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return resolved, nil
+}
+
+// lookup returns the ID of the name, or the name itself if it's numeric.
+func lookup(name string, byName func(string) (string, error)) (int, error) {
+	id, err := byName(name)
+	if err != nil {
+		if n, numeric := strconv.Atoi(name); numeric == nil {
+			return n, nil
+		}
+		return -1, err
+	}
+	return strconv.Atoi(id)
+}
+
+// applyOwner sets the owner of dest, by Options.ChownTo
+// in preference to Options.PreserveOwner.
+func applyOwner(src, dest string, info fileInfo, opt Options) error {
+	if opt.ChownTo != nil {
+		return chown(dest, opt.intent.owner.uid, opt.intent.owner.gid)
+	}
+	return preserveOwner(src, dest, info, opt)
+}
+
+// mapOwner maps the uid and the gid of src to those of dest
+// by Options.UIDMap, Options.GIDMap and Options.MapOwner.
+func mapOwner(uid, gid int, opt Options) (int, int) {
+	uid, gid = mapID(uid, opt.UIDMap), mapID(gid, opt.GIDMap)
+	if opt.MapOwner != nil {
+		return opt.MapOwner(uid, gid)
+	}
+	return uid, gid
+}
+
+// mapID maps the id by the first range including it.
+func mapID(id int, ranges []IDMap) int {
+	for _, r := range ranges {
+		if id >= r.From && id < r.From+r.Size {
+			return r.To + id - r.From
+		}
+	}
+	return id
+}
@@ -46,3 +46,32 @@ func chmod(dir string, mode os.FileMode, reported *error) {
 		*reported = err
 	}
 }
+
+// preserveMode applies the mode of src to dest with the special bits,
+// which must be done after chown, since chown clears setuid and setgid.
+func preserveMode(info fileInfo, dest string, opt Options) error {
+	mode := info.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+	return os.Chmod(dest, mode|opt.AddPermission)
+}
+
+// dirMode is the mode with which dest directory is created.
+func dirMode(info os.FileInfo, opt Options) os.FileMode {
+	if opt.CreateWithSourceMode {
+		return info.Mode().Perm() | opt.AddPermission | 0700
+	}
+	if opt.DefaultDirMode != 0 {
+		return opt.DefaultDirMode
+	}
+	return tmpPermissionForDirectory
+}
+
+// fileMode is the mode with which dest file is created.
+func fileMode(info os.FileInfo, opt Options) os.FileMode {
+	if opt.CreateWithSourceMode {
+		return info.Mode().Perm() | opt.AddPermission
+	}
+	if opt.DefaultFileMode != 0 {
+		return opt.DefaultFileMode
+	}
+	return 0666
+}
@@ -0,0 +1,185 @@
+package copy
+
+import (
+	"os"
+	"sync"
+)
+
+// PlanKind represents the kind of an operation planned by Plan.
+type PlanKind int
+
+const (
+	// PlanCreate creates a new file in dest.
+	PlanCreate PlanKind = iota
+	// PlanOverwrite overwrites the existing file in dest.
+	PlanOverwrite
+	// PlanSkip does nothing with the entry.
+	PlanSkip
+	// PlanDelete deletes the entry in dest.
+	PlanDelete
+	// PlanMkdir creates a new directory in dest.
+	PlanMkdir
+	// PlanSymlink creates a symlink in dest.
+	PlanSymlink
+	// PlanBackup saves the existing file in dest into Options.BackupDir.
+	PlanBackup
+)
+
+// String returns the name of the kind, such as "create".
+func (k PlanKind) String() string {
+	switch k {
+	case PlanCreate:
+		return "create"
+	case PlanOverwrite:
+		return "overwrite"
+	case PlanSkip:
+		return "skip"
+	case PlanDelete:
+		return "delete"
+	case PlanMkdir:
+		return "mkdir"
+	case PlanSymlink:
+		return "symlink"
+	case PlanBackup:
+		return "backup"
+	}
+	return "unknown"
+}
+
+// PlannedOp is an operation which Copy would do.
+type PlannedOp struct {
+	Kind PlanKind
+	Src  string
+	Dest string
+	// Bytes is the size of the file to be written.
+	Bytes int64
+	// Reason tells why it's skipped, or how it's done, if any.
+	Reason string
+}
+
+// plan holds operations planned so far.
+type plan struct {
+	mu  sync.Mutex
+	ops []PlannedOp
+
+	// replaced holds dest directories planned to be replaced,
+	// so that nothing under them should be regarded as existing.
+	replaced []string
+}
+
+func (p *plan) add(op PlannedOp) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ops = append(p.ops, op)
+	if op.Kind == PlanDelete {
+		p.replaced = append(p.replaced, op.Dest)
+	}
+}
+
+// stat returns the FileInfo of dest as it would be at this point of the plan.
+func (p *plan) stat(dest string, follow bool) (os.FileInfo, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, dir := range p.replaced {
+		if within(dest, dir) {
+			return nil, &os.PathError{Op: "lstat", Path: dest, Err: os.ErrNotExist}
+		}
+	}
+	if follow {
+		return os.Stat(dest)
+	}
+	return os.Lstat(dest)
+}
+
+// Plan walks src and reports what Copy would do in order,
+// without touching any destination.
+// The same options as Copy are respected, such as Skip, OnDirExists and Mirror,
+// so that the plan matches what a real copy would do.
+// Directories are walked one by one in depth-first order,
+// so that the plan is always in the same order.
+func Plan(src, dest string, opts ...Options) ([]PlannedOp, error) {
+	p := &plan{}
+	opt := assureOptions(src, dest, opts...)
+	if err := checkConflicts(opt); err != nil {
+		return nil, err
+	}
+	dest, err := destroot(src, dest, opt)
+	if err != nil {
+		return nil, onError(src, dest, err, opt)
+	}
+	opt.intent.dest = dest
+	if opt, err = substituted(opt, p); err != nil {
+		return nil, err
+	}
+	info, err := lstat(src, opt)
+	if err != nil {
+		return nil, onError(src, dest, err, opt)
+	}
+	if err := requireParent(dest, opt); err != nil {
+		return nil, onError(src, dest, err, opt)
+	}
+	err = switchboard(src, dest, info, opt)
+	return p.ops, err
+}
+
+// dir plans to make destdir unless it exists.
+func (p *plan) dir(srcdir, destdir string, info os.FileInfo, opt Options) error {
+	if _, err := p.stat(destdir, false); os.IsNotExist(err) {
+		p.add(PlannedOp{Kind: PlanMkdir, Src: srcdir, Dest: destdir})
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// file plans to create or overwrite dest, with backing it up if needed.
+func (p *plan) file(src, dest string, info os.FileInfo, opt Options) error {
+	op := PlannedOp{Kind: PlanCreate, Src: src, Dest: dest, Bytes: info.Size()}
+	destinfo, err := p.stat(dest, false)
+	switch {
+	case err != nil && !os.IsNotExist(err):
+		return err
+	case err != nil:
+		// Doesn't exist, then to be created.
+	case opt.AppendMode:
+		op.Kind, op.Reason = PlanOverwrite, "append"
+	case opt.DedupeDestNames:
+		op.Reason = "renamed not to overwrite"
+	default:
+		op.Kind = PlanOverwrite
+	}
+	if opt.LinkDest != "" {
+		if ref, same, err := linkable(src, info, opt); err != nil {
+			return err
+		} else if same {
+			op.Bytes, op.Reason = 0, "hard link to "+ref
+		}
+	}
+	if op.Kind == PlanOverwrite && backingUp(opt) && destinfo.Mode().IsRegular() {
+		p.add(PlannedOp{Kind: PlanBackup, Src: dest, Dest: backuppath(dest, opt), Bytes: destinfo.Size()})
+	}
+	p.add(op)
+	return nil
+}
+
+// symlink plans to make a symlink at dest.
+func (p *plan) symlink(src, dest string, opt Options) error {
+	p.add(PlannedOp{Kind: PlanSymlink, Src: src, Dest: dest})
+	return nil
+}
+
+// special plans to make a named pipe, device or socket at dest.
+func (p *plan) special(src, dest string, info os.FileInfo, kind string, opt Options) error {
+	p.add(PlannedOp{Kind: PlanCreate, Src: src, Dest: dest, Reason: kind})
+	return nil
+}
+
+// remove plans to delete dest.
+func (p *plan) remove(src, dest, reason string) {
+	p.add(PlannedOp{Kind: PlanDelete, Src: src, Dest: dest, Reason: reason})
+}
+
+// skip plans to do nothing with src.
+func (p *plan) skip(src, dest, reason string) {
+	p.add(PlannedOp{Kind: PlanSkip, Src: src, Dest: dest, Reason: reason})
+}
@@ -0,0 +1,58 @@
+package copy
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// prefetcher opens the entries of a directory ahead of copying them,
+// so that a remote filesystem can warm its cache in the meantime.
+type prefetcher struct {
+	queue chan os.FileInfo
+	done  chan struct{}
+	exit  chan struct{}
+}
+
+// prefetch starts warming up contents of srcdir in background,
+// and feeds the warmed entries into the queue in the same order.
+// It goes at most opt.PrefetchDepth entries ahead of the consumer.
+func prefetch(srcdir string, contents []os.FileInfo, opt Options) *prefetcher {
+	p := &prefetcher{
+		// One more entry is held by the goroutine waiting to send it.
+		queue: make(chan os.FileInfo, opt.PrefetchDepth-1),
+		done:  make(chan struct{}),
+		exit:  make(chan struct{}),
+	}
+	go func() {
+		defer close(p.exit)
+		defer close(p.queue)
+		for _, content := range contents {
+			warm(filepath.Join(srcdir, content.Name()), content, opt)
+			select {
+			case p.queue <- content:
+			case <-p.done:
+				return
+			}
+		}
+	}()
+	return p
+}
+
+// stop stops the prefetcher and waits for it to exit.
+func (p *prefetcher) stop() {
+	close(p.done)
+	<-p.exit
+}
+
+// warm opens and closes src file, or stats src directory.
+// Errors are ignored here, because they are reported on copying anyway.
+func warm(src string, info os.FileInfo, opt Options) {
+	switch {
+	case info.Mode().IsRegular():
+		if f, err := open(src, opt); err == nil {
+			f.Close()
+		}
+	case info.IsDir():
+		lstat(src, opt)
+	}
+}
@@ -0,0 +1,43 @@
+//go:build linux
+// +build linux
+
+package copy
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// Extended attributes which hold POSIX ACLs on Linux, see acl(5).
+const (
+	aclAccessXattr  = "system.posix_acl_access"
+	aclDefaultXattr = "system.posix_acl_default"
+)
+
+// preserveACLs copies the access ACL of src to dest,
+// and the default ACL as well if src is a directory.
+// If dest doesn't support ACLs, Options.OnACLUnsupported decides what to do.
+func preserveACLs(src, dest string, isdir bool, opt Options) error {
+	names := []string{aclAccessXattr}
+	if isdir {
+		names = append(names, aclDefaultXattr)
+	}
+	for _, name := range names {
+		acl, err := getXattr(src, name)
+		if err != nil {
+			if err == errNoXattr || err == unix.ENOTSUP {
+				continue // No ACL other than the mode
+			}
+			return err
+		}
+		if err := unix.Lsetxattr(dest, name, acl, 0); err != nil {
+			if err != unix.ENOTSUP {
+				return err
+			}
+			if opt.OnACLUnsupported != nil {
+				return opt.OnACLUnsupported(dest, err)
+			}
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+//go:build linux
+// +build linux
+
+package copy
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	. "github.com/otiai10/mint"
+	"golang.org/x/sys/unix"
+)
+
+// acl encodes ACL entries of (tag, perm, id) in the format of the xattr.
+func acl(entries ...[3]uint32) []byte {
+	b := make([]byte, 4+8*len(entries))
+	binary.LittleEndian.PutUint32(b, 2) // version
+	for i, e := range entries {
+		binary.LittleEndian.PutUint16(b[4+8*i:], uint16(e[0]))
+		binary.LittleEndian.PutUint16(b[6+8*i:], uint16(e[1]))
+		binary.LittleEndian.PutUint32(b[8+8*i:], e[2])
+	}
+	return b
+}
+
+func TestOptions_PreserveACLs(t *testing.T) {
+	const undefined = 0xffffffff
+	access := acl(
+		[3]uint32{0x01, 6, undefined}, // user::rw-
+		[3]uint32{0x02, 4, 12345},     // user:12345:r--
+		[3]uint32{0x04, 4, undefined}, // group::r--
+		[3]uint32{0x10, 4, undefined}, // mask::r--
+		[3]uint32{0x20, 0, undefined}, // other::---
+	)
+	src := t.TempDir()
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "file"), []byte("file"), 0o640)).ToBe(nil)
+	if err := unix.Setxattr(filepath.Join(src, "file"), aclAccessXattr, access, 0); err != nil {
+		t.Skipf("the filesystem doesn't support ACLs: %v", err)
+	}
+	Expect(t, unix.Setxattr(src, aclDefaultXattr, access, 0)).ToBe(nil)
+
+	dest := filepath.Join(t.TempDir(), "dest")
+	err := Copy(src, dest, Options{PreserveACLs: true})
+	Expect(t, err).ToBe(nil)
+	b, err := getXattr(filepath.Join(dest, "file"), aclAccessXattr)
+	Expect(t, err).ToBe(nil)
+	Expect(t, b).ToBe(access)
+	b, err = getXattr(dest, aclDefaultXattr)
+	Expect(t, err).ToBe(nil)
+	Expect(t, b).ToBe(access)
+
+	plain := filepath.Join(t.TempDir(), "plain")
+	err = Copy(src, plain)
+	Expect(t, err).ToBe(nil)
+	_, err = getXattr(filepath.Join(plain, "file"), aclAccessXattr)
+	Expect(t, err).ToBe(errNoXattr)
+}
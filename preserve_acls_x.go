@@ -0,0 +1,8 @@
+//go:build !linux
+// +build !linux
+
+package copy
+
+func preserveACLs(src, dest string, isdir bool, opt Options) error {
+	return nil // Unsupported
+}
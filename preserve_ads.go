@@ -0,0 +1,87 @@
+//go:build windows
+// +build windows
+
+package copy
+
+import (
+	"io"
+	"os"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	modkernel32          = windows.NewLazySystemDLL("kernel32.dll")
+	procFindFirstStreamW = modkernel32.NewProc("FindFirstStreamW")
+	procFindNextStreamW  = modkernel32.NewProc("FindNextStreamW")
+)
+
+// win32FindStreamData is WIN32_FIND_STREAM_DATA.
+type win32FindStreamData struct {
+	StreamSize int64
+	StreamName [windows.MAX_PATH + 36]uint16
+}
+
+// preserveADS copies alternate data streams of src to dest,
+// such as ":Zone.Identifier" for "mark of the web".
+func preserveADS(src, dest string) error {
+	names, err := streams(src)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := scopy(src+name, dest+name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// streams lists the names of alternate data streams of the file,
+// e.g. ":Zone.Identifier", excluding the default data stream.
+func streams(path string) ([]string, error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	var data win32FindStreamData
+	h, _, e := procFindFirstStreamW.Call(uintptr(unsafe.Pointer(p)), 0, uintptr(unsafe.Pointer(&data)), 0)
+	if windows.Handle(h) == windows.InvalidHandle {
+		if e == windows.ERROR_HANDLE_EOF {
+			return nil, nil
+		}
+		return nil, e
+	}
+	defer windows.FindClose(windows.Handle(h))
+
+	names := []string{}
+	for {
+		if name := windows.UTF16ToString(data.StreamName[:]); name != "::$DATA" {
+			names = append(names, strings.TrimSuffix(name, ":$DATA"))
+		}
+		if r, _, e := procFindNextStreamW.Call(h, uintptr(unsafe.Pointer(&data))); r == 0 {
+			if e == windows.ERROR_HANDLE_EOF {
+				return names, nil
+			}
+			return names, e
+		}
+	}
+}
+
+// scopy is for just a stream.
+func scopy(src, dest string) (err error) {
+	s, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer fclose(s, &err)
+	d, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer fclose(d, &err)
+	_, err = io.Copy(d, s)
+	return err
+}
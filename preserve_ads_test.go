@@ -0,0 +1,48 @@
+//go:build windows
+// +build windows
+
+package copy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/otiai10/mint"
+)
+
+func TestOptions_PreserveADS(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "downloaded.txt")
+	Expect(t, ioutil.WriteFile(src, []byte("content"), 0o644)).ToBe(nil)
+	zone := "[ZoneTransfer]\r\nZoneId=3\r\n"
+	Expect(t, ioutil.WriteFile(src+":Zone.Identifier", []byte(zone), 0o644)).ToBe(nil)
+
+	dest := filepath.Join(t.TempDir(), "downloaded.txt")
+	err := Copy(src, dest, Options{PreserveADS: true})
+	Expect(t, err).ToBe(nil)
+	b, err := ioutil.ReadFile(dest + ":Zone.Identifier")
+	Expect(t, err).ToBe(nil)
+	Expect(t, string(b)).ToBe(zone)
+
+	plain := filepath.Join(t.TempDir(), "downloaded.txt")
+	err = Copy(src, plain)
+	Expect(t, err).ToBe(nil)
+	_, err = ioutil.ReadFile(plain + ":Zone.Identifier")
+	Expect(t, err).Not().ToBe(nil)
+
+	When(t, "src is read-only", func(t *testing.T) {
+		Expect(t, os.Chmod(src, 0o444)).ToBe(nil)
+		defer os.Chmod(src, 0o644)
+		dest := filepath.Join(t.TempDir(), "readonly.txt")
+		err := Copy(src, dest, Options{PreserveADS: true})
+		Expect(t, err).ToBe(nil)
+		b, err := ioutil.ReadFile(dest + ":Zone.Identifier")
+		Expect(t, err).ToBe(nil)
+		Expect(t, string(b)).ToBe(zone)
+		info, err := os.Stat(dest)
+		Expect(t, err).ToBe(nil)
+		Expect(t, info.Mode().Perm()&0o200).ToBe(os.FileMode(0))
+		Expect(t, os.Chmod(dest, 0o644)).ToBe(nil)
+	})
+}
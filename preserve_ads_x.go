@@ -0,0 +1,8 @@
+//go:build !windows
+// +build !windows
+
+package copy
+
+func preserveADS(src, dest string) error {
+	return nil // Unsupported
+}
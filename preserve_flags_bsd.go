@@ -0,0 +1,47 @@
+//go:build darwin || freebsd || netbsd || openbsd || dragonfly
+// +build darwin freebsd netbsd openbsd dragonfly
+
+package copy
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// File flags which prevent the file from being overwritten, see chflags(2).
+const (
+	ufImmutable = 0x00000002
+	ufAppend    = 0x00000004
+	sfImmutable = 0x00020000
+	sfAppend    = 0x00040000
+)
+
+// preserveFlags copies the file flags of src to dest,
+// such as immutable and append-only.
+func preserveFlags(src, dest string) error {
+	var stat unix.Stat_t
+	if err := unix.Lstat(src, &stat); err != nil {
+		return err
+	}
+	if stat.Flags == 0 {
+		return nil
+	}
+	return unix.Chflags(dest, int(stat.Flags))
+}
+
+// clearFlags clears the flags of dest which prevent it from being overwritten.
+func clearFlags(dest string) error {
+	var stat unix.Stat_t
+	if err := unix.Lstat(dest, &stat); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	mask := uint32(ufImmutable | ufAppend | sfImmutable | sfAppend)
+	if uint32(stat.Flags)&mask == 0 {
+		return nil
+	}
+	return unix.Chflags(dest, int(uint32(stat.Flags)&^mask))
+}
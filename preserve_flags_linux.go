@@ -0,0 +1,74 @@
+//go:build linux
+// +build linux
+
+package copy
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// Inode flags changeable by chattr(1), see ioctl_iflags(2).
+const (
+	fsImmutableFl = 0x00000010
+	fsAppendFl    = 0x00000020
+	fsChattrMask  = 0x000000ff | 0x00010000 | 0x00800000 // + DIRSYNC, NOCOW
+)
+
+// preserveFlags copies the inode flags of src to dest,
+// such as immutable and append-only.
+func preserveFlags(src, dest string) error {
+	flags, err := getFlags(src)
+	if err != nil {
+		if err == unix.ENOTTY || err == unix.EOPNOTSUPP {
+			return nil // Unsupported by the filesystem
+		}
+		return err
+	}
+	if flags&fsChattrMask == 0 {
+		return nil
+	}
+	return setFlags(dest, flags&fsChattrMask, fsChattrMask)
+}
+
+// clearFlags clears the flags of dest which prevent it from being overwritten.
+func clearFlags(dest string) error {
+	flags, err := getFlags(dest)
+	if err != nil {
+		if os.IsNotExist(err) || err == unix.ENOTTY || err == unix.EOPNOTSUPP {
+			return nil
+		}
+		return err
+	}
+	if flags&(fsImmutableFl|fsAppendFl) == 0 {
+		return nil
+	}
+	return setFlags(dest, 0, fsImmutableFl|fsAppendFl)
+}
+
+func getFlags(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return unix.IoctlGetInt(int(f.Fd()), unix.FS_IOC_GETFLAGS)
+}
+
+// setFlags sets the flags of the path, only regarding the bits in mask.
+func setFlags(path string, flags, mask int) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	orig, err := unix.IoctlGetInt(int(f.Fd()), unix.FS_IOC_GETFLAGS)
+	if err != nil {
+		return err
+	}
+	if orig&^mask|flags == orig {
+		return nil
+	}
+	return unix.IoctlSetPointerInt(int(f.Fd()), unix.FS_IOC_SETFLAGS, orig&^mask|flags)
+}
@@ -0,0 +1,54 @@
+//go:build linux
+// +build linux
+
+package copy
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	. "github.com/otiai10/mint"
+)
+
+const fsNodumpFl = 0x00000040
+
+func TestOptions_PreserveFileFlags(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "nodump")
+	Expect(t, ioutil.WriteFile(src, []byte("nodump"), 0o644)).ToBe(nil)
+	if err := setFlags(src, fsNodumpFl, fsNodumpFl); err != nil {
+		t.Skipf("the filesystem doesn't support inode flags: %v", err)
+	}
+
+	dest := filepath.Join(t.TempDir(), "nodump")
+	err := Copy(src, dest, Options{PreserveFileFlags: true})
+	Expect(t, err).ToBe(nil)
+	flags, err := getFlags(dest)
+	Expect(t, err).ToBe(nil)
+	Expect(t, flags&fsNodumpFl).ToBe(fsNodumpFl)
+
+	plain := filepath.Join(t.TempDir(), "nodump")
+	err = Copy(src, plain)
+	Expect(t, err).ToBe(nil)
+	flags, err = getFlags(plain)
+	Expect(t, err).ToBe(nil)
+	Expect(t, flags&fsNodumpFl).ToBe(0)
+}
+
+func TestOptions_ClearDestFlags(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), "immutable")
+	Expect(t, ioutil.WriteFile(dest, []byte("immutable"), 0o644)).ToBe(nil)
+	if err := setFlags(dest, fsImmutableFl, fsImmutableFl); err != nil {
+		t.Skipf("immutable flag is not permitted: %v", err)
+	}
+	t.Cleanup(func() { setFlags(dest, 0, fsImmutableFl) })
+
+	err := Copy("test/data/case01/README.md", dest)
+	Expect(t, err).Not().ToBe(nil)
+
+	err = Copy("test/data/case01/README.md", dest, Options{ClearDestFlags: true})
+	Expect(t, err).ToBe(nil)
+	b, err := ioutil.ReadFile(dest)
+	Expect(t, err).ToBe(nil)
+	Expect(t, string(b)).ToBe("case01 - README.md")
+}
@@ -0,0 +1,12 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package copy
+
+func preserveFlags(src, dest string) error {
+	return nil // Unsupported
+}
+
+func clearFlags(dest string) error {
+	return nil // Unsupported
+}
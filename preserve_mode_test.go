@@ -0,0 +1,67 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package copy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/otiai10/mint"
+)
+
+func TestOptions_PreserveMode(t *testing.T) {
+	src, dest := filepath.Join(t.TempDir(), "src"), filepath.Join(t.TempDir(), "dest")
+	Expect(t, os.MkdirAll(filepath.Join(src, "shared"), 0755)).ToBe(nil)
+	Expect(t, os.WriteFile(filepath.Join(src, "bin"), []byte("#!/bin/sh\n"), 0755)).ToBe(nil)
+	modes := map[string]os.FileMode{
+		"bin":    0755 | os.ModeSetuid,
+		"shared": 0755 | os.ModeSetgid | os.ModeDir,
+	}
+	for name, mode := range modes {
+		Expect(t, os.Chmod(filepath.Join(src, name), mode)).ToBe(nil)
+	}
+
+	err := Copy(src, dest, Options{PreserveMode: true, PreserveOwner: true})
+	Expect(t, err).ToBe(nil)
+	for name, mode := range modes {
+		info, err := os.Stat(filepath.Join(dest, name))
+		Expect(t, err).ToBe(nil)
+		Expect(t, info.Mode()).ToBe(mode)
+	}
+
+	When(t, "conflicting with DestFS", func(t *testing.T) {
+		err := Copy(src, dest, Options{PreserveMode: true, DestFS: NewMemFS()})
+		Expect(t, err).Not().ToBe(nil)
+	})
+}
+
+func TestOptions_DefaultMode(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src")
+	Expect(t, os.MkdirAll(filepath.Join(src, "sub"), 0750)).ToBe(nil)
+	Expect(t, os.WriteFile(filepath.Join(src, "sub", "secret"), []byte("secret"), 0640)).ToBe(nil)
+	Expect(t, os.Chmod(filepath.Join(src, "sub"), 0750)).ToBe(nil)
+
+	dest := filepath.Join(t.TempDir(), "dest")
+	err := Copy(src, dest, Options{DefaultDirMode: 0700, DefaultFileMode: 0600, PermissionControl: DoNothing})
+	Expect(t, err).ToBe(nil)
+	info, err := os.Stat(filepath.Join(dest, "sub"))
+	Expect(t, err).ToBe(nil)
+	Expect(t, info.Mode().Perm()).ToBe(os.FileMode(0700))
+	info, err = os.Stat(filepath.Join(dest, "sub", "secret"))
+	Expect(t, err).ToBe(nil)
+	Expect(t, info.Mode().Perm()).ToBe(os.FileMode(0600))
+
+	When(t, "CreateWithSourceMode is given", func(t *testing.T) {
+		dest := filepath.Join(t.TempDir(), "dest")
+		err := Copy(src, dest, Options{CreateWithSourceMode: true, PermissionControl: DoNothing})
+		Expect(t, err).ToBe(nil)
+		info, err := os.Stat(filepath.Join(dest, "sub"))
+		Expect(t, err).ToBe(nil)
+		Expect(t, info.Mode().Perm()).ToBe(os.FileMode(0750))
+		info, err = os.Stat(filepath.Join(dest, "sub", "secret"))
+		Expect(t, err).ToBe(nil)
+		Expect(t, info.Mode().Perm()).ToBe(os.FileMode(0640))
+	})
+}
@@ -8,16 +8,21 @@ import (
 	"syscall"
 )
 
-func preserveOwner(src, dest string, info fileInfo) (err error) {
+func preserveOwner(src, dest string, info fileInfo, opt Options) (err error) {
 	if info == nil {
 		if info, err = os.Stat(src); err != nil {
 			return err
 		}
 	}
 	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
-		if err := os.Chown(dest, int(stat.Uid), int(stat.Gid)); err != nil {
+		uid, gid := mapOwner(int(stat.Uid), int(stat.Gid), opt)
+		if err := os.Chown(dest, uid, gid); err != nil {
 			return err
 		}
 	}
 	return nil
 }
+
+func chown(dest string, uid, gid int) error {
+	return os.Chown(dest, uid, gid)
+}
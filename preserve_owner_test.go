@@ -0,0 +1,82 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package copy
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+
+	. "github.com/otiai10/mint"
+)
+
+func TestOptions_ChownTo(t *testing.T) {
+	uid, gid := os.Getuid(), os.Getgid()
+	if uid == 0 {
+		uid, gid = 12345, 12345 // Only root can give away the files.
+	}
+	dest := filepath.Join(t.TempDir(), "dest")
+	opt := Options{
+		ChownTo:       &Owner{User: strconv.Itoa(uid), Group: strconv.Itoa(gid)},
+		PreserveOwner: true,
+	}
+	err := Copy("test/data/case01", dest, opt)
+	Expect(t, err).ToBe(nil)
+	for _, path := range []string{dest, filepath.Join(dest, "README.md")} {
+		info, err := os.Stat(path)
+		Expect(t, err).ToBe(nil)
+		stat := info.Sys().(*syscall.Stat_t)
+		Expect(t, int(stat.Uid)).ToBe(uid)
+		Expect(t, int(stat.Gid)).ToBe(gid)
+	}
+
+	When(t, "the user can't be resolved", func(t *testing.T) {
+		dest := filepath.Join(t.TempDir(), "dest")
+		err := Copy("test/data/case01", dest, Options{ChownTo: &Owner{User: "no-such-user-for-copy"}})
+		Expect(t, err).Not().ToBe(nil)
+		_, err = os.Stat(dest)
+		Expect(t, os.IsNotExist(err)).ToBe(true)
+	})
+}
+
+func TestOptions_UIDMap(t *testing.T) {
+	uid, gid := os.Getuid(), os.Getgid()
+	to := uid
+	if uid == 0 {
+		to = 100000 // Only root can give away the files.
+	}
+	dest := filepath.Join(t.TempDir(), "dest")
+	opt := Options{
+		PreserveOwner: true,
+		UIDMap:        []IDMap{{From: uid, To: to, Size: 65536}},
+		GIDMap:        []IDMap{{From: gid + 1, To: 100000, Size: 65536}},
+	}
+	err := Copy("test/data/case01", dest, opt)
+	Expect(t, err).ToBe(nil)
+	for _, path := range []string{dest, filepath.Join(dest, "README.md")} {
+		info, err := os.Stat(path)
+		Expect(t, err).ToBe(nil)
+		stat := info.Sys().(*syscall.Stat_t)
+		Expect(t, int(stat.Uid)).ToBe(to)
+		Expect(t, int(stat.Gid)).ToBe(gid)
+	}
+
+	When(t, "MapOwner is given", func(t *testing.T) {
+		dest := filepath.Join(t.TempDir(), "dest")
+		mapped := [][2]int{}
+		opt := Options{
+			PreserveOwner: true,
+			UIDMap:        []IDMap{{From: uid, To: to, Size: 1}},
+			MapOwner: func(uid, gid int) (int, int) {
+				mapped = append(mapped, [2]int{uid, gid})
+				return uid, gid
+			},
+		}
+		err := Copy("test/data/case01/README.md", dest, opt)
+		Expect(t, err).ToBe(nil)
+		Expect(t, mapped).ToBe([][2]int{{to, gid}})
+	})
+}
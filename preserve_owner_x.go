@@ -3,6 +3,10 @@
 
 package copy
 
-func preserveOwner(src, dest string, info fileInfo) (err error) {
+func preserveOwner(src, dest string, info fileInfo, opt Options) (err error) {
+	return nil
+}
+
+func chown(dest string, uid, gid int) error {
 	return nil
 }
@@ -0,0 +1,33 @@
+//go:build linux
+// +build linux
+
+package copy
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+const selinuxXattr = "security.selinux"
+
+// preserveSELinux copies the SELinux security context of src to dest.
+// It does nothing if src has no context, or SELinux is not available.
+func preserveSELinux(src, dest string) error {
+	label := make([]byte, 256)
+	n, err := unix.Lgetxattr(src, selinuxXattr, label)
+	if err == unix.ERANGE {
+		if n, err = unix.Lgetxattr(src, selinuxXattr, nil); err == nil {
+			label = make([]byte, n)
+			n, err = unix.Lgetxattr(src, selinuxXattr, label)
+		}
+	}
+	if err != nil {
+		if err == unix.ENODATA || err == unix.EOPNOTSUPP {
+			return nil
+		}
+		return err
+	}
+	if err := unix.Lsetxattr(dest, selinuxXattr, label[:n], 0); err != nil && err != unix.EOPNOTSUPP {
+		return err
+	}
+	return nil
+}
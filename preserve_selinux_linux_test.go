@@ -0,0 +1,38 @@
+//go:build linux
+// +build linux
+
+package copy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/otiai10/mint"
+	"golang.org/x/sys/unix"
+)
+
+func TestOptions_PreserveSELinux(t *testing.T) {
+	if _, err := os.Stat("/sys/fs/selinux/enforce"); err != nil {
+		t.Skip("SELinux is not available")
+	}
+	src := t.TempDir()
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "file"), []byte("file"), 0o644)).ToBe(nil)
+	label := []byte("system_u:object_r:tmp_t:s0")
+	for _, path := range []string{src, filepath.Join(src, "file")} {
+		if err := unix.Lsetxattr(path, selinuxXattr, label, 0); err != nil {
+			t.Skipf("the security context is not permitted to set: %v", err)
+		}
+	}
+
+	dest := filepath.Join(t.TempDir(), "dest")
+	err := Copy(src, dest, Options{PreserveSELinux: true})
+	Expect(t, err).ToBe(nil)
+	for _, path := range []string{dest, filepath.Join(dest, "file")} {
+		b := make([]byte, 256)
+		n, err := unix.Lgetxattr(path, selinuxXattr, b)
+		Expect(t, err).ToBe(nil)
+		Expect(t, string(b[:n])).ToBe(string(label))
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+// +build !linux
+
+package copy
+
+func preserveSELinux(src, dest string) error {
+	return nil // Unsupported
+}
@@ -2,8 +2,11 @@ package copy
 
 import "os"
 
-func preserveTimes(srcinfo os.FileInfo, dest string) error {
+func preserveTimes(srcinfo os.FileInfo, dest string, opt Options) error {
 	spec := getTimeSpec(srcinfo)
+	if opt.DestFS != nil {
+		return opt.DestFS.Chtimes(dest, spec.Atime, spec.Mtime)
+	}
 	if err := os.Chtimes(dest, spec.Atime, spec.Mtime); err != nil {
 		return err
 	}
@@ -0,0 +1,61 @@
+//go:build windows
+// +build windows
+
+package copy
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+// windowsAttrs are the file attributes preserved by PreserveWindowsAttrs.
+const windowsAttrs = windows.FILE_ATTRIBUTE_HIDDEN | windows.FILE_ATTRIBUTE_SYSTEM |
+	windows.FILE_ATTRIBUTE_READONLY | windows.FILE_ATTRIBUTE_ARCHIVE
+
+// preserveWindowsAttrs copies the creation time of src to dest,
+// and then the attributes, which must be the last since ReadOnly
+// prevents dest from being changed any more.
+func preserveWindowsAttrs(src, dest string) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	if stat, ok := info.Sys().(*syscall.Win32FileAttributeData); ok {
+		if err := setCreationTime(dest, windows.NsecToFiletime(stat.CreationTime.Nanoseconds())); err != nil {
+			return err
+		}
+	}
+	s, err := windows.UTF16PtrFromString(src)
+	if err != nil {
+		return err
+	}
+	attrs, err := windows.GetFileAttributes(s)
+	if err != nil {
+		return err
+	}
+	if attrs &= windowsAttrs; attrs == 0 {
+		attrs = windows.FILE_ATTRIBUTE_NORMAL
+	}
+	d, err := windows.UTF16PtrFromString(dest)
+	if err != nil {
+		return err
+	}
+	return windows.SetFileAttributes(d, attrs)
+}
+
+// setCreationTime sets only the creation time of the file or directory.
+func setCreationTime(path string, ctime windows.Filetime) error {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return err
+	}
+	h, err := windows.CreateFile(p, windows.FILE_WRITE_ATTRIBUTES, windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE,
+		nil, windows.OPEN_EXISTING, windows.FILE_FLAG_BACKUP_SEMANTICS, 0)
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(h)
+	return windows.SetFileTime(h, &ctime, nil, nil)
+}
@@ -0,0 +1,54 @@
+//go:build windows
+// +build windows
+
+package copy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	. "github.com/otiai10/mint"
+	"golang.org/x/sys/windows"
+)
+
+func TestOptions_PreserveWindowsAttrs(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src")
+	Expect(t, os.MkdirAll(filepath.Join(src, "sub"), 0o755)).ToBe(nil)
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "sub", "desktop.ini"), []byte("[.ShellClassInfo]"), 0o644)).ToBe(nil)
+	created := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	Expect(t, setCreationTime(filepath.Join(src, "sub", "desktop.ini"), windows.NsecToFiletime(created.UnixNano()))).ToBe(nil)
+	attrs := map[string]uint32{
+		"sub":                               windows.FILE_ATTRIBUTE_HIDDEN,
+		filepath.Join("sub", "desktop.ini"): windows.FILE_ATTRIBUTE_HIDDEN | windows.FILE_ATTRIBUTE_SYSTEM | windows.FILE_ATTRIBUTE_READONLY,
+	}
+	for name, attr := range attrs {
+		p, err := windows.UTF16PtrFromString(filepath.Join(src, name))
+		Expect(t, err).ToBe(nil)
+		Expect(t, windows.SetFileAttributes(p, attr)).ToBe(nil)
+	}
+
+	dest := filepath.Join(t.TempDir(), "dest")
+	t.Cleanup(func() {
+		// ReadOnly files can't be removed by TempDir.
+		for _, root := range []string{src, dest} {
+			os.Chmod(filepath.Join(root, "sub", "desktop.ini"), 0o644)
+		}
+	})
+	err := Copy(src, dest, Options{PreserveWindowsAttrs: true})
+	Expect(t, err).ToBe(nil)
+	for name, attr := range attrs {
+		p, err := windows.UTF16PtrFromString(filepath.Join(dest, name))
+		Expect(t, err).ToBe(nil)
+		got, err := windows.GetFileAttributes(p)
+		Expect(t, err).ToBe(nil)
+		Expect(t, got&windowsAttrs).ToBe(attr)
+	}
+	info, err := os.Stat(filepath.Join(dest, "sub", "desktop.ini"))
+	Expect(t, err).ToBe(nil)
+	stat := info.Sys().(*syscall.Win32FileAttributeData)
+	Expect(t, stat.CreationTime.Nanoseconds()).ToBe(created.UnixNano())
+}
@@ -0,0 +1,98 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package copy
+
+import (
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// preserveXattrs copies the extended attributes of src to dest,
+// except those excluded by Options.XattrFilter.
+// Symlinks themselves are regarded, not the files they point to.
+func preserveXattrs(src, dest string, opt Options) error {
+	xattrs, err := readXattrs(src, opt)
+	if err != nil {
+		return err
+	}
+	for name, value := range xattrs {
+		if err := unix.Lsetxattr(dest, name, []byte(value), 0); err != nil {
+			if err == unix.EPERM && strings.HasPrefix(name, "user.") {
+				continue // Not permitted on symlinks on Linux
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// readXattrs returns the extended attributes of src,
+// except those excluded by Options.XattrFilter.
+func readXattrs(src string, opt Options) (map[string]string, error) {
+	names, err := listXattrs(src)
+	if err != nil {
+		if err == unix.ENOTSUP || err == unix.EOPNOTSUPP {
+			return nil, nil // Unsupported by the filesystem
+		}
+		return nil, err
+	}
+	xattrs := map[string]string{}
+	for _, name := range names {
+		if opt.XattrFilter != nil && !opt.XattrFilter(name) {
+			continue
+		}
+		value, err := getXattr(src, name)
+		if err != nil {
+			if err == errNoXattr {
+				continue // Removed in the meantime
+			}
+			return nil, err
+		}
+		xattrs[name] = string(value)
+	}
+	return xattrs, nil
+}
+
+func listXattrs(path string) ([]string, error) {
+	for {
+		size, err := unix.Llistxattr(path, nil)
+		if err != nil || size == 0 {
+			return nil, err
+		}
+		buf := make([]byte, size)
+		size, err = unix.Llistxattr(path, buf)
+		if err == unix.ERANGE {
+			continue // Grown in the meantime
+		}
+		if err != nil {
+			return nil, err
+		}
+		names := []string{}
+		for _, name := range strings.Split(string(buf[:size]), "\x00") {
+			if name != "" {
+				names = append(names, name)
+			}
+		}
+		return names, nil
+	}
+}
+
+func getXattr(path, name string) ([]byte, error) {
+	for {
+		size, err := unix.Lgetxattr(path, name, nil)
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size)
+		size, err = unix.Lgetxattr(path, name, buf)
+		if err == unix.ERANGE {
+			continue // Grown in the meantime
+		}
+		if err != nil {
+			return nil, err
+		}
+		return buf[:size], nil
+	}
+}
@@ -0,0 +1,9 @@
+//go:build darwin
+// +build darwin
+
+package copy
+
+import "golang.org/x/sys/unix"
+
+// errNoXattr is returned when the extended attribute doesn't exist.
+const errNoXattr = unix.ENOATTR
@@ -0,0 +1,72 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package copy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/otiai10/mint"
+	"golang.org/x/sys/unix"
+)
+
+func TestOptions_PreserveXattrs(t *testing.T) {
+	src := t.TempDir()
+	Expect(t, ioutil.WriteFile(filepath.Join(src, "file"), []byte("file"), 0o644)).ToBe(nil)
+	for _, path := range []string{src, filepath.Join(src, "file")} {
+		if err := unix.Lsetxattr(path, "user.comment", []byte("hello"), 0); err != nil {
+			t.Skipf("the filesystem doesn't support extended attributes: %v", err)
+		}
+		Expect(t, unix.Lsetxattr(path, "user.secret", []byte("secret"), 0)).ToBe(nil)
+	}
+
+	dest := filepath.Join(t.TempDir(), "dest")
+	opt := Options{
+		PreserveXattrs: true,
+		XattrFilter: func(name string) bool {
+			return name != "user.secret"
+		},
+	}
+	err := Copy(src, dest, opt)
+	Expect(t, err).ToBe(nil)
+	for _, path := range []string{dest, filepath.Join(dest, "file")} {
+		value, err := getXattr(path, "user.comment")
+		Expect(t, err).ToBe(nil)
+		Expect(t, string(value)).ToBe("hello")
+		_, err = getXattr(path, "user.secret")
+		Expect(t, err).ToBe(errNoXattr)
+	}
+
+	plain := filepath.Join(t.TempDir(), "plain")
+	err = Copy(src, plain)
+	Expect(t, err).ToBe(nil)
+	names, err := listXattrs(filepath.Join(plain, "file"))
+	Expect(t, err).ToBe(nil)
+	Expect(t, len(names)).ToBe(0)
+
+	When(t, "src is read-only", func(t *testing.T) {
+		src := filepath.Join(t.TempDir(), "readonly")
+		Expect(t, ioutil.WriteFile(src, []byte("readonly"), 0o644)).ToBe(nil)
+		Expect(t, unix.Lsetxattr(src, "user.comment", []byte("hello"), 0)).ToBe(nil)
+		Expect(t, os.Chmod(src, 0o444)).ToBe(nil)
+		dest := filepath.Join(t.TempDir(), "readonly")
+		err := Copy(src, dest, opt)
+		Expect(t, err).ToBe(nil)
+		value, err := getXattr(dest, "user.comment")
+		Expect(t, err).ToBe(nil)
+		Expect(t, string(value)).ToBe("hello")
+		info, err := os.Stat(dest)
+		Expect(t, err).ToBe(nil)
+		Expect(t, info.Mode().Perm()).ToBe(os.FileMode(0o444))
+	})
+
+	When(t, "src has a symlink", func(t *testing.T) {
+		Expect(t, os.Symlink("file", filepath.Join(src, "link"))).ToBe(nil)
+		dest := filepath.Join(t.TempDir(), "dest")
+		err := Copy(src, dest, opt)
+		Expect(t, err).ToBe(nil)
+	})
+}
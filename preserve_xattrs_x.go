@@ -0,0 +1,12 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package copy
+
+func preserveXattrs(src, dest string, opt Options) error {
+	return nil // Unsupported
+}
+
+func readXattrs(src string, opt Options) (map[string]string, error) {
+	return nil, nil // Unsupported
+}
@@ -0,0 +1,43 @@
+package copy
+
+import (
+	"io"
+	"time"
+)
+
+// progressReader calls Options.OnProgress as the src file is read,
+// at most once per Options.ProgressInterval, and once at the end.
+type progressReader struct {
+	r         io.Reader
+	src, dest string
+	copied    int64
+	total     int64
+	reported  int64
+	last      time.Time
+	opt       Options
+}
+
+// progress wraps r to report the progress of copying src to dest, if needed.
+func progress(r io.Reader, src, dest string, total int64, opt Options) io.Reader {
+	if opt.OnProgress == nil {
+		return r
+	}
+	return &progressReader{r: r, src: src, dest: dest, total: total, reported: -1, opt: opt}
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.copied += int64(n)
+	switch {
+	case err == io.EOF && p.reported != p.copied:
+		p.report()
+	case n > 0 && time.Since(p.last) >= p.opt.ProgressInterval:
+		p.report()
+	}
+	return n, err
+}
+
+func (p *progressReader) report() {
+	p.opt.OnProgress(p.src, p.dest, p.copied, p.total)
+	p.reported, p.last = p.copied, time.Now()
+}
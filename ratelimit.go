@@ -0,0 +1,48 @@
+package copy
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// limiter limits the bytes per second shared by all the readers using it.
+type limiter struct {
+	mu   sync.Mutex
+	rate int64     // bytes per second
+	next time.Time // when the next bytes are allowed to be read
+}
+
+func newLimiter(rate int64) *limiter {
+	return &limiter{rate: rate}
+}
+
+// wait blocks until n bytes are allowed to be read.
+func (l *limiter) wait(n int) {
+	if n <= 0 {
+		return
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(float64(n) / float64(l.rate) * float64(time.Second)))
+	until := l.next
+	l.mu.Unlock()
+	time.Sleep(time.Until(until))
+}
+
+// throttledReader reads src no faster than all the limiters allow.
+type throttledReader struct {
+	src      io.Reader
+	limiters []*limiter
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	n, err := r.src.Read(p)
+	for _, l := range r.limiters {
+		l.wait(n)
+	}
+	return n, err
+}
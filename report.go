@@ -0,0 +1,126 @@
+package copy
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CopyReport summarizes what CopyWithReport did.
+type CopyReport struct {
+	// Bytes is the total bytes written to dest.
+	Bytes int64
+	// Files is the number of the files copied.
+	Files int64
+	// Dirs is the number of the directories copied.
+	Dirs int64
+	// Symlinks is the number of the symlinks created.
+	Symlinks int64
+	// Sockets is the number of the sockets found,
+	// whether skipped or recreated by OnSocket.
+	Sockets int64
+	// Skipped holds the src entries skipped on purpose, sorted,
+	// such as by Skip, SkipIfContentEqual and OnSymlink.
+	Skipped []string
+	// Errors holds the errors ignored by OnError or OnErrorAction,
+	// or collected by ErrorPolicy, in the order they occurred.
+	Errors []EntryError
+	// Elapsed is the time taken to copy.
+	Elapsed time.Duration
+}
+
+// EntryError is an error occurred on copying an entry.
+type EntryError struct {
+	Src  string
+	Dest string
+	Err  error
+}
+
+func (e EntryError) Error() string {
+	return fmt.Sprintf("%s -> %s: %v", e.Src, e.Dest, e.Err)
+}
+
+func (e EntryError) Unwrap() error {
+	return e.Err
+}
+
+// CopyWithReport copies src to dest just like Copy,
+// and reports what it did, even if it failed in the middle.
+func CopyWithReport(src, dest string, opts ...Options) (CopyReport, error) {
+	return withReport(opts, func(opt Options) error {
+		return Copy(src, dest, opt)
+	})
+}
+
+// withReport calls f with the options to record what it does into the report.
+func withReport(opts []Options, f func(opt Options) error) (CopyReport, error) {
+	report := CopyReport{}
+	opt := Options{}
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	counters := []struct{ given, own *int64 }{
+		{opt.BytesWritten, &report.Bytes},
+		{opt.FilesCopied, &report.Files},
+		{opt.DirsCopied, &report.Dirs},
+	}
+	opt.BytesWritten, opt.FilesCopied, opt.DirsCopied = &report.Bytes, &report.Files, &report.Dirs
+	opt.intent.report = &reporter{report: &report}
+
+	start := time.Now()
+	err := f(opt)
+	report.Elapsed = time.Since(start)
+
+	for _, c := range counters {
+		if c.given != nil {
+			atomic.AddInt64(c.given, *c.own)
+		}
+	}
+	sort.Strings(report.Skipped)
+	return report, err
+}
+
+// reporter records what CopyWithReport does, even when copying concurrently.
+type reporter struct {
+	mu     sync.Mutex
+	report *CopyReport
+}
+
+func (r *reporter) symlinked() {
+	atomic.AddInt64(&r.report.Symlinks, 1)
+}
+
+func (r *reporter) socket() {
+	atomic.AddInt64(&r.report.Sockets, 1)
+}
+
+func (r *reporter) skipped(src string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.report.Skipped = append(r.report.Skipped, src)
+}
+
+func (r *reporter) ignored(src, dest string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.report.Errors = append(r.report.Errors, EntryError{Src: src, Dest: dest, Err: err})
+}
+
+// skipped records the entry skipped on purpose, to the plan or the report.
+func skipped(src, dest, reason string, opt Options) {
+	if opt.intent.subst != nil {
+		opt.intent.subst.skip(src, dest, reason)
+	}
+	if opt.intent.report != nil {
+		opt.intent.report.skipped(src)
+	}
+}
+
+// ignored records the error ignored by OnError, OnErrorAction or ErrorPolicy to the report.
+func ignored(src, dest string, err error, opt Options) {
+	if opt.intent.report != nil && err != nil {
+		opt.intent.report.ignored(src, dest, err)
+	}
+}
@@ -0,0 +1,113 @@
+package copy
+
+import (
+	"crypto/sha256"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// fcopyResumable copies src into the partial file of dest first,
+// continuing from the end of it if it's left by an interrupted copy,
+// and renames it to dest when it's complete.
+func fcopyResumable(src, dest string, info os.FileInfo, opt Options) (err error) {
+	if err := mkdirAll(filepath.Dir(dest), os.ModePerm, opt); err != nil {
+		return err
+	}
+	part := dest + opt.ResumeSuffix
+	offset, err := resumable(src, part, info, opt)
+	if err != nil {
+		return err
+	}
+
+	// The partial file is written as it is, and the rest is done here for dest.
+	inner := opt
+	inner.PreCreateDest, inner.BatchWriter = false, nil
+	inner.PreserveFileFlags, inner.TimestampSink, inner.FilesCopied, inner.intent.checksums = false, nil, nil, nil
+	if offset > 0 {
+		// The rest of src is appended to the partial file.
+		inner.AppendMode, inner.intent.resumeAt = true, offset
+		inner.CloneMode, inner.Sparse, inner.ParallelChunkSize = CloneNever, false, 0
+	}
+	if inner.SyncMode == SyncBatched {
+		// Because it's renamed, only the directory is synced in batch.
+		inner.SyncMode = SyncPerFile
+	}
+	if err := fwrite(src, part, info, inner); err != nil {
+		return err
+	}
+	if err := os.Rename(part, dest); err != nil {
+		return err
+	}
+
+	if opt.PreserveFileFlags && opt.FS == nil {
+		// After renamed, because immutable file cannot be renamed.
+		if err := preserveFlags(src, dest); err != nil {
+			return err
+		}
+	}
+	if opt.intent.checksums != nil {
+		if err := opt.intent.checksums.file(dest); err != nil {
+			return err
+		}
+	}
+	if opt.TimestampSink != nil {
+		opt.TimestampSink(dest, getTimeSpec(info))
+	}
+	if opt.FilesCopied != nil {
+		atomic.AddInt64(opt.FilesCopied, 1)
+	}
+	return nil
+}
+
+// resumable returns the size of the partial file if it can be continued,
+// that is, it has the same digest as the beginning of src, or 0 if not.
+func resumable(src, part string, info os.FileInfo, opt Options) (int64, error) {
+	partinfo, err := os.Stat(part)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if !partinfo.Mode().IsRegular() || partinfo.Size() == 0 || partinfo.Size() > info.Size() {
+		return 0, nil
+	}
+	s, err := open(src, opt)
+	if err != nil {
+		return 0, err
+	}
+	defer s.Close()
+	p, err := os.Open(part)
+	if err != nil {
+		return 0, err
+	}
+	defer p.Close()
+	hasher := opt.Hasher
+	if hasher == nil {
+		hasher = sha256.New
+	}
+	same, err := equalDigests(io.LimitReader(s, partinfo.Size()), p, hasher)
+	if err != nil || !same {
+		return 0, err
+	}
+	if perm := partinfo.Mode().Perm(); perm&0o200 == 0 {
+		// It may have been made read-only as src by PermissionControl.
+		if err := os.Chmod(part, perm|0o200); err != nil {
+			return 0, err
+		}
+	}
+	return partinfo.Size(), nil
+}
+
+// skip reads r forward by n bytes, by seeking if possible.
+func skip(r io.Reader, n int64) error {
+	if s, ok := r.(io.Seeker); ok {
+		_, err := s.Seek(n, io.SeekStart)
+		return err
+	}
+	_, err := io.CopyN(ioutil.Discard, r, n)
+	return err
+}
@@ -0,0 +1,51 @@
+package copy
+
+import (
+	"os"
+	"time"
+)
+
+// retry calls f, and calls it again on error as Options.Retry.
+func retry(f func() error, opt Options) error {
+	err := f()
+	backoff := opt.Retry.Backoff
+	for n := 0; err != nil && n < opt.Retry.Attempts; n++ {
+		if stopping(err) || (opt.Retry.RetryIf != nil && !opt.Retry.RetryIf(err)) {
+			return err
+		}
+		if backoff > 0 {
+			timer := time.NewTimer(backoff)
+			select {
+			case <-timer.C:
+			case <-opt.intent.ctx.Done():
+				timer.Stop()
+				return err
+			}
+			backoff *= 2
+		}
+		err = f()
+	}
+	return err
+}
+
+// rewinding wraps f copying a file by AppendMode, so that calling it again
+// truncates dest back to the size before the first call,
+// not to append again what a failed call has partially appended.
+func rewinding(dest string, f func() error) func() error {
+	size, called := int64(0), false
+	return func() error {
+		if !called {
+			called = true
+			if info, err := os.Stat(dest); err == nil {
+				size = info.Size()
+			} else if !os.IsNotExist(err) {
+				return err
+			}
+			return f()
+		}
+		if err := os.Truncate(dest, size); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return f()
+	}
+}
@@ -0,0 +1,138 @@
+package copy
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// archiveSink writes what's copied into an archive, instead of the destination.
+type archiveSink interface {
+	// add writes the entry of src, named dest in the archive,
+	// and returns the writer for the content if src is a regular file.
+	// link is the target, only if src is a symlink.
+	add(src, dest string, info os.FileInfo, link string, opt Options) (io.Writer, error)
+}
+
+// archiver writes everything into the archive by sink, instead of the destination.
+type archiver struct {
+	sink archiveSink
+}
+
+// copyToArchive walks src as Copy does, and writes everything into sink.
+// fn is the name of the caller, to tell which options conflict with it.
+func copyToArchive(fn, src string, sink archiveSink, opts ...Options) error {
+	opt := assureOptions(src, "", opts...)
+	if err := checkConflicts(opt); err != nil {
+		return err
+	}
+	for _, c := range []struct {
+		set  bool
+		name string
+	}{
+		{opt.LineTransform != nil, "LineTransform"},
+		{opt.WrapReader != nil, "WrapReader"},
+		{opt.DestFS != nil, "DestFS"},
+		{opt.SymlinkFiles, "SymlinkFiles"},
+	} {
+		if c.set {
+			return fmt.Errorf("%w: %s and %s", ErrConflictingOptions, fn, c.name)
+		}
+	}
+	opt, err := substituted(opt, &archiver{sink: sink})
+	if err != nil {
+		return err
+	}
+	info, err := lstat(src, opt)
+	if err != nil {
+		return onError(src, "", err, opt)
+	}
+	dest := ""
+	if !info.IsDir() {
+		dest = filepath.Base(src)
+	}
+	opt.intent.dest = dest
+	return switchboard(src, dest, info, opt)
+}
+
+// archiveName returns the name of dest in the archive,
+// which is slash-separated and ends with a slash for a directory.
+func archiveName(dest string, info os.FileInfo) string {
+	name := filepath.ToSlash(dest)
+	if info.IsDir() {
+		name += "/"
+	}
+	return name
+}
+
+// stat always says dest doesn't exist, as the archive is written from scratch.
+func (a *archiver) stat(dest string, follow bool) (os.FileInfo, error) {
+	return nil, nothing(dest)
+}
+
+// dir writes the entry of the directory, except for the root which has no entry.
+func (a *archiver) dir(srcdir, destdir string, info os.FileInfo, opt Options) error {
+	if destdir == opt.intent.dest {
+		return nil
+	}
+	_, err := a.sink.add(srcdir, destdir, info, "", opt)
+	return err
+}
+
+// file writes the entry of the file, with its content.
+func (a *archiver) file(src, dest string, info os.FileInfo, opt Options) error {
+	if !info.Mode().IsRegular() {
+		_, err := a.sink.add(src, dest, info, "", opt) // Such as devices, without content
+		return err
+	}
+	f, err := open(src, opt)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w, err := a.sink.add(src, dest, info, "", opt)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(w, progress(f, src, dest, info.Size(), opt))
+	if opt.BytesWritten != nil {
+		atomic.AddInt64(opt.BytesWritten, n)
+	}
+	if err != nil {
+		return err
+	}
+	if opt.FilesCopied != nil {
+		atomic.AddInt64(opt.FilesCopied, 1)
+	}
+	return nil
+}
+
+// symlink writes the entry of the symlink as it is.
+func (a *archiver) symlink(src, dest string, opt Options) error {
+	info, err := lstat(src, opt)
+	if err != nil {
+		return err
+	}
+	link, err := readlink(src, opt)
+	if err != nil {
+		return err
+	}
+	_, err = a.sink.add(src, dest, info, link, opt)
+	return err
+}
+
+// special writes the entry of the named pipe or device, without content.
+// Sockets can't be archived.
+func (a *archiver) special(src, dest string, info os.FileInfo, kind string, opt Options) error {
+	if info.Mode()&os.ModeSocket != 0 {
+		skipped(src, dest, kind, opt)
+		return nil
+	}
+	return a.file(src, dest, info, opt)
+}
+
+func (a *archiver) remove(src, dest, reason string) {}
+
+func (a *archiver) skip(src, dest, reason string) {}
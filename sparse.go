@@ -0,0 +1,49 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package copy
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// sparse copies only the data regions of src into dest,
+// found by SEEK_DATA and SEEK_HOLE, leaving the holes unwritten.
+// It returns ok=false without writing anything
+// if the filesystem of src can't tell where the holes are.
+func sparse(dest *os.File, src *os.File, size int64, buf []byte) (n int64, ok bool, err error) {
+	for offset := int64(0); offset < size; {
+		data, err := src.Seek(offset, unix.SEEK_DATA)
+		if errors.Is(err, unix.ENXIO) {
+			break // No more data, the rest is a hole.
+		}
+		if err != nil {
+			if offset == 0 && errors.Is(err, unix.EINVAL) {
+				return 0, false, nil
+			}
+			return n, true, err
+		}
+		hole, err := src.Seek(data, unix.SEEK_HOLE)
+		if err != nil {
+			return n, true, err
+		}
+		if _, err := src.Seek(data, io.SeekStart); err != nil {
+			return n, true, err
+		}
+		if _, err := dest.Seek(data, io.SeekStart); err != nil {
+			return n, true, err
+		}
+		written, err := io.CopyBuffer(dest, io.LimitReader(src, hole-data), buf)
+		n += written
+		if err != nil {
+			return n, true, err
+		}
+		offset = hole
+	}
+	// Extend dest to the size of src, in case it ends with a hole.
+	return n, true, dest.Truncate(size)
+}
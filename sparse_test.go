@@ -0,0 +1,53 @@
+//go:build linux
+// +build linux
+
+package copy
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	. "github.com/otiai10/mint"
+)
+
+func TestOptions_Sparse(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "disk.img")
+	f, err := os.Create(src)
+	Expect(t, err).ToBe(nil)
+	_, err = f.WriteAt([]byte("head"), 0)
+	Expect(t, err).ToBe(nil)
+	_, err = f.WriteAt([]byte("tail"), 8<<20)
+	Expect(t, err).ToBe(nil)
+	Expect(t, f.Truncate(16<<20)).ToBe(nil)
+	Expect(t, f.Close()).ToBe(nil)
+	srcinfo, err := os.Stat(src)
+	Expect(t, err).ToBe(nil)
+	if blocks := srcinfo.Sys().(*syscall.Stat_t).Blocks * 512; blocks >= srcinfo.Size() {
+		t.Skip("the filesystem doesn't support sparse files")
+	}
+
+	dest := filepath.Join(t.TempDir(), "disk.img")
+	err = Copy(src, dest, Options{Sparse: true})
+	Expect(t, err).ToBe(nil)
+	info, err := os.Stat(dest)
+	Expect(t, err).ToBe(nil)
+	Expect(t, info.Size()).ToBe(srcinfo.Size())
+	Expect(t, info.Sys().(*syscall.Stat_t).Blocks*512 < info.Size()).ToBe(true)
+	want, err := ioutil.ReadFile(src)
+	Expect(t, err).ToBe(nil)
+	got, err := ioutil.ReadFile(dest)
+	Expect(t, err).ToBe(nil)
+	Expect(t, bytes.Equal(got, want)).ToBe(true)
+
+	When(t, "the src file is wrapped", func(t *testing.T) {
+		var written int64
+		dest := filepath.Join(t.TempDir(), "disk.img")
+		err := Copy(src, dest, Options{Sparse: true, BytesWritten: &written, OnProgress: func(src, dest string, copied, total int64) {}})
+		Expect(t, err).ToBe(nil)
+		Expect(t, written).ToBe(srcinfo.Size())
+	})
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package copy
+
+import "os"
+
+func sparse(dest *os.File, src *os.File, size int64, buf []byte) (int64, bool, error) {
+	return 0, false, nil // Unsupported
+}
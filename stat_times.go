@@ -11,9 +11,12 @@ import (
 	"time"
 )
 
-func getTimeSpec(info os.FileInfo) timespec {
-	stat := info.Sys().(*syscall.Stat_t)
-	times := timespec{
+func getTimeSpec(info os.FileInfo) Timespec {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return modTimeSpec(info)
+	}
+	times := Timespec{
 		Mtime: info.ModTime(),
 		Atime: time.Unix(int64(stat.Atim.Sec), int64(stat.Atim.Nsec)),
 		Ctime: time.Unix(int64(stat.Ctim.Sec), int64(stat.Ctim.Nsec)),
@@ -9,12 +9,16 @@ import (
 	"time"
 )
 
-func getTimeSpec(info os.FileInfo) timespec {
-	stat := info.Sys().(*syscall.Stat_t)
-	times := timespec{
+func getTimeSpec(info os.FileInfo) Timespec {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return modTimeSpec(info)
+	}
+	times := Timespec{
 		Mtime: info.ModTime(),
 		Atime: time.Unix(stat.Atimespec.Sec, stat.Atimespec.Nsec),
 		Ctime: time.Unix(stat.Ctimespec.Sec, stat.Ctimespec.Nsec),
+		Btime: time.Unix(stat.Birthtimespec.Sec, stat.Birthtimespec.Nsec),
 	}
 	return times
 }
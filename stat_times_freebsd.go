@@ -9,12 +9,16 @@ import (
 	"time"
 )
 
-func getTimeSpec(info os.FileInfo) timespec {
-	stat := info.Sys().(*syscall.Stat_t)
-	times := timespec{
+func getTimeSpec(info os.FileInfo) Timespec {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return modTimeSpec(info)
+	}
+	times := Timespec{
 		Mtime: info.ModTime(),
 		Atime: time.Unix(int64(stat.Atimespec.Sec), int64(stat.Atimespec.Nsec)),
 		Ctime: time.Unix(int64(stat.Ctimespec.Sec), int64(stat.Ctimespec.Nsec)),
+		Btime: time.Unix(int64(stat.Birthtimespec.Sec), int64(stat.Birthtimespec.Nsec)),
 	}
 	return times
 }
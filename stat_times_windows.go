@@ -9,11 +9,15 @@ import (
 	"time"
 )
 
-func getTimeSpec(info os.FileInfo) timespec {
-	stat := info.Sys().(*syscall.Win32FileAttributeData)
-	return timespec{
+func getTimeSpec(info os.FileInfo) Timespec {
+	stat, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return modTimeSpec(info)
+	}
+	return Timespec{
 		Mtime: time.Unix(0, stat.LastWriteTime.Nanoseconds()),
 		Atime: time.Unix(0, stat.LastAccessTime.Nanoseconds()),
 		Ctime: time.Unix(0, stat.CreationTime.Nanoseconds()),
+		Btime: time.Unix(0, stat.CreationTime.Nanoseconds()),
 	}
 }
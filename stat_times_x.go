@@ -8,11 +8,6 @@ import (
 )
 
 // TODO: check plan9 netbsd in future
-func getTimeSpec(info os.FileInfo) timespec {
-	times := timespec{
-		Mtime: info.ModTime(),
-		Atime: info.ModTime(),
-		Ctime: info.ModTime(),
-	}
-	return times
+func getTimeSpec(info os.FileInfo) Timespec {
+	return modTimeSpec(info)
 }
@@ -0,0 +1,126 @@
+package copy
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// CopyStreamToFile writes the content of r into dest file,
+// with the given mode and modification time, along with its parent directories.
+// The same options as Copy are respected on the destination side,
+// such as PermissionControl, ChownTo, SyncMode and CopyBufferSize.
+// If VerifyAndRollback or Atomic is true, it's written into a temporary file
+// and renamed to dest, though the content can't be verified against a stream.
+// If modTime is zero, the time of dest is left as written.
+func CopyStreamToFile(r io.Reader, dest string, mode os.FileMode, modTime time.Time, opts ...Options) (err error) {
+	opt := assureOptions("", dest, opts...)
+	if err := checkConflicts(opt); err != nil {
+		return err
+	}
+	if opt.DestFS != nil {
+		return fmt.Errorf("%w: CopyStreamToFile and DestFS", ErrConflictingOptions)
+	}
+	if opt.ChownTo != nil {
+		if opt.intent.owner, err = opt.ChownTo.resolve(); err != nil {
+			return err
+		}
+	}
+	info := &streamInfo{name: filepath.Base(dest), mode: mode, modTime: modTime}
+
+	final := dest
+	var f *os.File
+	if opt.VerifyAndRollback || opt.Atomic {
+		if err := mkdirAll(filepath.Dir(dest), os.ModePerm, opt); err != nil {
+			return err
+		}
+		if f, err = ioutil.TempFile(filepath.Dir(dest), "."+filepath.Base(dest)+".*.tmp"); err != nil {
+			return err
+		}
+		dest = f.Name()
+		defer func() {
+			if err != nil {
+				os.Remove(dest)
+			}
+		}()
+	} else {
+		if backingUp(opt) && !opt.DedupeDestNames {
+			if err := backup(dest, opt); err != nil {
+				return err
+			}
+		}
+		if f, dest, err = create(dest, info, opt); err != nil {
+			return err
+		}
+	}
+
+	var buf []byte
+	var w io.Writer = f
+	if opt.CopyBufferSize != 0 {
+		buf = make([]byte, opt.CopyBufferSize)
+		w = struct{ io.Writer }{f}
+	}
+	n, err := io.CopyBuffer(w, wrapReader(progress(r, "", final, -1, opt), "", opt), buf)
+	if opt.BytesWritten != nil {
+		atomic.AddInt64(opt.BytesWritten, n)
+	}
+	if err == nil && opt.SyncMode != SyncNone {
+		err = f.Sync()
+	}
+	fclose(f, &err)
+	if err != nil {
+		return err
+	}
+
+	chmodfunc, err := opt.PermissionControl(info, dest)
+	if err != nil {
+		return err
+	}
+	if chmodfunc(&err); err != nil {
+		return err
+	}
+	if opt.ChownTo != nil {
+		if err := applyOwner("", dest, info, opt); err != nil {
+			return err
+		}
+	}
+	if !modTime.IsZero() {
+		if err := preserveTimes(info, dest, opt); err != nil {
+			return err
+		}
+	}
+
+	if opt.VerifyAndRollback || opt.Atomic {
+		if backingUp(opt) {
+			if err := backup(final, opt); err != nil {
+				return err
+			}
+		}
+		if err := os.Rename(dest, final); err != nil {
+			return err
+		}
+		dest = final
+	}
+	if opt.TimestampSink != nil && !modTime.IsZero() {
+		opt.TimestampSink(dest, getTimeSpec(info))
+	}
+	return nil
+}
+
+// streamInfo is a FileInfo of the file to be written from a stream.
+type streamInfo struct {
+	name    string
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (i *streamInfo) Name() string       { return i.name }
+func (i *streamInfo) Size() int64        { return -1 }
+func (i *streamInfo) Mode() os.FileMode  { return i.mode }
+func (i *streamInfo) ModTime() time.Time { return i.modTime }
+func (i *streamInfo) IsDir() bool        { return false }
+func (i *streamInfo) Sys() interface{}   { return nil }
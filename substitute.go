@@ -0,0 +1,57 @@
+package copy
+
+import "os"
+
+// substitute does what Estimate, Plan, CopyToTar or CopyToZip does
+// instead of writing to dest, after dcopy, fcopy and the others
+// have decided what to copy exactly as Copy does.
+type substitute interface {
+	// stat returns the FileInfo of dest as it would be at this point,
+	// following the symlink if follow is true.
+	stat(dest string, follow bool) (os.FileInfo, error)
+	// dir is for the directory srcdir to be copied onto destdir, before its contents.
+	dir(srcdir, destdir string, info os.FileInfo, opt Options) error
+	// file is for the file src to be copied onto dest.
+	file(src, dest string, info os.FileInfo, opt Options) error
+	// symlink is for the symlink src to be copied as it is,
+	// or for the file src to be linked by SymlinkFiles.
+	symlink(src, dest string, opt Options) error
+	// special is for the named pipe, device or socket src, told by kind.
+	special(src, dest string, info os.FileInfo, kind string, opt Options) error
+	// remove is for dest to be removed, such as by Mirror.
+	remove(src, dest, reason string)
+	// skip is for src not to be copied on purpose.
+	skip(src, dest, reason string)
+}
+
+// substituted returns opt to walk src with s instead of writing to dest,
+// one by one in depth-first order so that s is told everything in order.
+func substituted(opt Options, s substitute) (Options, error) {
+	opt.NumOfWorkers, opt.Traversal, opt.PrefetchDepth, opt.SyncMode = 0, DepthFirst, 0, SyncNone
+	opt.intent.subst = s
+	if opt.IgnoreFile != "" {
+		var err error
+		if opt.intent.ignores, err = readIgnoreFile(opt.IgnoreFile); err != nil {
+			return opt, err
+		}
+	}
+	return opt, nil
+}
+
+// statDest returns the FileInfo of dest, following the symlink if follow is true,
+// or what the substitute tells instead of writing to dest.
+func statDest(dest string, follow bool, opt Options) (os.FileInfo, error) {
+	switch {
+	case opt.intent.subst != nil:
+		return opt.intent.subst.stat(dest, follow)
+	case follow:
+		return os.Stat(dest)
+	}
+	return os.Lstat(dest)
+}
+
+// nothing is what stat of Estimate and archives returns,
+// as there is nothing in dest for them.
+func nothing(dest string) error {
+	return &os.PathError{Op: "lstat", Path: dest, Err: os.ErrNotExist}
+}
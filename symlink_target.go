@@ -0,0 +1,60 @@
+package copy
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// SafeSymlinkTarget provides a validator for Options.ValidateSymlinkTarget,
+// which rejects targets longer than maxlen bytes,
+// or containing null bytes or control characters.
+// If maxlen is 0, the length is not limited.
+func SafeSymlinkTarget(maxlen int) func(target string) error {
+	return func(target string) error {
+		if maxlen > 0 && len(target) > maxlen {
+			return fmt.Errorf("%w: longer than %d bytes", ErrUnsafeSymlinkTarget, maxlen)
+		}
+		for _, c := range target {
+			if c < 0x20 || c == 0x7f {
+				return fmt.Errorf("%w: containing control character %q", ErrUnsafeSymlinkTarget, c)
+			}
+		}
+		return nil
+	}
+}
+
+// rewriteSymlink rewrites the target of the symlink to be created at dest
+// by Options.RewriteSymlinks, if it's absolute and points inside src.
+func rewriteSymlink(target, dest string, opt Options) string {
+	if !filepath.IsAbs(target) {
+		return target
+	}
+	rel, ok := "", false
+	for _, resolve := range []func(string) (string, error){filepath.Abs, realpath} {
+		root, err := resolve(opt.intent.src)
+		if err == nil && within(target, root) {
+			if rel, err = filepath.Rel(root, target); err == nil {
+				ok = true
+				break
+			}
+		}
+	}
+	if !ok {
+		return target
+	}
+	destroot, err := filepath.Abs(opt.intent.dest)
+	if err != nil {
+		return target
+	}
+	rewritten := filepath.Join(destroot, rel)
+	if opt.RewriteSymlinks == RewriteToRelative {
+		link, err := filepath.Abs(dest)
+		if err != nil {
+			return target
+		}
+		if rewritten, err = filepath.Rel(filepath.Dir(link), rewritten); err != nil {
+			return target
+		}
+	}
+	return rewritten
+}
@@ -0,0 +1,101 @@
+package copy
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// SyncReport describes what Sync did.
+// Copied, Unchanged and Failed are the relative paths of files from src,
+// and Deleted are the relative paths of entries from dest.
+type SyncReport struct {
+	Copied    []string
+	Unchanged []string
+	Deleted   []string
+	Failed    []string
+	// Bytes is the total bytes written to dest.
+	Bytes int64
+}
+
+// Sync mirrors src to dest incrementally, like a lightweight rsync.
+// Files whose size and mtime are the same as dest are left unchanged,
+// and only changed or new files are copied.
+// If SkipIfContentEqual is true, files with the same content are also left unchanged,
+// and if Mirror is true, entries which don't exist in src are deleted from dest.
+// PreserveTimes is always true so that the next Sync can find unchanged files.
+func Sync(src, dest string, opts ...Options) (SyncReport, error) {
+	report := SyncReport{}
+	opt := Options{}
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	opt.PreserveTimes = true
+	written := opt.BytesWritten
+	opt.BytesWritten = &report.Bytes
+	opt.intent.sync = &syncState{root: src, report: &report}
+
+	err := Copy(src, dest, opt)
+
+	if written != nil {
+		atomic.AddInt64(written, report.Bytes)
+	}
+	sort.Strings(report.Copied)
+	sort.Strings(report.Unchanged)
+	sort.Strings(report.Deleted)
+	sort.Strings(report.Failed)
+	return report, err
+}
+
+// syncState records what Sync does, even when copying concurrently.
+type syncState struct {
+	mu     sync.Mutex
+	root   string
+	report *SyncReport
+}
+
+func (s *syncState) record(list *[]string, root, path string) {
+	if rel, err := filepath.Rel(root, path); err == nil {
+		path = rel
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	*list = append(*list, path)
+}
+
+// unchanged reports whether the file is unchanged since the last Sync,
+// and records it if so.
+func (s *syncState) unchanged(src, dest string, info os.FileInfo, opt Options) (bool, error) {
+	var same bool
+	var err error
+	if opt.ShouldCopy != nil {
+		var yes bool
+		yes, err = shouldCopy(src, dest, info, opt)
+		same = err == nil && !yes
+	} else {
+		same, err = sameSizeAndTime(dest, info, opt)
+		if err == nil && !same && opt.SkipIfContentEqual {
+			same, err = sameContent(src, dest, info, opt)
+		}
+	}
+	if same {
+		s.record(&s.report.Unchanged, s.root, src)
+	}
+	return same, err
+}
+
+// copied records the file copied or failed.
+func (s *syncState) copied(src string, err *error) {
+	if *err != nil {
+		s.record(&s.report.Failed, s.root, src)
+	} else {
+		s.record(&s.report.Copied, s.root, src)
+	}
+}
+
+// deleted records the entry deleted from dest.
+func (s *syncState) deleted(dest string, opt Options) {
+	s.record(&s.report.Deleted, opt.intent.dest, dest)
+}
@@ -0,0 +1,48 @@
+package copy
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+)
+
+// tarSink writes what's copied into a tar archive.
+type tarSink struct {
+	w *tar.Writer
+}
+
+// CopyToTar streams src into a tar archive written to w,
+// preserving modes, times and symlinks of the entries,
+// and extended attributes as well if Options.PreserveXattrs is set.
+// The same options as Copy are respected, such as Skip, Include and OnSymlink.
+// Entries are named relative to src, or by the base name if src is a file.
+// Directories are walked one by one in depth-first order,
+// so that the archive is always in the same order.
+func CopyToTar(src string, w io.Writer, opts ...Options) error {
+	tw := tar.NewWriter(w)
+	if err := copyToArchive("CopyToTar", src, &tarSink{w: tw}, opts...); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+func (t *tarSink) add(src, dest string, info os.FileInfo, link string, opt Options) (io.Writer, error) {
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return nil, err
+	}
+	hdr.Name = archiveName(dest, info)
+	if opt.PreserveXattrs && opt.FS == nil {
+		xattrs, err := readXattrs(src, opt)
+		if err != nil {
+			return nil, err
+		}
+		for name, value := range xattrs {
+			if hdr.PAXRecords == nil {
+				hdr.PAXRecords = map[string]string{}
+			}
+			hdr.PAXRecords["SCHILY.xattr."+name] = value
+		}
+	}
+	return t.w, t.w.WriteHeader(hdr)
+}
@@ -0,0 +1,59 @@
+package copy
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// sniffLen is the length of the head of a file
+// to be sniffed whether it's binary or not.
+const sniffLen = 8000
+
+// lineTransformReader reads src line by line,
+// transforming each line by the given function.
+type lineTransformReader struct {
+	src       *bufio.Reader
+	name      string
+	transform func(src string, line []byte) []byte
+	pending   []byte
+	err       error
+}
+
+// transformLines wraps the reader of src file with LineTransform,
+// unless the file is binary.
+func transformLines(r io.Reader, src string, opt Options) io.Reader {
+	br := bufio.NewReaderSize(r, sniffLen)
+	if opt.TextFile != nil {
+		if !opt.TextFile(src) {
+			return br
+		}
+	} else if head, _ := br.Peek(sniffLen); bytes.IndexByte(head, 0) >= 0 {
+		return br // Seems binary, like git does.
+	}
+	return &lineTransformReader{src: br, name: src, transform: opt.LineTransform}
+}
+
+func (r *lineTransformReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		line, err := r.src.ReadBytes('\n')
+		r.err = err
+		if len(line) == 0 {
+			continue
+		}
+		newline := line[len(line)-1] == '\n'
+		if newline {
+			line = line[:len(line)-1]
+		}
+		r.pending = r.transform(r.name, line)
+		if newline {
+			r.pending = append(r.pending, '\n')
+		}
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
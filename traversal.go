@@ -0,0 +1,96 @@
+package copy
+
+import (
+	"os"
+	"sync"
+)
+
+// breadthFirst holds directories to be copied level by level.
+type breadthFirst struct {
+	mu sync.Mutex
+
+	// next holds directories found in the current level,
+	// to be copied in the next level.
+	next []entry
+
+	// finishers finish directories after their subdirectories,
+	// in the order that directories are copied.
+	finishers []func(failed error) error
+}
+
+// entry is a directory queued to be copied later.
+type entry struct {
+	src, dest string
+	info      os.FileInfo
+	opt       Options
+}
+
+// enqueue queues a directory to be copied in the next level.
+func (b *breadthFirst) enqueue(src, dest string, info os.FileInfo, opt Options) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.next = append(b.next, entry{src, dest, info, opt})
+}
+
+// finally registers a function to finish a directory after all the levels.
+func (b *breadthFirst) finally(finish func(failed error) error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.finishers = append(b.finishers, finish)
+}
+
+// run copies queued directories level by level,
+// and then finishes all the directories from the deepest.
+func (b *breadthFirst) run() (err error) {
+	for err == nil {
+		b.mu.Lock()
+		level := b.next
+		b.next = nil
+		b.mu.Unlock()
+		if len(level) == 0 {
+			break
+		}
+		for _, e := range level {
+			if err = stopped(e.opt); err != nil {
+				break
+			}
+			if err = switchboard(e.src, e.dest, e.info, e.opt); err != nil {
+				break
+			}
+		}
+	}
+	// Finish even if failed, so that permissions are restored.
+	for i := len(b.finishers) - 1; i >= 0; i-- {
+		if ferr := b.finishers[i](err); err == nil {
+			err = ferr
+		}
+	}
+	return err
+}
+
+// coalesced holds functions to finish directories at the end of copying,
+// by CoalesceDirMetadata.
+type coalesced struct {
+	mu        sync.Mutex
+	finishers []func(failed error) error
+}
+
+// add registers a function to finish a directory at the end.
+// Because a directory is finished after its subdirectories,
+// they are registered from the deepest.
+func (c *coalesced) add(finish func(failed error) error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.finishers = append(c.finishers, finish)
+}
+
+// run finishes all the directories in the order registered,
+// even if failed, so that permissions are restored.
+func (c *coalesced) run(failed error) (err error) {
+	for _, finish := range c.finishers {
+		if ferr := finish(failed); err == nil {
+			err = ferr
+		}
+	}
+	return err
+}
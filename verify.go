@@ -0,0 +1,122 @@
+package copy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// fcopyAtomic copies src into a temporary file next to dest,
+// and renames it to dest only if it's copied successfully,
+// and has the same content as src by VerifyAndRollback or Verify.
+// Otherwise the temporary file is removed and dest is left intact.
+func fcopyAtomic(src, dest string, info os.FileInfo, opt Options) (err error) {
+	if opt.DedupeDestNames {
+		// Reserve the name first, and remove it if failed.
+		f, name, err := create(dest, info, opt)
+		if err != nil {
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		dest = name
+		defer func() {
+			if err != nil {
+				os.Remove(dest)
+			}
+		}()
+	}
+
+	if err := mkdirAll(filepath.Dir(dest), os.ModePerm, opt); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(dest), "."+filepath.Base(dest)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	if err := f.Close(); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(tmp)
+		}
+	}()
+
+	// The temporary file is written as it is, and the rest is done here for dest.
+	inner := opt
+	inner.DedupeDestNames, inner.Verify, inner.BatchWriter = false, false, nil
+	inner.PreserveFileFlags, inner.TimestampSink, inner.FilesCopied, inner.intent.checksums = false, nil, nil, nil
+	if inner.SyncMode == SyncBatched {
+		// Because it's renamed, only the directory is synced in batch.
+		inner.SyncMode = SyncPerFile
+	}
+	if err := fwrite(src, tmp, info, inner); err != nil {
+		return err
+	}
+
+	if opt.VerifyAndRollback || opt.Verify {
+		if err := verify(src, tmp, opt); err != nil {
+			return &os.PathError{Op: "verify", Path: dest, Err: err}
+		}
+	}
+	if backingUp(opt) && !opt.DedupeDestNames {
+		// Only when it's verified, right before replaced.
+		if err := backup(dest, opt); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(tmp, dest); err != nil {
+		return err
+	}
+
+	if opt.PreserveFileFlags && opt.FS == nil {
+		// After renamed, because immutable file cannot be renamed.
+		if err := preserveFlags(src, dest); err != nil {
+			return err
+		}
+	}
+	if opt.intent.checksums != nil {
+		if err := opt.intent.checksums.file(dest); err != nil {
+			return err
+		}
+	}
+	if opt.TimestampSink != nil {
+		opt.TimestampSink(dest, getTimeSpec(info))
+	}
+	if opt.FilesCopied != nil {
+		atomic.AddInt64(opt.FilesCopied, 1)
+	}
+	return nil
+}
+
+// verify compares the content of dest with src, and returns
+// VerifyMismatchError as soon as the first different chunk is found,
+// or if their digests are different by CompareByHash.
+func verify(src, dest string, opt Options) error {
+	s, err := open(src, opt)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	d, err := os.Open(dest)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if opt.CompareByHash {
+		if same, err := equalDigests(s, d, opt.Hasher); err != nil || same {
+			return err
+		}
+		return &VerifyMismatchError{Offset: -1}
+	}
+	if offset, err := firstDiff(s, d); err != nil {
+		return err
+	} else if offset >= 0 {
+		return &VerifyMismatchError{Offset: offset}
+	}
+	return nil
+}
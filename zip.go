@@ -0,0 +1,40 @@
+package copy
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+)
+
+// zipSink writes what's copied into a zip archive.
+type zipSink struct {
+	w *zip.Writer
+}
+
+// CopyToZip writes src into zw, in the same way as CopyToTar,
+// with the modes and modification times of the entries in their headers.
+// Regular files are compressed by zip.Deflate,
+// and symlinks are stored with their targets as contents.
+// zw is not closed, so that more can be written into the same archive.
+func CopyToZip(src string, zw *zip.Writer, opts ...Options) error {
+	return copyToArchive("CopyToZip", src, &zipSink{w: zw}, opts...)
+}
+
+func (z *zipSink) add(src, dest string, info os.FileInfo, link string, opt Options) (io.Writer, error) {
+	hdr, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return nil, err
+	}
+	hdr.Name = archiveName(dest, info)
+	if info.Mode().IsRegular() {
+		hdr.Method = zip.Deflate
+	}
+	w, err := z.w.CreateHeader(hdr)
+	if err != nil {
+		return nil, err
+	}
+	if link != "" {
+		_, err = io.WriteString(w, link)
+	}
+	return w, err
+}